@@ -0,0 +1,376 @@
+// Package client is a Go client of the XM REST API.
+//
+// A Client logs in with its credentials when it needs a token, refreshes the token before it
+// expires and retries the requests that are rate limited or fail with a server error. Error
+// responses are returned as *Error, which matches the sentinel errors of the package:
+//
+//	c := client.New("http://localhost:8080", client.WithCredentials("admin", "secret"))
+//	company, err := c.GetCompany(ctx, id)
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiPath = "/api/v1"
+
+	DefaultRetries       = 3
+	DefaultMinBackoff    = 200 * time.Millisecond
+	DefaultMaxBackoff    = 5 * time.Second
+	DefaultRefreshWindow = 5 * time.Minute
+)
+
+// Token is a JWT of the API and its expiry time.
+type Token struct {
+	Token  string    `json:"token"`
+	Expire time.Time `json:"expire"`
+}
+
+// Client calls the XM REST API. It is safe for concurrent use.
+type Client struct {
+	baseURL       string
+	httpClient    *http.Client
+	retries       int
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	refreshWindow time.Duration
+
+	// mu guards the credentials and the token, and serializes the logins and refreshes.
+	mu       sync.Mutex
+	username string
+	password string
+	token    Token
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client of the requests, http.DefaultClient by default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCredentials sets the credentials used to log in when the client has no valid token.
+func WithCredentials(username string, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithToken sets the token of the client, for instance one saved from a previous Login.
+func WithToken(token Token) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries sets how many times a rate limited or failed request is retried. Zero disables retries.
+// Only the idempotent requests are retried: the GET, HEAD, OPTIONS, PUT and DELETE ones, and the
+// POST ones with an Idempotency-Key header.
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.retries = max(retries, 0)
+	}
+}
+
+// WithBackoff sets the bounds of the exponential backoff between retries. A Retry-After
+// header of the response takes precedence, up to maxBackoff.
+func WithBackoff(minBackoff time.Duration, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = minBackoff
+		c.maxBackoff = max(minBackoff, maxBackoff)
+	}
+}
+
+// WithRefreshWindow sets how long before its expiry the token is refreshed.
+func WithRefreshWindow(window time.Duration) Option {
+	return func(c *Client) {
+		c.refreshWindow = window
+	}
+}
+
+// New returns a client of the API served at baseURL, such as http://localhost:8080.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:       strings.TrimSuffix(baseURL, "/") + apiPath,
+		httpClient:    http.DefaultClient,
+		retries:       DefaultRetries,
+		minBackoff:    DefaultMinBackoff,
+		maxBackoff:    DefaultMaxBackoff,
+		refreshWindow: DefaultRefreshWindow,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// Login gets a token for the user. The credentials are kept to log in again once the token
+// can no longer be refreshed.
+func (c *Client) Login(ctx context.Context, username string, password string) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, err := c.login(ctx, username, password)
+	if err != nil {
+		return Token{}, err
+	}
+	c.username, c.password = username, password
+
+	return token, nil
+}
+
+// RefreshToken replaces the token of the client with a new one.
+func (c *Client) RefreshToken(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refresh(ctx)
+}
+
+// Token returns the current token of the client, which may be empty or expired.
+func (c *Client) Token() Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+func (c *Client) login(ctx context.Context, username string, password string) (Token, error) {
+	body := map[string]string{"username": username, "password": password}
+	var token Token
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/login", body: body}, &token); err != nil {
+		return Token{}, fmt.Errorf("login: %w", err)
+	}
+	c.token = token
+
+	return token, nil
+}
+
+func (c *Client) refresh(ctx context.Context) (Token, error) {
+	var token Token
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/refresh_token", token: c.token.Token}, &token)
+	if err != nil {
+		return Token{}, fmt.Errorf("refresh token: %w", err)
+	}
+	c.token = token
+
+	return token, nil
+}
+
+// authorization returns a token valid for the next request. It is refreshed when it is about
+// to expire and replaced by a new login when it has expired or cannot be refreshed.
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.token.Token != "" && now.Add(c.refreshWindow).Before(c.token.Expire) {
+		return c.token.Token, nil
+	}
+
+	var err error
+	if c.token.Token != "" && now.Before(c.token.Expire) {
+		if _, err = c.refresh(ctx); err == nil {
+			return c.token.Token, nil
+		}
+	}
+	if c.username == "" {
+		if err != nil {
+			return "", err
+		}
+		if c.token.Token == "" {
+			return "", fmt.Errorf("%w: log in first or set the credentials of the client", ErrUnauthorized)
+		}
+		// Expired, let the API reject it.
+		return c.token.Token, nil
+	}
+
+	if _, err = c.login(ctx, c.username, c.password); err != nil {
+		return "", err
+	}
+
+	return c.token.Token, nil
+}
+
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	contentType string
+	body        any
+	// authorized requests get a token from the client, token is used as is otherwise.
+	authorized bool
+	token      string
+}
+
+// do sends the request, with retries, decodes the JSON response in out, if not nil, and
+// returns the headers of the response.
+func (c *Client) do(ctx context.Context, r request, out any) (http.Header, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		body, err = json.Marshal(r.body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: encode request: %w", ErrClient, err)
+		}
+		if r.contentType == "" {
+			r.contentType = "application/json"
+		}
+	}
+
+	target := c.baseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+
+	retries := 0
+	if r.idempotent() {
+		retries = c.retries
+	}
+	for attempt := 0; ; attempt++ {
+		token := r.token
+		if r.authorized {
+			var err error
+			if token, err = c.authorization(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := c.send(ctx, r, target, body, token)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= retries {
+				return nil, fmt.Errorf("%w: %s %s: %w", ErrClient, r.method, r.path, err)
+			}
+			if err := c.wait(ctx, attempt, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError {
+			if attempt < retries {
+				retryAfter := response.Header.Get("Retry-After")
+				drain(response)
+				if err := c.wait(ctx, attempt, retryAfter); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		return response.Header, decodeResponse(response, out)
+	}
+}
+
+// idempotent reports whether sending the request twice has the effect of sending it once, so that
+// it can be retried after a failure.
+func (r request) idempotent() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return r.header.Get("Idempotency-Key") != ""
+	default:
+		return false
+	}
+}
+
+func (c *Client) send(ctx context.Context, r request, target string, body []byte, token string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// wait sleeps before the next attempt, for the Retry-After delay of the response when it has one,
+// up to maxBackoff. It gives up at once when the context ends before the delay.
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	delay := c.backoff(attempt)
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = min(time.Duration(seconds)*time.Second, c.maxBackoff)
+	} else if at, err := http.ParseTime(retryAfter); err == nil {
+		delay = min(max(time.Until(at), 0), c.maxBackoff)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return fmt.Errorf("%w: %w", ErrClient, context.DeadlineExceeded)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrClient, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff is an exponential delay with full jitter.
+func (c *Client) backoff(attempt int) time.Duration {
+	limit := c.maxBackoff
+	if attempt < 32 {
+		limit = min(c.minBackoff<<attempt, c.maxBackoff)
+	}
+	if limit <= 0 {
+		return 0
+	}
+
+	return rand.N(limit) + 1
+}
+
+func decodeResponse(response *http.Response, out any) error {
+	defer drain(response)
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return responseError(response)
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: decode response: %w", ErrClient, err)
+	}
+
+	return nil
+}
+
+func drain(response *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+	_ = response.Body.Close()
+}
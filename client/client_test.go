@@ -0,0 +1,296 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/api"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(ClientFixture))
+}
+
+type ClientFixture struct {
+	suite.Suite
+
+	ctx      context.Context
+	config   *config.Config
+	server   *httptest.Server
+	requests map[string]*atomic.Int32
+}
+
+func (cf *ClientFixture) SetupTest() {
+	database, err := db.InitTestSqlite()
+	cf.NoError(err)
+	cf.ctx = context.Background()
+	cf.config = &config.Config{
+		AppPort: "1234", AuthJwtSecret: "secret", AuthUser: "admin", AuthPassword: "admin-password",
+		RateLimit: 1000, RateBurst: 100}
+	_, err = service.NewUserService(repository.NewUserRepository(database)).Add(cf.config.AuthUser, cf.config.AuthPassword, model.RoleAdmin)
+	cf.NoError(err)
+
+	router, err := api.NewRestApi(cf.ctx, zerolog.Nop(), cf.config, database).BuildRouter()
+	cf.NoError(err)
+	cf.requests = map[string]*atomic.Int32{"/api/v1/login": {}, "/api/v1/refresh_token": {}}
+	cf.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if counter, ok := cf.requests[r.URL.Path]; ok {
+			counter.Add(1)
+		}
+		router.ServeHTTP(w, r)
+	}))
+}
+
+func (cf *ClientFixture) TearDownTest() {
+	cf.server.Close()
+}
+
+func (cf *ClientFixture) TestCompanies() {
+	c := New(cf.server.URL, WithCredentials(cf.config.AuthUser, cf.config.AuthPassword))
+
+	created, err := c.CreateCompany(cf.ctx, testCompany())
+	cf.NoError(err)
+	cf.NotEqual(uuid.Nil, created.ID)
+	cf.NotEmpty(created.ETag)
+	cf.Equal(int32(1), cf.requests["/api/v1/login"].Load())
+
+	_, err = c.CreateCompany(cf.ctx, testCompany())
+	cf.ErrorIs(err, ErrDuplicateName)
+	cf.ErrorIs(err, ErrConflict)
+
+	invalid := testCompany()
+	invalid.Name = "Invalid"
+	invalid.Type = "Partnership"
+	_, err = c.CreateCompany(cf.ctx, invalid)
+	cf.ErrorIs(err, ErrInvalid)
+	var apiError *Error
+	cf.True(errors.As(err, &apiError))
+	cf.Equal(http.StatusUnprocessableEntity, apiError.StatusCode)
+	cf.Equal("validation_failed", apiError.Code)
+	cf.Equal([]FieldError{{Field: "Type", Code: "company_type", Message: "is not a known company type"}}, apiError.Fields)
+
+	got, err := c.GetCompany(cf.ctx, created.ID)
+	cf.NoError(err)
+	cf.Equal(created, got)
+
+	description := ""
+	registered := false
+	updated, err := c.UpdateCompany(cf.ctx, created.ID, CompanyUpdate{Description: &description, Registered: &registered, IfMatch: got.ETag})
+	cf.NoError(err)
+	cf.Empty(updated.Description)
+	cf.False(updated.Registered)
+	cf.Equal(created.Name, updated.Name)
+	cf.NotEqual(got.ETag, updated.ETag)
+
+	name := "Renamed"
+	_, err = c.UpdateCompany(cf.ctx, created.ID, CompanyUpdate{Name: &name, IfMatch: got.ETag})
+	cf.ErrorIs(err, ErrPreconditionFailed)
+
+	other := testCompany()
+	other.Name = "Other"
+	_, err = c.CreateCompany(cf.ctx, other)
+	cf.NoError(err)
+
+	page, err := c.ListCompanies(cf.ctx, CompanyListOptions{Registered: &registered})
+	cf.NoError(err)
+	cf.Len(page.Items, 1)
+	cf.Equal(created.ID, page.Items[0].ID)
+
+	page, err = c.ListCompanies(cf.ctx, CompanyListOptions{Sort: "Name", Limit: 1})
+	cf.NoError(err)
+	cf.Len(page.Items, 1)
+	cf.Equal("Other", page.Items[0].Name)
+	page, err = c.ListCompanies(cf.ctx, CompanyListOptions{Sort: "Name", Limit: 1, Cursor: page.NextCursor})
+	cf.NoError(err)
+	cf.Equal(created.ID, page.Items[0].ID)
+	cf.Empty(page.NextCursor)
+
+	cf.NoError(c.DeleteCompany(cf.ctx, created.ID))
+	_, err = c.GetCompany(cf.ctx, created.ID)
+	cf.ErrorIs(err, ErrNotFound)
+
+	page, err = c.ListCompanies(cf.ctx, CompanyListOptions{IncludeDeleted: true, Sort: "Name"})
+	cf.NoError(err)
+	cf.Len(page.Items, 2)
+	cf.NotNil(page.Items[1].DeletedAt)
+
+	_, err = c.ListCompanies(cf.ctx, CompanyListOptions{Limit: 1, Cursor: "not-a-cursor"})
+	cf.ErrorIs(err, ErrInvalid)
+	cf.Equal(int32(1), cf.requests["/api/v1/login"].Load())
+}
+
+func (cf *ClientFixture) TestLogin() {
+	c := New(cf.server.URL)
+
+	_, err := c.CreateCompany(cf.ctx, testCompany())
+	cf.ErrorIs(err, ErrUnauthorized)
+
+	_, err = c.Login(cf.ctx, cf.config.AuthUser, "wrong")
+	cf.ErrorIs(err, ErrUnauthorized)
+	cf.Empty(c.Token().Token)
+
+	token, err := c.Login(cf.ctx, cf.config.AuthUser, cf.config.AuthPassword)
+	cf.NoError(err)
+	cf.NotEmpty(token.Token)
+	cf.WithinDuration(time.Now().Add(time.Hour), token.Expire, time.Minute)
+	cf.Equal(token, c.Token())
+
+	_, err = c.CreateCompany(cf.ctx, testCompany())
+	cf.NoError(err)
+
+	refreshed, err := c.RefreshToken(cf.ctx)
+	cf.NoError(err)
+	cf.NotEmpty(refreshed.Token)
+	cf.Equal(refreshed, c.Token())
+}
+
+func (cf *ClientFixture) TestAutomaticRefresh() {
+	token, err := New(cf.server.URL).Login(cf.ctx, cf.config.AuthUser, cf.config.AuthPassword)
+	cf.NoError(err)
+
+	// Every token is within the refresh window.
+	c := New(cf.server.URL, WithToken(token), WithRefreshWindow(2*time.Hour))
+	_, err = c.CreateCompany(cf.ctx, testCompany())
+	cf.NoError(err)
+	cf.Equal(int32(1), cf.requests["/api/v1/refresh_token"].Load())
+
+	// Expired tokens are replaced by a login.
+	expired := Token{Token: token.Token, Expire: time.Now().Add(-time.Minute)}
+	c = New(cf.server.URL, WithToken(expired), WithCredentials(cf.config.AuthUser, cf.config.AuthPassword))
+	cf.NoError(c.DeleteCompany(cf.ctx, uuid.New()))
+	cf.Equal(int32(2), cf.requests["/api/v1/login"].Load())
+	cf.True(c.Token().Expire.After(time.Now()))
+
+	// Without credentials, the expired token is sent as is.
+	c = New(cf.server.URL, WithToken(Token{Token: "expired", Expire: time.Now().Add(-time.Minute)}))
+	cf.ErrorIs(c.DeleteCompany(cf.ctx, uuid.New()), ErrUnauthorized)
+}
+
+func (cf *ClientFixture) TestRetries() {
+	var attempts atomic.Int32
+	var keys []string
+	failures := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	retryAfter := "0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := int(attempts.Add(1)) - 1
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if attempt < len(failures) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(failures[attempt])
+			_, _ = w.Write([]byte(`{"status":503,"code":"internal_error"}`))
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		_, _ = w.Write([]byte(`{"ID":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","Name":"TestCompany"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithToken(Token{Token: "token", Expire: time.Now().Add(time.Hour)}), WithBackoff(time.Millisecond, time.Millisecond))
+	company, err := c.CreateCompany(cf.ctx, testCompany())
+	cf.NoError(err)
+	cf.Equal("TestCompany", company.Name)
+	cf.Equal(`"1"`, company.ETag)
+	cf.Equal(int32(3), attempts.Load())
+	cf.Len(keys, 3)
+	cf.NotEmpty(keys[0])
+	cf.Equal([]string{keys[0], keys[0], keys[0]}, keys)
+
+	attempts.Store(0)
+	failures = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	_, err = New(server.URL, WithRetries(2), WithBackoff(time.Millisecond, time.Millisecond)).GetCompany(cf.ctx, uuid.New())
+	cf.ErrorIs(err, ErrServer)
+	var apiError *Error
+	cf.True(errors.As(err, &apiError))
+	cf.Equal(http.StatusBadGateway, apiError.StatusCode)
+	cf.Equal(int32(3), attempts.Load())
+
+	attempts.Store(0)
+	retryAfter = ""
+	ctx, cancel := context.WithTimeout(cf.ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = New(server.URL, WithBackoff(time.Hour, time.Hour)).GetCompany(ctx, uuid.New())
+	cf.ErrorIs(err, context.DeadlineExceeded)
+	cf.ErrorIs(err, ErrClient)
+	cf.Equal(int32(1), attempts.Load())
+
+	// The Retry-After delay is capped by the backoff.
+	attempts.Store(0)
+	failures = []int{http.StatusTooManyRequests}
+	retryAfter = "3600"
+	startedAt := time.Now()
+	_, err = New(server.URL, WithBackoff(time.Millisecond, 10*time.Millisecond)).GetCompany(cf.ctx, uuid.New())
+	cf.NoError(err)
+	cf.Equal(int32(2), attempts.Load())
+	cf.Less(time.Since(startedAt), time.Second)
+}
+
+func (cf *ClientFixture) TestRetries_NotIdempotent() {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"status":503,"code":"internal_error"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithToken(Token{Token: "token", Expire: time.Now().Add(time.Hour)}), WithBackoff(time.Millisecond, time.Millisecond))
+	_, err := c.RefreshToken(cf.ctx)
+	cf.ErrorIs(err, ErrServer)
+	cf.Equal(int32(1), attempts.Load())
+
+	attempts.Store(0)
+	_, err = c.UpdateCompany(cf.ctx, uuid.New(), CompanyUpdate{})
+	cf.ErrorIs(err, ErrServer)
+	cf.Equal(int32(1), attempts.Load())
+
+	attempts.Store(0)
+	_, err = c.GetCompany(cf.ctx, uuid.New())
+	cf.ErrorIs(err, ErrServer)
+	cf.Equal(int32(1+DefaultRetries), attempts.Load())
+}
+
+func (cf *ClientFixture) TestModel() {
+	jsonNames := func(t reflect.Type) []string {
+		var names []string
+		for _, field := range reflect.VisibleFields(t) {
+			if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "-" && !field.Anonymous {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	cf.ElementsMatch(jsonNames(reflect.TypeFor[dto.Company]()), jsonNames(reflect.TypeFor[Company]()))
+
+	var types []model.CompanyType
+	for _, companyType := range CompanyTypes {
+		types = append(types, model.CompanyType(companyType))
+	}
+	cf.Equal(model.CompanyTypes, types)
+}
+
+func testCompany() Company {
+	return Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              CompanyTypeCorporation,
+	}
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type CompanyType string
+
+const (
+	CompanyTypeCorporation        CompanyType = "Corporations"
+	CompanyTypeNonProfit          CompanyType = "Non Profit"
+	CompanyTypeCooperative        CompanyType = "Cooperative"
+	CompanyTypeSoleProprietorship CompanyType = "Sole Proprietorship"
+)
+
+var CompanyTypes = []CompanyType{
+	CompanyTypeCorporation,
+	CompanyTypeNonProfit,
+	CompanyTypeCooperative,
+	CompanyTypeSoleProprietorship,
+}
+
+type Company struct {
+	ID                uuid.UUID   `json:"ID,omitempty"`
+	Name              string      `json:"Name,omitempty"`
+	Description       string      `json:"Description,omitempty"`
+	AmountOfEmployees int         `json:"AmountOfEmployees"`
+	Registered        bool        `json:"Registered"`
+	Type              CompanyType `json:"Type,omitempty"`
+	// DeletedAt is set on soft deleted companies.
+	DeletedAt *time.Time `json:"DeletedAt,omitempty"`
+	// ETag is the version of the company when it was read, for CompanyUpdate.IfMatch.
+	ETag string `json:"-"`
+}
+
+// CompanyUpdate holds the fields to change, the nil ones are left as they are.
+type CompanyUpdate struct {
+	Name              *string      `json:"Name,omitempty"`
+	Description       *string      `json:"Description,omitempty"`
+	AmountOfEmployees *int         `json:"AmountOfEmployees,omitempty"`
+	Registered        *bool        `json:"Registered,omitempty"`
+	Type              *CompanyType `json:"Type,omitempty"`
+	// IfMatch, when set, only applies the update to the company version of this ETag,
+	// the update fails with ErrPreconditionFailed otherwise.
+	IfMatch string `json:"-"`
+}
+
+// CompanyListOptions filters and pages a listing. The zero value lists the first page of all
+// the companies.
+type CompanyListOptions struct {
+	Types        []CompanyType
+	Registered   *bool
+	MinEmployees *int
+	MaxEmployees *int
+	NamePrefix   string
+	// Sort is a comma separated list of fields, descending with a - prefix, such as "-AmountOfEmployees,Name".
+	Sort           string
+	Limit          int
+	Cursor         string
+	IncludeDeleted bool
+}
+
+// CompanyPage is a page of companies and the cursor of the next one, empty on the last page.
+type CompanyPage struct {
+	Items      []Company `json:"items"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// CreateCompany creates a company. Retries reuse the same Idempotency-Key, so a company is
+// created once even when a response is lost.
+func (c *Client) CreateCompany(ctx context.Context, company Company) (*Company, error) {
+	header := http.Header{"Idempotency-Key": {uuid.NewString()}}
+	created := &Company{}
+	header, err := c.do(ctx, request{method: http.MethodPost, path: "/company", header: header, body: company, authorized: true}, created)
+	if err != nil {
+		return nil, fmt.Errorf("create company: %w", err)
+	}
+	created.ETag = header.Get("ETag")
+
+	return created, nil
+}
+
+func (c *Client) GetCompany(ctx context.Context, id uuid.UUID) (*Company, error) {
+	company := &Company{}
+	header, err := c.do(ctx, request{method: http.MethodGet, path: "/company/" + id.String()}, company)
+	if err != nil {
+		return nil, fmt.Errorf("get company: %w", err)
+	}
+	company.ETag = header.Get("ETag")
+
+	return company, nil
+}
+
+// UpdateCompany changes the fields of the update and returns the updated company.
+func (c *Client) UpdateCompany(ctx context.Context, id uuid.UUID, update CompanyUpdate) (*Company, error) {
+	r := request{
+		method:      http.MethodPatch,
+		path:        "/company/" + id.String(),
+		contentType: "application/merge-patch+json",
+		body:        update,
+		authorized:  true,
+	}
+	if update.IfMatch != "" {
+		r.header = http.Header{"If-Match": {update.IfMatch}}
+	}
+
+	company := &Company{}
+	header, err := c.do(ctx, r, company)
+	if err != nil {
+		return nil, fmt.Errorf("update company: %w", err)
+	}
+	company.ETag = header.Get("ETag")
+
+	return company, nil
+}
+
+// DeleteCompany soft deletes a company. Deleting a missing company succeeds.
+func (c *Client) DeleteCompany(ctx context.Context, id uuid.UUID) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/company/" + id.String(), authorized: true}, nil)
+	if err != nil {
+		return fmt.Errorf("delete company: %w", err)
+	}
+
+	return nil
+}
+
+// ListCompanies returns a page of companies. Listing the deleted companies needs a token, the
+// other listings are anonymous.
+func (c *Client) ListCompanies(ctx context.Context, options CompanyListOptions) (*CompanyPage, error) {
+	query := url.Values{}
+	for _, companyType := range options.Types {
+		query.Add("type", string(companyType))
+	}
+	if options.Registered != nil {
+		query.Set("registered", strconv.FormatBool(*options.Registered))
+	}
+	if options.MinEmployees != nil {
+		query.Set("min_employees", strconv.Itoa(*options.MinEmployees))
+	}
+	if options.MaxEmployees != nil {
+		query.Set("max_employees", strconv.Itoa(*options.MaxEmployees))
+	}
+	if options.NamePrefix != "" {
+		query.Set("name_prefix", options.NamePrefix)
+	}
+	if options.Sort != "" {
+		query.Set("sort", options.Sort)
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Cursor != "" {
+		query.Set("cursor", options.Cursor)
+	}
+	if options.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+
+	page := &CompanyPage{}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/company", query: query, authorized: options.IncludeDeleted}, page)
+	if err != nil {
+		return nil, fmt.Errorf("list companies: %w", err)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrClient is the error of a request that got no response from the API, or an unreadable one.
+	ErrClient = errors.New("xm client error")
+
+	// The errors matched by the *Error of an error response, by status or problem code.
+	ErrInvalid            = errors.New("invalid request")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrDuplicateName      = errors.New("duplicate company name")
+	ErrVersionConflict    = errors.New("version conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrServer             = errors.New("server error")
+)
+
+// FieldError is an invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error response of the API, an RFC 7807 problem. Code is the stable problem code,
+// such as not_found or validation_failed.
+type Error struct {
+	StatusCode int          `json:"status"`
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Detail     string       `json:"detail"`
+	Instance   string       `json:"instance"`
+	Code       string       `json:"code"`
+	Fields     []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	message := e.Detail
+	if message == "" {
+		message = e.Title
+	}
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+
+	return fmt.Sprintf("xm api: %d %s: %s", e.StatusCode, e.Code, message)
+}
+
+// Is matches the sentinel error of the status or the code of the problem.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInvalid:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity ||
+			e.StatusCode == http.StatusUnsupportedMediaType
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrDuplicateName:
+		return e.Code == "duplicate_name"
+	case ErrVersionConflict:
+		return e.Code == "version_conflict"
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+
+	return false
+}
+
+// responseError reads the problem of an error response. Responses that are not problems,
+// from a proxy for instance, keep their status.
+func responseError(response *http.Response) error {
+	apiError := &Error{}
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err == nil {
+		_ = json.Unmarshal(body, apiError)
+	}
+	apiError.StatusCode = response.StatusCode
+
+	return apiError
+}
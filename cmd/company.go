@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/validator"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var companyFormat string
+var companyOutput string
+var companyDryRun bool
+var companyUpsert bool
+
+// companyCmd represents the company data commands
+var companyCmd = &cobra.Command{
+	Use:   "company",
+	Short: "Export and import companies.",
+	Long:  `Export the companies to, and import them from, CSV, NDJSON and JSON files.`,
+}
+
+var companyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the companies (csv, ndjson, json).",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := service.ParseCompanyFormat(companyFormat)
+		if err != nil {
+			return err
+		}
+
+		companyService, err := companyService()
+		if err != nil {
+			return err
+		}
+
+		var output io.Writer = os.Stdout
+		if companyOutput != "" && companyOutput != "-" {
+			file, err := os.Create(companyOutput)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			output = file
+		}
+
+		count, err := companyService.Export(context.Background(), output, format, service.CompanyListQuery{})
+		if err != nil {
+			return err
+		}
+
+		logger.Info().Int("count", count).Str("format", string(format)).Msg("Companies exported.")
+		return nil
+	},
+}
+
+var companyImportCmd = &cobra.Command{
+	Use:   "import [FILE]",
+	Short: "Import companies from a file or stdin (csv, ndjson, json).",
+	Args:  cobra.MaximumNArgs(1),
+	// Failed lines are logged, the usage would hide them.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var input io.Reader = os.Stdin
+		name := companyFormat
+		if len(args) == 1 && args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			input = file
+
+			if !cmd.Flags().Changed("format") {
+				name = strings.TrimPrefix(filepath.Ext(args[0]), ".")
+			}
+		}
+
+		format, err := service.ParseCompanyFormat(name)
+		if err != nil {
+			return err
+		}
+
+		companyService, err := companyService()
+		if err != nil {
+			return err
+		}
+
+		options := service.CompanyImportOptions{DryRun: companyDryRun, Upsert: companyUpsert}
+		result, err := companyService.Import(context.Background(), input, format, options)
+		if err != nil {
+			return err
+		}
+
+		for _, lineError := range result.Errors {
+			logger.Error().Int("line", lineError.Line).Err(lineError.Err).Msg("Import line.")
+		}
+		logger.Info().Bool("dry_run", companyDryRun).Int("created", result.Created).Int("updated", result.Updated).
+			Int("failed", len(result.Errors)).Msg("Companies imported.")
+
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("%d lines failed", len(result.Errors))
+		}
+
+		return nil
+	},
+}
+
+func initCompanyCmd() {
+	companyExportCmd.Flags().StringVar(&companyFormat, "format", string(service.CompanyFormatCSV), "Format (csv, ndjson, json)")
+	companyExportCmd.Flags().StringVarP(&companyOutput, "output", "o", "-", "Output file (stdout when -)")
+
+	companyImportCmd.Flags().StringVar(&companyFormat, "format", string(service.CompanyFormatCSV), "Format (csv, ndjson, json), by default the extension of FILE")
+	companyImportCmd.Flags().BoolVar(&companyDryRun, "dry-run", false, "Check every line but save nothing")
+	companyImportCmd.Flags().BoolVar(&companyUpsert, "upsert", false, "Update the companies with a known name instead of failing")
+
+	companyCmd.AddCommand(companyExportCmd, companyImportCmd)
+}
+
+func companyService() (*service.Company, error) {
+	companyRepository, err := repository.NewCompanyRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewCompanyService(companyRepository, validator.CompanyValidator(logger)), nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/vcsfrl/xm/internal/config"
+	"time"
 )
 
 func buildConfig(logger zerolog.Logger) *config.Config {
@@ -12,27 +13,86 @@ func buildConfig(logger zerolog.Logger) *config.Config {
 
 	var newConfig config.Config
 	newConfig.TracePort = viper.Get("tracePort").(string)
+	newConfig.HealthPort = viper.GetString("healthPort")
+	newConfig.HealthMaxEventLag = viper.GetDuration("healthMaxEventLag")
+	newConfig.HealthMinFreeDiskMb = viper.GetInt("healthMinFreeDiskMb")
+	newConfig.ShutdownDelay = viper.GetDuration("shutdownDelay")
 	newConfig.AuthUser = viper.Get("authUser").(string)
 	newConfig.AuthPassword = viper.Get("authPassword").(string)
 	newConfig.AuthJwtSecret = viper.Get("authJwtSecret").(string)
+	newConfig.DbDriver = viper.GetString("dbDriver")
 	newConfig.DbPath = viper.Get("dbPath").(string)
+	newConfig.DbDsn = viper.GetString("dbDsn")
+	newConfig.DbLogLevel = viper.GetString("dbLogLevel")
+	newConfig.DbSlowQueryThreshold = viper.GetDuration("dbSlowQueryThreshold")
+	newConfig.DbLogParameters = viper.GetBool("dbLogParameters")
 	newConfig.AppPort = viper.Get("appPort").(string)
+	newConfig.GrpcPort = viper.GetString("grpcPort")
 	newConfig.RateLimit = viper.GetFloat64("rateLimit")
 	newConfig.RateBurst = viper.GetInt("rateBurst")
+	newConfig.EventPublisher = viper.GetString("eventPublisher")
+	newConfig.EventFilePath = viper.GetString("eventFilePath")
+	newConfig.EventDispatchInterval = viper.GetDuration("eventDispatchInterval")
+	newConfig.EventMaxAttempts = viper.GetInt("eventMaxAttempts")
+	newConfig.EventStreamInterval = viper.GetDuration("eventStreamInterval")
+	newConfig.KafkaBrokers = viper.GetString("kafkaBrokers")
+	newConfig.KafkaTopic = viper.GetString("kafkaTopic")
+	newConfig.PurgeRetentionDays = viper.GetInt("purgeRetentionDays")
+	newConfig.PurgeInterval = viper.GetDuration("purgeInterval")
+	newConfig.IdempotencyKeyTTL = viper.GetDuration("idempotencyKeyTtl")
+	newConfig.WebhookDispatchInterval = viper.GetDuration("webhookDispatchInterval")
+	newConfig.WebhookMaxAttempts = viper.GetInt("webhookMaxAttempts")
+	newConfig.WebhookWorkers = viper.GetInt("webhookWorkers")
+	newConfig.WebhookAllowedNetworks = viper.GetString("webhookAllowedNetworks")
+	newConfig.TracingEndpoint = viper.GetString("tracingEndpoint")
+	newConfig.TracingSampleRatio = viper.GetFloat64("tracingSampleRatio")
 
 	return &newConfig
 }
 
 func bindEnvConfig(command *cobra.Command) error {
-	command.Flags().String("trace-port", "8090", "Trace port")
+	command.Flags().String("trace-port", "8090", "Debug port, serving pprof, expvar and the Prometheus metrics")
 	if err := viper.BindPFlag("tracePort", command.Flags().Lookup("trace-port")); err != nil {
 		return err
 	}
-	if err := viper.BindEnv("tracePort", "XM_TRACE_PORT"); err != nil {
+	// XM_DEBUG_PORT is the name used by .env and compose.yaml.
+	if err := viper.BindEnv("tracePort", "XM_DEBUG_PORT", "XM_TRACE_PORT"); err != nil {
 		return err
 	}
 
-	command.Flags().String("auth-user", "", "Auth user")
+	command.Flags().String("health-port", "8091", "Health port, serving /livez and /readyz (empty disables the probes)")
+	if err := viper.BindPFlag("healthPort", command.Flags().Lookup("health-port")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("healthPort", "XM_HEALTH_PORT"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("health-max-event-lag", 5*time.Minute, "Age of the oldest unpublished event from which the service is not ready")
+	if err := viper.BindPFlag("healthMaxEventLag", command.Flags().Lookup("health-max-event-lag")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("healthMaxEventLag", "XM_HEALTH_MAX_EVENT_LAG"); err != nil {
+		return err
+	}
+
+	command.Flags().Int("health-min-free-disk-mb", 100, "Free space of the SQLite file system, in MB, under which the service is not ready")
+	if err := viper.BindPFlag("healthMinFreeDiskMb", command.Flags().Lookup("health-min-free-disk-mb")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("healthMinFreeDiskMb", "XM_HEALTH_MIN_FREE_DISK_MB"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("shutdown-delay", 5*time.Second, "Time the service reports not ready before closing its servers on shutdown")
+	if err := viper.BindPFlag("shutdownDelay", command.Flags().Lookup("shutdown-delay")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("shutdownDelay", "XM_SHUTDOWN_DELAY"); err != nil {
+		return err
+	}
+
+	command.Flags().String("auth-user", "", "Initial user, created when there are no users")
 	if err := viper.BindPFlag("authUser", command.Flags().Lookup("auth-user")); err != nil {
 		return err
 	}
@@ -40,11 +100,11 @@ func bindEnvConfig(command *cobra.Command) error {
 		return err
 	}
 
-	command.Flags().String("auth-password", "", "Auth password")
+	command.Flags().String("auth-password", "", "Initial user password")
 	if err := viper.BindPFlag("authPassword", command.Flags().Lookup("auth-password")); err != nil {
 		return err
 	}
-	if err := viper.BindEnv("authPassword", "XM_API_AUTH_USER"); err != nil {
+	if err := viper.BindEnv("authPassword", "XM_API_AUTH_PASSWORD"); err != nil {
 		return err
 	}
 
@@ -64,6 +124,14 @@ func bindEnvConfig(command *cobra.Command) error {
 		return err
 	}
 
+	command.Flags().String("grpc-port", "9090", "gRPC port (empty disables the gRPC api)")
+	if err := viper.BindPFlag("grpcPort", command.Flags().Lookup("grpc-port")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("grpcPort", "XM_GRPC_PORT"); err != nil {
+		return err
+	}
+
 	command.Flags().String("db-path", "/tmp/xm.db", "Db path")
 	if err := viper.BindPFlag("dbPath", command.Flags().Lookup("db-path")); err != nil {
 		return err
@@ -72,6 +140,46 @@ func bindEnvConfig(command *cobra.Command) error {
 		return err
 	}
 
+	command.Flags().String("db-driver", "sqlite", "Db driver (sqlite, postgres)")
+	if err := viper.BindPFlag("dbDriver", command.Flags().Lookup("db-driver")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("dbDriver", "XM_DB_DRIVER"); err != nil {
+		return err
+	}
+
+	command.Flags().String("db-dsn", "", "Db DSN (required for postgres, overrides db-path for sqlite)")
+	if err := viper.BindPFlag("dbDsn", command.Flags().Lookup("db-dsn")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("dbDsn", "XM_DB_DSN"); err != nil {
+		return err
+	}
+
+	command.Flags().String("db-log-level", "warn", "Db log level (silent, error, warn: errors and slow queries, info: every query)")
+	if err := viper.BindPFlag("dbLogLevel", command.Flags().Lookup("db-log-level")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("dbLogLevel", "XM_DB_LOG_LEVEL"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("db-slow-query-threshold", 200*time.Millisecond, "Duration from which the queries are logged as slow")
+	if err := viper.BindPFlag("dbSlowQueryThreshold", command.Flags().Lookup("db-slow-query-threshold")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("dbSlowQueryThreshold", "XM_DB_SLOW_QUERY_THRESHOLD"); err != nil {
+		return err
+	}
+
+	command.Flags().Bool("db-log-parameters", false, "Log the values of the queries (they are redacted otherwise)")
+	if err := viper.BindPFlag("dbLogParameters", command.Flags().Lookup("db-log-parameters")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("dbLogParameters", "XM_DB_LOG_PARAMETERS"); err != nil {
+		return err
+	}
+
 	command.Flags().Float64("rate-limit", 1.0, "Rate limit")
 	if err := viper.BindPFlag("rateLimit", command.Flags().Lookup("rate-limit")); err != nil {
 		return err
@@ -88,5 +196,133 @@ func bindEnvConfig(command *cobra.Command) error {
 		return err
 	}
 
+	command.Flags().String("event-publisher", "none", "Event publisher (none, file, kafka)")
+	if err := viper.BindPFlag("eventPublisher", command.Flags().Lookup("event-publisher")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("eventPublisher", "XM_EVENT_PUBLISHER"); err != nil {
+		return err
+	}
+
+	command.Flags().String("event-file-path", "/tmp/xm_events.ndjson", "Event file path")
+	if err := viper.BindPFlag("eventFilePath", command.Flags().Lookup("event-file-path")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("eventFilePath", "XM_EVENT_FILE_PATH"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("event-dispatch-interval", time.Second, "Event dispatch interval")
+	if err := viper.BindPFlag("eventDispatchInterval", command.Flags().Lookup("event-dispatch-interval")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("eventDispatchInterval", "XM_EVENT_DISPATCH_INTERVAL"); err != nil {
+		return err
+	}
+
+	command.Flags().Int("event-max-attempts", 10, "Attempts to publish an event before it is dead")
+	if err := viper.BindPFlag("eventMaxAttempts", command.Flags().Lookup("event-max-attempts")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("eventMaxAttempts", "XM_EVENT_MAX_ATTEMPTS"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("event-stream-interval", time.Second, "Interval between polls of the new events of the event streams")
+	if err := viper.BindPFlag("eventStreamInterval", command.Flags().Lookup("event-stream-interval")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("eventStreamInterval", "XM_EVENT_STREAM_INTERVAL"); err != nil {
+		return err
+	}
+
+	command.Flags().String("kafka-brokers", "localhost:9092", "Kafka brokers (comma separated)")
+	if err := viper.BindPFlag("kafkaBrokers", command.Flags().Lookup("kafka-brokers")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("kafkaBrokers", "XM_KAFKA_BROKERS"); err != nil {
+		return err
+	}
+
+	command.Flags().String("kafka-topic", "xm.company", "Kafka topic")
+	if err := viper.BindPFlag("kafkaTopic", command.Flags().Lookup("kafka-topic")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("kafkaTopic", "XM_KAFKA_TOPIC"); err != nil {
+		return err
+	}
+
+	command.Flags().Int("purge-retention-days", 30, "Days before soft deleted companies are purged (0 disables purging)")
+	if err := viper.BindPFlag("purgeRetentionDays", command.Flags().Lookup("purge-retention-days")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("purgeRetentionDays", "XM_PURGE_RETENTION_DAYS"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("purge-interval", time.Hour, "Interval between purges of soft deleted companies")
+	if err := viper.BindPFlag("purgeInterval", command.Flags().Lookup("purge-interval")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("purgeInterval", "XM_PURGE_INTERVAL"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("idempotency-key-ttl", 24*time.Hour, "Time idempotency keys are remembered")
+	if err := viper.BindPFlag("idempotencyKeyTtl", command.Flags().Lookup("idempotency-key-ttl")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("idempotencyKeyTtl", "XM_IDEMPOTENCY_KEY_TTL"); err != nil {
+		return err
+	}
+
+	command.Flags().Duration("webhook-dispatch-interval", time.Second, "Interval between webhook dispatches")
+	if err := viper.BindPFlag("webhookDispatchInterval", command.Flags().Lookup("webhook-dispatch-interval")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("webhookDispatchInterval", "XM_WEBHOOK_DISPATCH_INTERVAL"); err != nil {
+		return err
+	}
+
+	command.Flags().Int("webhook-max-attempts", 8, "Attempts of a webhook delivery before it is dead")
+	if err := viper.BindPFlag("webhookMaxAttempts", command.Flags().Lookup("webhook-max-attempts")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("webhookMaxAttempts", "XM_WEBHOOK_MAX_ATTEMPTS"); err != nil {
+		return err
+	}
+
+	command.Flags().Int("webhook-workers", 8, "Webhooks delivered to concurrently")
+	if err := viper.BindPFlag("webhookWorkers", command.Flags().Lookup("webhook-workers")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("webhookWorkers", "XM_WEBHOOK_WORKERS"); err != nil {
+		return err
+	}
+
+	command.Flags().String("webhook-allowed-networks", "", "Comma separated CIDRs of the internal addresses the webhooks may target, e.g. 10.1.0.0/16")
+	if err := viper.BindPFlag("webhookAllowedNetworks", command.Flags().Lookup("webhook-allowed-networks")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("webhookAllowedNetworks", "XM_WEBHOOK_ALLOWED_NETWORKS"); err != nil {
+		return err
+	}
+
+	command.Flags().String("tracing-endpoint", "", "OTLP/HTTP endpoint the traces are exported to, e.g. http://otel-collector:4318 (empty disables tracing)")
+	if err := viper.BindPFlag("tracingEndpoint", command.Flags().Lookup("tracing-endpoint")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("tracingEndpoint", "XM_TRACING_ENDPOINT"); err != nil {
+		return err
+	}
+
+	command.Flags().Float64("tracing-sample-ratio", 1, "Ratio of the traces started by this service that are sampled")
+	if err := viper.BindPFlag("tracingSampleRatio", command.Flags().Lookup("tracing-sample-ratio")); err != nil {
+		return err
+	}
+	if err := viper.BindEnv("tracingSampleRatio", "XM_TRACING_SAMPLE_RATIO"); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vcsfrl/xm/internal/event"
+)
+
+// eventsCmd represents the outbox event commands
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Manage the published company events.",
+	Long:  `Manage the outbox of the company events published to the event publisher.`,
+}
+
+var eventsRequeueCmd = &cobra.Command{
+	Use:   "requeue",
+	Short: "Requeue the dead events.",
+	Long:  `Give the events that failed too many times to be published new attempts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := event.NewDispatcher(db, nil, logger, appConfig.EventDispatchInterval, appConfig.EventMaxAttempts).Requeue(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		logger.Info().Int("count", count).Msg("Dead events requeued.")
+		return nil
+	},
+}
+
+func initEventsCmd() {
+	eventsCmd.AddCommand(eventsRequeueCmd)
+}
@@ -1,159 +1,84 @@
 package example
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/client"
 	"github.com/vcsfrl/xm/internal/config"
-	"github.com/vcsfrl/xm/internal/dto"
-	"github.com/vcsfrl/xm/internal/model"
-	"io"
-	"net/http"
 )
 
 func Run(config *config.Config, logger zerolog.Logger) {
-	authResp, err := authenticate(dto.LoginRequest{
-		Username: config.AuthUser,
-		Password: config.AuthPassword,
-	}, config)
+	ctx := context.Background()
+	xm := client.New(baseUrl(config))
 
+	_, err := xm.Login(ctx, config.AuthUser, config.AuthPassword)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to authenticate")
 		return
 	}
 
 	logger.Info().Msg("Authentication successful")
-	logger.Info().Msgf("Token: %s", authResp.Token)
 
 	// CREATE COMPANY
 	//////////////////////////////////////////////////////////////////////////////////
-	company := testCompany()
-	companyJsonValue, err := json.Marshal(company)
+	company, err := xm.CreateCompany(ctx, testCompany())
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to marshal company")
+		logger.Error().Err(err).Msg("Failed to create company")
 		return
 	}
 
-	req, err := http.NewRequest("POST", baseUrl(config)+"/api/v1/company", bytes.NewBuffer(companyJsonValue))
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create request")
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authResp.Token))
-
-	body, err := doRequest(req)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to do request")
-		return
-	}
-
-	logger.Info().Msgf("Created Company: %s", string(body))
+	logger.Info().Msgf("Created Company: %+v", *company)
 
 	// UPDATE COMPANY
 	//////////////////////////////////////////////////////////////////////////////////
-	var responseCompany model.Company
-	err = json.Unmarshal(body, &responseCompany)
+	description := company.Description + " - updated"
+	company, err = xm.UpdateCompany(ctx, company.ID, client.CompanyUpdate{Description: &description, IfMatch: company.ETag})
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to unmarshal company")
+		logger.Error().Err(err).Msg("Failed to update company")
 		return
 	}
 
-	responseCompany.Description = responseCompany.Description + " - updated"
+	logger.Info().Msgf("Updated Company: %+v", *company)
 
-	jsonValue, _ := json.Marshal(responseCompany)
-	req, _ = http.NewRequest("PATCH", baseUrl(config)+"/api/v1/company/"+responseCompany.ID.String(), bytes.NewBuffer(jsonValue))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authResp.Token))
-	body, err = doRequest(req)
+	// GET COMPANY
+	//////////////////////////////////////////////////////////////////////////////////
+	company, err = xm.GetCompany(ctx, company.ID)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to do request")
+		logger.Error().Err(err).Msg("Failed to get company")
 		return
 	}
 
-	logger.Info().Msgf("Updated Company: %s", string(body))
+	logger.Info().Msgf("GET Company: %+v", *company)
 
-	// GET COMPANY
+	// LIST COMPANIES
 	//////////////////////////////////////////////////////////////////////////////////
-
-	req, _ = http.NewRequest("GET", baseUrl(config)+"/api/v1/company/"+responseCompany.ID.String(), nil)
-	req.Header.Set("Content-Type", "application/json")
-
-	body, err = doRequest(req)
+	page, err := xm.ListCompanies(ctx, client.CompanyListOptions{NamePrefix: "TestCompany", Limit: 5})
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to do request")
+		logger.Error().Err(err).Msg("Failed to list companies")
 		return
 	}
 
-	logger.Info().Msgf("GET Company: %s", string(body))
+	logger.Info().Msgf("Listed %d Companies, next cursor: %q", len(page.Items), page.NextCursor)
 
 	// DELETE COMPANY
 	//////////////////////////////////////////////////////////////////////////////////
-	req, _ = http.NewRequest("DELETE", baseUrl(config)+"/api/v1/company/"+responseCompany.ID.String(), nil)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authResp.Token))
-
-	body, err = doRequest(req)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to do request")
+	if err := xm.DeleteCompany(ctx, company.ID); err != nil {
+		logger.Error().Err(err).Msg("Failed to delete company")
 		return
 	}
 
-	logger.Info().Msgf("Delete Response: %s", string(body))
-
-}
-
-func doRequest(req *http.Request) ([]byte, error) {
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.Body != nil {
-		defer func() {
-			_ = resp.Body.Close()
-		}()
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	return body, nil
-}
-
-func authenticate(login dto.LoginRequest, config *config.Config) (*dto.LoginResponse, error) {
-	jsonValue, err := json.Marshal(login)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", baseUrl(config)+"/api/v1/login", bytes.NewBuffer(jsonValue))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	body, err := doRequest(req)
-	if err != nil {
-		return nil, err
-	}
-
-	var loginResponse dto.LoginResponse
-	err = json.Unmarshal(body, &loginResponse)
-
-	return &loginResponse, err
+	logger.Info().Msg("Deleted Company")
 }
 
-func testCompany() model.Company {
-	return model.Company{
+func testCompany() client.Company {
+	return client.Company{
 		Name:              "TestCompany - " + uuid.New().String(),
 		Description:       "A test company",
 		AmountOfEmployees: 10,
 		Registered:        true,
-		Type:              model.CompanyTypeCorporation,
+		Type:              client.CompanyTypeCorporation,
 	}
 }
 
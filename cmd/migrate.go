@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vcsfrl/xm/internal/migration"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var migrateUpSteps int
+var migrateDownSteps int
+var migrateDir string
+
+// migrateCmd represents the schema migration commands
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema migrations.",
+	Long:  `Apply, roll back, inspect and create versioned schema migrations.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrator, err := migration.NewMigrator(db, logger)
+		if err != nil {
+			return err
+		}
+
+		count, err := migrator.Up(migrateUpSteps)
+		logger.Info().Int("count", count).Msg("Migrations applied.")
+
+		return err
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back applied migrations.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrator, err := migration.NewMigrator(db, logger)
+		if err != nil {
+			return err
+		}
+
+		count, err := migrator.Down(migrateDownSteps)
+		logger.Info().Int("count", count).Msg("Migrations rolled back.")
+
+		return err
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of every migration.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrator, err := migration.NewMigrator(db, logger)
+		if err != nil {
+			return err
+		}
+
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(writer, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+
+		return writer.Flush()
+	},
+}
+
+var migrateCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create empty up and down scripts for a new migration.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := migration.Create(migrateDir, args[0])
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			logger.Info().Str("path", path).Msg("Migration created.")
+		}
+
+		return nil
+	},
+}
+
+func initMigrateCmd() {
+	migrateUpCmd.Flags().IntVar(&migrateUpSteps, "steps", 0, "Number of migrations to apply (0 applies all)")
+	migrateDownCmd.Flags().IntVar(&migrateDownSteps, "steps", 1, "Number of migrations to roll back")
+	migrateCreateCmd.Flags().StringVar(&migrateDir, "dir", "internal/migration/sql", "Migrations source directory")
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateCreateCmd)
+}
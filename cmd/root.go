@@ -4,6 +4,7 @@ import (
 	"github.com/vcsfrl/xm/cmd/example"
 	"github.com/vcsfrl/xm/internal/config"
 	dbFactory "github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/service"
 	"gorm.io/gorm"
 	"os"
 	"time"
@@ -45,8 +46,8 @@ var exampleCmd = &cobra.Command{
 }
 
 func init() {
-	// Init logger.
-	loggerOutput = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	// Init logger. It writes to stderr, stdout is left to the output of the commands, e.g. exports.
+	loggerOutput = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
 	logger = zerolog.New(loggerOutput).With().Timestamp().Logger()
 	logger.Info().Msg("Logger initialised.")
 
@@ -61,12 +62,28 @@ func init() {
 	rootCmd.AddCommand(apiCmd)
 	rootCmd.AddCommand(exampleCmd)
 
+	initMigrateCmd()
+	rootCmd.AddCommand(migrateCmd)
+
+	initUserCmd()
+	rootCmd.AddCommand(userCmd)
+
+	initCompanyCmd()
+	rootCmd.AddCommand(companyCmd)
+
+	initEventsCmd()
+	rootCmd.AddCommand(eventsCmd)
+
 	// Init config.
 	appConfig = buildConfig(logger)
 
 	// Init database.
-	var err error
-	db, err = dbFactory.InitSqlite(appConfig)
+	dbLogger, err := dbFactory.NewLogger(logger, appConfig, service.RequestIDFromContext)
+	if err != nil {
+		logger.Error().Err(err).Msg("Init db logger.")
+		os.Exit(1)
+	}
+	db, err = dbFactory.Init(appConfig, dbLogger)
 	if err != nil {
 		logger.Error().Err(err).Msg("Init db.")
 		os.Exit(1)
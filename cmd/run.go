@@ -2,15 +2,29 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/vcsfrl/xm/internal/api"
 	"github.com/vcsfrl/xm/internal/api/handler"
 	"github.com/vcsfrl/xm/internal/config"
+	dbFactory "github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/grpcapi"
+	"github.com/vcsfrl/xm/internal/health"
+	"github.com/vcsfrl/xm/internal/metrics"
+	"github.com/vcsfrl/xm/internal/migration"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/tracing"
+	"github.com/vcsfrl/xm/internal/validator"
+	"github.com/vcsfrl/xm/internal/webhook"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 )
 
 // Run application.
@@ -19,6 +33,90 @@ func run() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	migrator, err := migration.NewMigrator(db, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("Init migrator.")
+		os.Exit(1)
+	}
+	if err := migrator.Check(); err != nil {
+		logger.Error().Err(err).Msg("Check database schema.")
+		os.Exit(1)
+	}
+
+	if err := metrics.RegisterDB(db, appConfig.DbDriver); err != nil {
+		logger.Error().Err(err).Msg("Register db metrics.")
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, appConfig)
+	if err != nil {
+		logger.Error().Err(err).Msg("Init tracing.")
+		os.Exit(1)
+	}
+	if err := tracing.RegisterDB(db); err != nil {
+		logger.Error().Err(err).Msg("Register db tracing.")
+		os.Exit(1)
+	}
+
+	created, err := service.NewUserService(repository.NewUserRepository(db)).Bootstrap(appConfig.AuthUser, appConfig.AuthPassword)
+	switch {
+	case errors.Is(err, service.ErrInvalidUser):
+		logger.Error().Err(err).Str("username", appConfig.AuthUser).
+			Msgf("Initial user not created, XM_API_AUTH_PASSWORD must have at least %d characters.", service.MinPasswordLength)
+		os.Exit(1)
+	case err != nil:
+		logger.Error().Err(err).Msg("Bootstrap initial user.")
+		os.Exit(1)
+	}
+	if created {
+		logger.Info().Str("username", appConfig.AuthUser).Msg("Initial user created.")
+	}
+
+	publisher, err := event.NewPublisher(appConfig)
+	if err != nil {
+		logger.Error().Err(err).Msg("Init event publisher.")
+		os.Exit(1)
+	}
+	checks := health.New(logger, health.DefaultTimeout)
+	checks.Add("db", health.Ping(db))
+	checks.Add("migrations", health.Migrations(migrator))
+	if (appConfig.DbDriver == dbFactory.DriverSqlite || appConfig.DbDriver == "") && appConfig.DbDsn == "" {
+		checks.Add("disk", health.DiskSpace(filepath.Dir(appConfig.DbPath), uint64(appConfig.HealthMinFreeDiskMb)<<20))
+	}
+
+	// The dispatcher numbers the events of the change feed and of the webhooks even when they are not published.
+	dispatcher := event.NewDispatcher(db, publisher, logger, appConfig.EventDispatchInterval, appConfig.EventMaxAttempts)
+	go dispatcher.Run(ctx)
+	if publisher != nil {
+		// A replica out of the load balancer would not publish the events faster.
+		checks.AddWarning("events", health.EventLag(dispatcher, appConfig.HealthMaxEventLag))
+	}
+
+	companyRepository, err := repository.NewCompanyRepository(db)
+	if err != nil {
+		logger.Error().Err(err).Msg("Init company repository.")
+		os.Exit(1)
+	}
+	companyService := service.NewCompanyService(companyRepository, validator.CompanyValidator(logger))
+
+	if appConfig.PurgeRetentionDays > 0 {
+		retention := time.Duration(appConfig.PurgeRetentionDays) * 24 * time.Hour
+		go service.NewRetentionJob(companyService, logger, retention, appConfig.PurgeInterval).Run(ctx)
+	}
+
+	idempotencyService := service.NewIdempotencyService(repository.NewIdempotencyRepository(db), appConfig.IdempotencyKeyTTL)
+	go idempotencyService.Run(ctx, logger, appConfig.PurgeInterval)
+
+	webhookService := service.NewWebhookService(repository.NewWebhookRepository(db), companyService)
+	allowedNetworks, err := webhook.ParseNetworks(appConfig.WebhookAllowedNetworks)
+	if err != nil {
+		logger.Error().Err(err).Msg("Init webhook dispatcher.")
+		os.Exit(1)
+	}
+	webhookDispatcher := webhook.NewDispatcher(webhookService, companyService, logger, appConfig.WebhookDispatchInterval,
+		appConfig.WebhookMaxAttempts, appConfig.WebhookWorkers, allowedNetworks)
+	go webhookDispatcher.Run(ctx)
+
 	restApi := api.NewRestApi(ctx, logger, appConfig, db)
 	// run api
 	go func() {
@@ -26,12 +124,55 @@ func run() {
 		stop()
 	}()
 
+	var grpcApi *grpcapi.GrpcApi
+	if appConfig.GrpcPort != "" {
+		grpcApi = grpcapi.NewGrpcApi(ctx, logger, appConfig, db)
+		// run grpc api
+		go func() {
+			grpcApi.Run()
+			stop()
+		}()
+	}
+
+	healthServer := runHealth(appConfig, logger, checks)
+
 	// Shut down app.
 	shutdown := func() {
+		// Not ready anymore, until the load balancers stop routing requests to the apis, then the apis
+		// drain their requests.
+		checks.Shutdown(appConfig.ShutdownDelay)
+
 		if err := restApi.Close(); err != nil {
 			logger.Error().Err(err).Msg("Close api.")
 		}
 
+		if grpcApi != nil {
+			if err := grpcApi.Close(); err != nil {
+				logger.Error().Err(err).Msg("Close grpc api.")
+			}
+		}
+
+		if publisher != nil {
+			logger.Info().Msg("Close event publisher.")
+			if err := publisher.Close(); err != nil {
+				logger.Error().Err(err).Msg("Close event publisher.")
+			}
+		}
+
+		logger.Info().Msg("Flush traces.")
+		tracingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := shutdownTracing(tracingCtx); err != nil {
+			logger.Error().Err(err).Msg("Flush traces.")
+		}
+		cancel()
+
+		if healthServer != nil {
+			logger.Info().Msg("Close health endpoint.")
+			if err := healthServer.Close(); err != nil {
+				logger.Error().Err(err).Msg("Close health endpoint.")
+			}
+		}
+
 		logger.Info().Msg("Close db.")
 		dbInstance, err := db.DB()
 		if err != nil {
@@ -71,6 +212,7 @@ func run() {
 //
 // /debug/pprof
 // /debug/vars
+// /metrics
 //
 // Not concerned with shutting this down when the application is shutdown.
 func runDebug(cfg *config.Config, logger zerolog.Logger) {
@@ -84,3 +226,25 @@ func runDebug(cfg *config.Config, logger zerolog.Logger) {
 		}
 	}()
 }
+
+// Start the health endpoints, /livez and /readyz, unless the health port is empty.
+func runHealth(cfg *config.Config, logger zerolog.Logger, checks *health.Health) *http.Server {
+	if cfg.HealthPort == "" {
+		return nil
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf("0.0.0.0:%s", cfg.HealthPort),
+		Handler:           checks.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Info().Str("port", server.Addr).Msg("Health endpoint started.")
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("Health endpoint start.")
+		}
+	}()
+
+	return server
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var userPassword string
+var userRole string
+
+// userCmd represents the user account commands
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage API users.",
+	Long:  `Add, remove and list API users and change their passwords and roles.`,
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add USERNAME",
+	Short: "Add a user.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+
+		user, err := userService().Add(args[0], password, model.Role(userRole))
+		if err != nil {
+			return err
+		}
+
+		logger.Info().Str("username", user.Username).Uint("id", user.ID).Str("role", string(user.Role)).Msg("User added.")
+		return nil
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove USERNAME",
+	Short: "Remove a user.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := userService().Remove(args[0]); err != nil {
+			return err
+		}
+
+		logger.Info().Str("username", args[0]).Msg("User removed.")
+		return nil
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd USERNAME",
+	Short: "Change the password of a user.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+
+		if err := userService().ChangePassword(args[0], password); err != nil {
+			return err
+		}
+
+		logger.Info().Str("username", args[0]).Msg("Password changed.")
+		return nil
+	},
+}
+
+var userRoleCmd = &cobra.Command{
+	Use:   "role USERNAME ROLE",
+	Short: "Change the role of a user (viewer, editor, admin).",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := userService().SetRole(args[0], model.Role(args[1])); err != nil {
+			return err
+		}
+
+		logger.Info().Str("username", args[0]).Str("role", args[1]).Msg("Role changed.")
+		return nil
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		users, err := userService().List()
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "ID\tUSERNAME\tROLE\tCREATED AT")
+		for _, user := range users {
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", user.ID, user.Username, user.Role, user.CreatedAt.Format(time.RFC3339))
+		}
+
+		return writer.Flush()
+	},
+}
+
+func initUserCmd() {
+	for _, command := range []*cobra.Command{userAddCmd, userPasswdCmd} {
+		command.Flags().StringVar(&userPassword, "password", "", "Password (read from stdin when empty)")
+	}
+
+	userAddCmd.Flags().StringVar(&userRole, "role", string(model.RoleViewer), "Role (viewer, editor, admin)")
+
+	userCmd.AddCommand(userAddCmd, userRemoveCmd, userPasswdCmd, userRoleCmd, userListCmd)
+}
+
+func userService() *service.User {
+	return service.NewUserService(repository.NewUserRepository(db))
+}
+
+// readPassword returns the --password flag, the password typed without echo on a terminal
+// or the first line of stdin.
+func readPassword() (string, error) {
+	if userPassword != "" {
+		return userPassword, nil
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "Password: ")
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(os.Stderr)
+		if err != nil || len(password) == 0 {
+			return "", errors.New("password is required")
+		}
+
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("password is required")
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
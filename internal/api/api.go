@@ -7,7 +7,11 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/vcsfrl/xm/internal/api/handler"
 	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/api/openapi"
+	"github.com/vcsfrl/xm/internal/api/problem"
 	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
 	"github.com/vcsfrl/xm/internal/service"
 	"github.com/vcsfrl/xm/internal/validator"
 	"gorm.io/gorm"
@@ -50,29 +54,73 @@ func (c *RestApi) Run() {
 }
 
 func (c *RestApi) BuildRouter() (*gin.Engine, error) {
-	companyService := service.NewCompanyService(c.db, validator.CompanyValidator(c.logger))
+	companyRepository, err := repository.NewCompanyRepository(c.db)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("Failed to create company repository")
+		return nil, err
+	}
+
+	companyService := service.NewCompanyService(companyRepository, validator.CompanyValidator(c.logger))
 	companyHandler := handler.NewCompanyHandler(companyService)
+	eventsHandler := handler.NewCompanyEventsHandler(c.ctx, companyService, c.config.EventStreamInterval)
 
-	authManager, err := middleware.NewAuthenticationManager(c.config, c.logger)
+	webhookHandler := handler.NewWebhookHandler(service.NewWebhookService(repository.NewWebhookRepository(c.db), companyService))
+
+	idempotencyService := service.NewIdempotencyService(repository.NewIdempotencyRepository(c.db), c.config.IdempotencyKeyTTL)
+
+	userService := service.NewUserService(repository.NewUserRepository(c.db))
+	authManager, err := middleware.NewAuthenticationManager(c.config, c.logger, userService)
 	if err != nil {
 		c.logger.Error().Err(err).Msg("Failed to create auth manager")
 		return nil, err
 	}
 
-	ginRouter := gin.Default()
+	ginRouter := gin.New()
+	ginRouter.Use(middleware.Tracing()...)
+	ginRouter.Use(middleware.Metrics())
+	ginRouter.Use(middleware.Logger(c.logger))
+	ginRouter.Use(middleware.Problems(c.logger))
+	ginRouter.Use(middleware.Recovery(c.logger))
+	// The probes are not rate limited, a rejected probe gets the container restarted.
+	ginRouter.GET("/api/v1/health", func(c *gin.Context) { c.Status(http.StatusNoContent) })
 	ginRouter.Use(middleware.RateLimiter(c.config))
 	ginRouter.Use(authManager.JwtHandler())
+	ginRouter.NoRoute(func(c *gin.Context) {
+		_ = c.Error(problem.New(http.StatusNotFound, problem.CodeNotFound, "Route not found."))
+	})
 	apiRouter := ginRouter.Group("/api/v1")
 	apiRouter.POST("/login", authManager.AuthMiddleware.LoginHandler)
-	apiRouter.GET("/health", func(c *gin.Context) { c.Status(http.StatusNoContent) })
-	apiRouter.GET("/company/:id", companyHandler.Get)
+	apiRouter.GET("/openapi.json", openapi.Spec)
+	apiRouter.GET("/docs", openapi.Docs)
+	apiRouter.GET("/docs/redoc.standalone.js", openapi.Redoc)
+
+	// Soft deleted companies are only visible with the read_deleted permission.
+	readDeleted := authManager.RequirePermissionIf(handler.IncludesDeleted, model.PermissionCompanyReadDeleted)
+	apiRouter.GET("/company", append(readDeleted, companyHandler.List)...)
+	apiRouter.GET("/company/search", companyHandler.Search)
+	apiRouter.GET("/company/export", append(readDeleted, companyHandler.Export)...)
+	apiRouter.GET("/company/:id", append(readDeleted, companyHandler.Get)...)
 
 	// register middleware
 	authorized := apiRouter.Group("/", authManager.AuthMiddleware.MiddlewareFunc())
 	{
-		authorized.POST("/company", companyHandler.Create)
-		authorized.PATCH("/company/:id", companyHandler.Update)
-		authorized.DELETE("/company/:id", companyHandler.Delete)
+		authorized.POST("/company", authManager.RequirePermission(model.PermissionCompanyCreate), middleware.Idempotency(idempotencyService, c.logger), companyHandler.Create)
+		// gin cannot route a literal colon, custom methods such as /company:batch are dispatched by Action.
+		authorized.POST("/company:action", middleware.Idempotency(idempotencyService, c.logger), companyHandler.Action)
+		authorized.POST("/company/import", authManager.RequirePermission(model.PermissionCompanyCreate), companyHandler.Import)
+		authorized.PATCH("/company/:id", authManager.RequirePermission(model.PermissionCompanyUpdate), companyHandler.Update)
+		authorized.DELETE("/company/:id", authManager.RequirePermission(model.PermissionCompanyDelete), companyHandler.Delete)
+		authorized.POST("/company/:id/restore", authManager.RequirePermission(model.PermissionCompanyRestore), companyHandler.Restore)
+		authorized.GET("/company/events", authManager.RequirePermission(model.PermissionCompanyRead), eventsHandler.Stream)
+		authorized.GET("/company/:id/history", authManager.RequirePermission(model.PermissionCompanyRead), companyHandler.History)
+
+		webhooks := authorized.Group("/webhooks", authManager.RequirePermission(model.PermissionWebhookManage))
+		webhooks.POST("", webhookHandler.Create)
+		webhooks.GET("", webhookHandler.List)
+		webhooks.GET("/:id", webhookHandler.Get)
+		webhooks.DELETE("/:id", webhookHandler.Delete)
+		webhooks.GET("/:id/deliveries", webhookHandler.Deliveries)
+		webhooks.POST("/:id/deliveries/:delivery_id/redeliver", webhookHandler.Redeliver)
 
 		authorized.POST("/refresh_token", authManager.AuthMiddleware.RefreshHandler)
 	}
@@ -5,17 +5,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/api/handler"
+	"github.com/vcsfrl/xm/internal/api/problem"
 	"github.com/vcsfrl/xm/internal/config"
 	db2 "github.com/vcsfrl/xm/internal/db"
 	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/metrics"
 	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
 	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/tracing"
 	"github.com/vcsfrl/xm/internal/validator"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRestAPiSuite(t *testing.T) {
@@ -26,6 +41,7 @@ type RestApiTestSuite struct {
 	suite.Suite
 	logger         zerolog.Logger
 	companyService *service.Company
+	userService    *service.User
 	ctx            context.Context
 	companyApi     *RestApi
 	config         *config.Config
@@ -39,10 +55,13 @@ func (suite *RestApiTestSuite) SetupTest() {
 
 	suite.ctx = context.Background()
 	suite.config = &config.Config{
-		AppPort: "1234", AuthJwtSecret: "secret", AuthUser: "admin", AuthPassword: "admin",
+		AppPort: "1234", AuthJwtSecret: "secret", AuthUser: "admin", AuthPassword: "admin-password",
 		RateLimit: 1000, RateBurst: 100}
 	suite.companyApi = NewRestApi(suite.ctx, suite.logger, suite.config, db)
-	suite.companyService = service.NewCompanyService(db, validator.CompanyValidator(suite.logger))
+	suite.companyService = service.NewCompanyService(repository.NewSqliteCompanyRepository(db), validator.CompanyValidator(suite.logger))
+	suite.userService = service.NewUserService(repository.NewUserRepository(db))
+	_, err = suite.userService.Add(suite.config.AuthUser, suite.config.AuthPassword, model.RoleAdmin)
+	suite.NoError(err)
 }
 
 func (suite *RestApiTestSuite) TearDownTest() {
@@ -58,6 +77,106 @@ func (suite *RestApiTestSuite) TestApi_Login() {
 	suite.NotEmpty(loginResponse.Token)
 }
 
+func (suite *RestApiTestSuite) TestApi_Login_InvalidCredentials() {
+	for _, login := range []dto.LoginRequest{
+		{Username: suite.config.AuthUser, Password: "wrong-password"},
+		{Username: "unknown", Password: suite.config.AuthPassword},
+	} {
+		jsonValue, err := json.Marshal(login)
+		suite.NoError(err)
+		req, err := http.NewRequest("POST", "/api/v1/login", bytes.NewBuffer(jsonValue))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router, err := suite.companyApi.BuildRouter()
+		suite.NoError(err)
+		router.ServeHTTP(w, req)
+
+		suite.Equal(http.StatusUnauthorized, w.Code)
+		suite.Equal(problem.ContentType, w.Header().Get("Content-Type"))
+		suite.Contains(w.Body.String(), `"code":"unauthorized"`)
+	}
+}
+
+func (suite *RestApiTestSuite) TestApi_RemovedUser() {
+	_, err := suite.userService.Add("engineer", "engineer-password", model.RoleEditor)
+	suite.NoError(err)
+	loginResponse := suite.authenticate(dto.LoginRequest{Username: "engineer", Password: "engineer-password"})
+
+	suite.NoError(suite.userService.Remove("engineer"))
+
+	req, err := http.NewRequest("POST", "/api/v1/refresh_token", nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+
+	w := httptest.NewRecorder()
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	router.ServeHTTP(w, req)
+
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *RestApiTestSuite) TestApi_Permissions() {
+	company := suite.testCompany()
+	err := suite.companyService.Create(context.Background(), &company)
+	suite.NoError(err)
+
+	_, err = suite.userService.Add("viewer", "viewer-password", model.RoleViewer)
+	suite.NoError(err)
+	_, err = suite.userService.Add("editor", "editor-password", model.RoleEditor)
+	suite.NoError(err)
+	viewer := suite.authenticate(dto.LoginRequest{Username: "viewer", Password: "viewer-password"})
+	editor := suite.authenticate(dto.LoginRequest{Username: "editor", Password: "editor-password"})
+
+	newCompany := suite.testCompany()
+	newCompany.Name = "EditorCompany"
+	companyJson, err := json.Marshal(newCompany)
+	suite.NoError(err)
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		body   []byte
+		code   int
+	}{
+		{viewer.Token, "POST", "/api/v1/company", companyJson, http.StatusForbidden},
+		{viewer.Token, "PATCH", "/api/v1/company/" + company.ID.String(), []byte(`{"Description":"viewer"}`), http.StatusForbidden},
+		{viewer.Token, "DELETE", "/api/v1/company/" + company.ID.String(), nil, http.StatusForbidden},
+		{editor.Token, "POST", "/api/v1/company", companyJson, http.StatusOK},
+		{editor.Token, "PATCH", "/api/v1/company/" + company.ID.String(), []byte(`{"Description":"editor"}`), http.StatusOK},
+		{editor.Token, "DELETE", "/api/v1/company/" + company.ID.String(), nil, http.StatusForbidden},
+		{"", "DELETE", "/api/v1/company/" + company.ID.String(), nil, http.StatusUnauthorized},
+	}
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBuffer(test.body))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		if test.token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", test.token))
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		suite.Equal(test.code, w.Code, "%s %s", test.method, test.path)
+	}
+
+	// A role change invalidates the tokens issued for the previous role.
+	suite.NoError(suite.userService.SetRole("editor", model.RoleAdmin))
+	req, err := http.NewRequest("DELETE", "/api/v1/company/"+company.ID.String(), nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", editor.Token))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
 func (suite *RestApiTestSuite) TestCreateCompany_Unauthorized() {
 	jsonValue, err := json.Marshal(suite.testCompany())
 	suite.NoError(err)
@@ -103,9 +222,53 @@ func (suite *RestApiTestSuite) TestCreateCompany_Authorized() {
 	suite.Equal(company.Name, responseCompany.Name)
 }
 
+func (suite *RestApiTestSuite) TestCreateCompany_Idempotency() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	create := func(key string, company model.Company) *httptest.ResponseRecorder {
+		jsonValue, err := json.Marshal(company)
+		suite.NoError(err)
+		req, _ := http.NewRequest("POST", "/api/v1/company", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	first := create("key-1", suite.testCompany())
+	suite.Equal(http.StatusOK, first.Code)
+	suite.Empty(first.Header().Get("Idempotent-Replayed"))
+
+	retry := create("key-1", suite.testCompany())
+	suite.Equal(http.StatusOK, retry.Code)
+	suite.Equal("true", retry.Header().Get("Idempotent-Replayed"))
+	suite.Equal(first.Body.String(), retry.Body.String())
+	suite.Equal(first.Header().Get("ETag"), retry.Header().Get("ETag"))
+
+	other := suite.testCompany()
+	other.Name = "OtherCompany"
+	reused := create("key-1", other)
+	suite.Equal(http.StatusUnprocessableEntity, reused.Code)
+	suite.Contains(reused.Body.String(), problem.CodeIdempotencyReused)
+
+	// Failed requests are not remembered.
+	duplicate := create("key-2", suite.testCompany())
+	suite.Equal(http.StatusConflict, duplicate.Code)
+	suite.Equal(http.StatusOK, create("key-2", other).Code)
+
+	result, err := suite.companyService.List(context.Background(), service.CompanyListQuery{})
+	suite.NoError(err)
+	suite.Len(result.Items, 2)
+}
+
 func (suite *RestApiTestSuite) TestGetCompany() {
 	company := suite.testCompany()
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	req, _ := http.NewRequest("GET", "/api/v1/company/"+company.ID.String(), nil)
@@ -130,7 +293,7 @@ func (suite *RestApiTestSuite) TestGetCompany() {
 
 func (suite *RestApiTestSuite) TestUpdateCompany_Unauthorized() {
 	company := suite.testCompany()
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	updatedCompany := model.Company{
@@ -155,7 +318,7 @@ func (suite *RestApiTestSuite) TestUpdateCompany_Unauthorized() {
 func (suite *RestApiTestSuite) TestUpdateCompany_Authorized() {
 	loginResponse := suite.authenticate(suite.loginRequest())
 	company := suite.testCompany()
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	updatedCompany := model.Company{
@@ -188,10 +351,64 @@ func (suite *RestApiTestSuite) TestUpdateCompany_Authorized() {
 	suite.Equal(updatedCompany.Type, responseCompany.Type)
 }
 
+func (suite *RestApiTestSuite) TestCompany_DeletedAtReadOnly() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	send := func(method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+	deleted := func(id uuid.UUID) bool {
+		company, err := suite.companyService.GetIncludingDeleted(context.Background(), id)
+		suite.Require().NoError(err)
+
+		return company.DeletedAt.Valid
+	}
+
+	w := send("POST", "/api/v1/company", "application/json",
+		`{"Name":"Created","AmountOfEmployees":10,"Type":"Corporations","DeletedAt":"2000-01-01T00:00:00Z"}`)
+	suite.Equal(http.StatusOK, w.Code)
+	var created dto.Company
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	suite.Nil(created.DeletedAt)
+	suite.False(deleted(created.ID))
+
+	w = send("POST", "/api/v1/company:batch", "application/json",
+		`{"operations":[{"op":"create","company":{"Name":"Batched","AmountOfEmployees":10,"Type":"Corporations","DeletedAt":"2000-01-01T00:00:00Z"}}]}`)
+	suite.Equal(http.StatusOK, w.Code)
+	var batch handler.CompanyBatchResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &batch))
+	suite.Require().Len(batch.Results, 1)
+	suite.False(deleted(batch.Results[0].Company.ID))
+
+	w = send("PATCH", "/api/v1/company/"+created.ID.String(), "application/json", `{"DeletedAt":"2000-01-01T00:00:00Z"}`)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.False(deleted(created.ID))
+
+	w = send("PATCH", "/api/v1/company/"+created.ID.String(), handler.ContentTypeMergePatch, `{"DeletedAt":"2000-01-01T00:00:00Z"}`)
+	suite.Equal(http.StatusUnprocessableEntity, w.Code)
+	suite.False(deleted(created.ID))
+
+	// The deletion is only read.
+	suite.NoError(suite.companyService.Delete(context.Background(), created.ID, 0))
+	w = send("GET", "/api/v1/company/"+created.ID.String()+"?include_deleted=true", "", "")
+	suite.Equal(http.StatusOK, w.Code)
+	var read dto.Company
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &read))
+	suite.NotNil(read.DeletedAt)
+}
+
 func (suite *RestApiTestSuite) TestDeleteCompany_Authorized() {
 	loginResponse := suite.authenticate(suite.loginRequest())
 	company := suite.testCompany()
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	req, _ := http.NewRequest("DELETE", "/api/v1/company/"+company.ID.String(), nil)
@@ -210,9 +427,605 @@ func (suite *RestApiTestSuite) TestDeleteCompany_Authorized() {
 	suite.Equal("Company deleted", response["message"])
 }
 
+func (suite *RestApiTestSuite) TestRestoreCompany() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	company := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+	suite.NoError(suite.companyService.Delete(context.Background(), company.ID, 0))
+
+	_, err := suite.userService.Add("editor", "editor-password", model.RoleEditor)
+	suite.NoError(err)
+	editor := suite.authenticate(dto.LoginRequest{Username: "editor", Password: "editor-password"})
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		code   int
+	}{
+		{"", "GET", "/api/v1/company/" + company.ID.String() + "?include_deleted=true", http.StatusUnauthorized},
+		{editor.Token, "GET", "/api/v1/company/" + company.ID.String() + "?include_deleted=true", http.StatusForbidden},
+		{loginResponse.Token, "GET", "/api/v1/company/" + company.ID.String() + "?include_deleted=true", http.StatusOK},
+		{"", "GET", "/api/v1/company?include_deleted=1", http.StatusUnauthorized},
+		{loginResponse.Token, "GET", "/api/v1/company?include_deleted=maybe", http.StatusBadRequest},
+		{editor.Token, "POST", "/api/v1/company/" + company.ID.String() + "/restore", http.StatusForbidden},
+		{loginResponse.Token, "POST", "/api/v1/company/" + company.ID.String() + "/restore", http.StatusOK},
+		{"", "GET", "/api/v1/company/" + company.ID.String(), http.StatusOK},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		suite.NoError(err)
+		if test.token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", test.token))
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		suite.Equal(test.code, w.Code, "%s %s", test.method, test.path)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/company?include_deleted=true", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+
+	var response dto.CompanyListResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Len(response.Items, 1)
+	suite.Nil(response.Items[0].DeletedAt)
+}
+
+func (suite *RestApiTestSuite) TestBatchCompany() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	company := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+
+	_, err := suite.userService.Add("editor", "editor-password", model.RoleEditor)
+	suite.NoError(err)
+	editor := suite.authenticate(dto.LoginRequest{Username: "editor", Password: "editor-password"})
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	batch := func(token string, path string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	operations := `[
+		{"op":"create","company":{"Name":"BatchCompany","AmountOfEmployees":5,"Type":"Corporations"}},
+		{"op":"update","id":"` + company.ID.String() + `","company":{"Description":"Batched"}},
+		{"op":"create","company":{"Name":"TestCompany","AmountOfEmployees":5,"Type":"Corporations"}}
+	]`
+
+	suite.Equal(http.StatusUnauthorized, batch("", "/api/v1/company:batch", `{"operations":`+operations+`}`).Code)
+	suite.Equal(http.StatusNotFound, batch(loginResponse.Token, "/api/v1/company:merge", `{"operations":`+operations+`}`).Code)
+	suite.Equal(http.StatusBadRequest, batch(loginResponse.Token, "/api/v1/company:batch", `{"operations":[]}`).Code)
+	suite.Equal(http.StatusForbidden, batch(editor.Token, "/api/v1/company:batch", `{"operations":[{"op":"delete","id":"`+company.ID.String()+`"}]}`).Code)
+
+	// Atomic: the duplicate name fails the whole batch.
+	w := batch(loginResponse.Token, "/api/v1/company:batch", `{"atomic":true,"operations":`+operations+`}`)
+	suite.Equal(http.StatusConflict, w.Code)
+	var response handler.CompanyBatchResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Len(response.Results, 3)
+	suite.Equal(http.StatusFailedDependency, response.Results[0].Status)
+	suite.Equal(problem.CodeBatchAborted, response.Results[0].Error.Code)
+	suite.Equal(http.StatusConflict, response.Results[2].Status)
+	suite.Equal(problem.CodeDuplicateName, response.Results[2].Error.Code)
+
+	stored, err := suite.companyService.Get(context.Background(), company.ID)
+	suite.NoError(err)
+	suite.Equal("A test company", stored.Description)
+
+	// Best effort: every operation but the duplicate is applied.
+	w = batch(editor.Token, "/api/v1/company:batch", `{"operations":`+operations+`}`)
+	suite.Equal(http.StatusOK, w.Code)
+	response = handler.CompanyBatchResponse{}
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Len(response.Results, 3)
+	suite.Equal(http.StatusOK, response.Results[0].Status)
+	suite.Equal("BatchCompany", response.Results[0].Company.Name)
+	suite.Equal(http.StatusOK, response.Results[1].Status)
+	suite.Equal("Batched", response.Results[1].Company.Description)
+	suite.Equal(http.StatusConflict, response.Results[2].Status)
+	suite.Nil(response.Results[2].Company)
+}
+
+func (suite *RestApiTestSuite) TestExportImportCompanies() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	company := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+
+	_, err := suite.userService.Add("editor", "editor-password", model.RoleEditor)
+	suite.NoError(err)
+	_, err = suite.userService.Add("viewer", "viewer-password", model.RoleViewer)
+	suite.NoError(err)
+	editor := suite.authenticate(dto.LoginRequest{Username: "editor", Password: "editor-password"})
+	viewer := suite.authenticate(dto.LoginRequest{Username: "viewer", Password: "viewer-password"})
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	send := func(token string, method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := send("", "GET", "/api/v1/company/export", "", "")
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("text/csv", w.Header().Get("Content-Type"))
+	suite.Contains(w.Header().Get("Content-Disposition"), "companies.csv")
+	suite.Equal("ID,Name,Description,AmountOfEmployees,Registered,Type\n"+
+		company.ID.String()+",TestCompany,A test company,10,true,Corporations\n", w.Body.String())
+
+	w = send("", "GET", "/api/v1/company/export?format=ndjson&registered=false", "", "")
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+	suite.Empty(w.Body.String())
+	suite.Equal(http.StatusBadRequest, send("", "GET", "/api/v1/company/export?format=xlsx", "", "").Code)
+	suite.Equal(http.StatusUnauthorized, send("", "GET", "/api/v1/company/export?include_deleted=true", "", "").Code)
+
+	csvInput := "Name,AmountOfEmployees,Type\nImported,5,Corporations\nTestCompany,20,Cooperative\nInvalid,-1,Corporations\n"
+	suite.Equal(http.StatusUnauthorized, send("", "POST", "/api/v1/company/import", "text/csv", csvInput).Code)
+	suite.Equal(http.StatusForbidden, send(viewer.Token, "POST", "/api/v1/company/import", "text/csv", csvInput).Code)
+	suite.Equal(http.StatusUnsupportedMediaType, send(editor.Token, "POST", "/api/v1/company/import", "text/plain", csvInput).Code)
+	suite.Equal(http.StatusBadRequest, send(editor.Token, "POST", "/api/v1/company/import?dry_run=maybe", "text/csv", csvInput).Code)
+
+	w = send(editor.Token, "POST", "/api/v1/company/import?dry_run=true", "text/csv", csvInput)
+	suite.Equal(http.StatusOK, w.Code)
+	var response handler.CompanyImportResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.True(response.DryRun)
+	suite.Equal(1, response.Created)
+	suite.Equal(2, response.Failed)
+	suite.Equal(3, response.Errors[0].Line)
+	suite.Equal(problem.CodeDuplicateName, response.Errors[0].Error.Code)
+	suite.Equal(4, response.Errors[1].Line)
+	suite.Equal(problem.CodeValidationFailed, response.Errors[1].Error.Code)
+	suite.Equal("AmountOfEmployees", response.Errors[1].Error.Errors[0].Field)
+
+	w = send(loginResponse.Token, "POST", "/api/v1/company/import?upsert=true&format=csv", "application/octet-stream", csvInput)
+	suite.Equal(http.StatusOK, w.Code)
+	response = handler.CompanyImportResponse{}
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.False(response.DryRun)
+	suite.Equal(1, response.Created)
+	suite.Equal(1, response.Updated)
+	suite.Equal(1, response.Failed)
+
+	stored, err := suite.companyService.Get(context.Background(), company.ID)
+	suite.NoError(err)
+	suite.Equal(20, stored.AmountOfEmployees)
+	suite.Equal(model.CompanyTypeCooperative, stored.Type)
+}
+
+func (suite *RestApiTestSuite) TestSearchCompanies() {
+	company := suite.testCompany()
+	company.Description = "Makes test fixtures for testing companies."
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+	other := suite.testCompany()
+	other.Name = "Other"
+	other.Registered = false
+	suite.NoError(suite.companyService.Create(context.Background(), &other))
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	search := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/company/search?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := search("q=fixture")
+	suite.Equal(http.StatusOK, w.Code)
+	var response dto.CompanySearchResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Len(response.Items, 1)
+	suite.Equal(company.ID, response.Items[0].ID)
+	suite.Equal("TestCompany", response.Items[0].Name)
+	suite.Positive(response.Items[0].Rank)
+	suite.Equal("Makes test <mark>fixtures</mark> for testing companies.", response.Items[0].Highlights.Description)
+
+	w = search("q=test&registered=false")
+	suite.Equal(http.StatusOK, w.Code)
+	response = dto.CompanySearchResponse{}
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Len(response.Items, 1)
+	suite.Equal(other.ID, response.Items[0].ID)
+
+	suite.Equal(http.StatusBadRequest, search("q=").Code)
+	suite.Equal(http.StatusBadRequest, search("q=test&registered=maybe").Code)
+	suite.Equal(http.StatusBadRequest, search("q=test&limit=0").Code)
+	suite.Equal(http.StatusBadRequest, search("q=test&cursor=abc").Code)
+}
+
+func (suite *RestApiTestSuite) TestCompanyHistory() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	company := suite.testCompany()
+	err := suite.companyService.Create(context.Background(), &company)
+	suite.NoError(err)
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/company/"+company.ID.String(), bytes.NewBufferString(`{"Registered":false}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+	req.Header.Set("X-Request-ID", "request-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/company/"+company.ID.String()+"/history", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/company/"+company.ID.String()+"/history?limit=10", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+
+	var response dto.CompanyHistoryResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	suite.NoError(err)
+	suite.Len(response.Items, 2)
+	suite.Equal(model.AuditActionUpdate, response.Items[0].Action)
+	suite.Equal(suite.config.AuthUser, response.Items[0].ActorUsername)
+	suite.Equal("request-42", response.Items[0].RequestID)
+	suite.Equal(model.FieldChange{Before: true, After: false}, response.Items[0].Changes["Registered"])
+	suite.Equal(model.AuditActionCreate, response.Items[1].Action)
+}
+
+func (suite *RestApiTestSuite) TestCompanyEvents() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	corporation := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &corporation))
+	nonProfit := model.Company{Name: "NonProfit", AmountOfEmployees: 5, Type: model.CompanyTypeNonProfit}
+	suite.NoError(suite.companyService.Create(context.Background(), &nonProfit))
+	events := event.NewDispatcher(suite.companyApi.db, nil, zerolog.Nop(), time.Second, 0)
+	suite.NoError(events.Sequence(context.Background()))
+
+	suite.config.EventStreamInterval = 50 * time.Millisecond
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	stream := func(target string, lastEventID string, duration time.Duration, during func()) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithTimeout(context.Background(), duration)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", target, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			router.ServeHTTP(w, req)
+		}()
+		if during != nil {
+			during()
+		}
+		<-done
+
+		return w
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/company/events", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	w = stream("/api/v1/company/events?company_id=invalid", "", 200*time.Millisecond, nil)
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	// A new stream starts with the changes following its connection.
+	w = stream("/api/v1/company/events", "", 200*time.Millisecond, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("text/event-stream", w.Header().Get("Content-Type"))
+	suite.Empty(w.Body.String())
+
+	w = stream("/api/v1/company/events", "0", 200*time.Millisecond, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Contains(w.Body.String(), "id:1\nevent:CompanyCreated\ndata:{\"id\":1,\"sequence\":1,\"type\":\"CompanyCreated\",\"company_id\":\""+corporation.ID.String())
+	suite.Contains(w.Body.String(), "id:2\nevent:CompanyCreated\n")
+
+	w = stream("/api/v1/company/events", "1", 200*time.Millisecond, nil)
+	suite.NotContains(w.Body.String(), "id:1\n")
+	suite.Contains(w.Body.String(), "id:2\n")
+
+	w = stream("/api/v1/company/events?last_event_id=0&company_id="+corporation.ID.String(), "", 200*time.Millisecond, nil)
+	suite.Contains(w.Body.String(), "id:1\n")
+	suite.NotContains(w.Body.String(), "id:2\n")
+
+	w = stream("/api/v1/company/events?last_event_id=0&type=Non+Profit", "", 200*time.Millisecond, nil)
+	suite.NotContains(w.Body.String(), "id:1\n")
+	suite.Contains(w.Body.String(), "id:2\n")
+
+	// The changes made while connected are streamed.
+	w = stream("/api/v1/company/events?company_id="+corporation.ID.String(), "", time.Second, func() {
+		time.Sleep(50 * time.Millisecond)
+		suite.NoError(suite.companyService.Delete(context.Background(), corporation.ID, 0))
+		suite.NoError(events.Sequence(context.Background()))
+	})
+	suite.Contains(w.Body.String(), "id:3\nevent:CompanyDeleted\n")
+}
+
+func (suite *RestApiTestSuite) TestWebhooks() {
+	loginResponse := suite.authenticate(suite.loginRequest())
+	_, err := suite.userService.Add("engineer", "engineer-password", model.RoleEditor)
+	suite.NoError(err)
+	editorResponse := suite.authenticate(dto.LoginRequest{Username: "engineer", Password: "engineer-password"})
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	request := func(method string, target string, body string, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	body := `{"URL":"https://partner.example/xm","Events":["CompanyUpdated"]}`
+	w := request("POST", "/api/v1/webhooks", body, editorResponse.Token)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	w = request("POST", "/api/v1/webhooks", `{"URL":"partner.example"}`, loginResponse.Token)
+	suite.Equal(http.StatusUnprocessableEntity, w.Code)
+	suite.Contains(w.Body.String(), "The webhook has invalid fields.")
+	suite.Contains(w.Body.String(), `"field":"URL"`)
+
+	w = request("POST", "/api/v1/webhooks", body, loginResponse.Token)
+	suite.Equal(http.StatusCreated, w.Code)
+	var created dto.WebhookCreatedResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	suite.NotEmpty(created.Secret)
+	suite.Equal("https://partner.example/xm", created.URL)
+
+	// The secret is not disclosed again.
+	w = request("GET", "/api/v1/webhooks/"+created.ID.String(), "", loginResponse.Token)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.NotContains(w.Body.String(), created.Secret)
+	w = request("GET", "/api/v1/webhooks", "", loginResponse.Token)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.NotContains(w.Body.String(), created.Secret)
+	var list dto.WebhookListResponse
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &list))
+	suite.Len(list.Items, 1)
+
+	w = request("GET", "/api/v1/webhooks/"+created.ID.String()+"/deliveries?status=dead", "", loginResponse.Token)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.JSONEq(`{"items":[]}`, w.Body.String())
+	w = request("GET", "/api/v1/webhooks/"+created.ID.String()+"/deliveries?status=lost", "", loginResponse.Token)
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/api/v1/webhooks/"+created.ID.String()+"/deliveries/1/redeliver", "", loginResponse.Token)
+	suite.Equal(http.StatusNotFound, w.Code)
+	suite.Contains(w.Body.String(), "Webhook delivery not found.")
+
+	w = request("DELETE", "/api/v1/webhooks/"+created.ID.String(), "", loginResponse.Token)
+	suite.Equal(http.StatusOK, w.Code)
+	w = request("GET", "/api/v1/webhooks/"+created.ID.String(), "", loginResponse.Token)
+	suite.Equal(http.StatusNotFound, w.Code)
+	suite.Contains(w.Body.String(), "Webhook not found.")
+}
+
+func (suite *RestApiTestSuite) TestMetrics() {
+	company := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+	found := metrics.HTTPRequests.WithLabelValues("GET", "/api/v1/company/:id", "200")
+	notFound := metrics.HTTPRequests.WithLabelValues("GET", "/api/v1/company/:id", "404")
+	unmatched := metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")
+	loginFailures := metrics.Logins.WithLabelValues(metrics.LoginFailure)
+	loginSuccesses := metrics.Logins.WithLabelValues(metrics.LoginSuccess)
+	before := []float64{testutil.ToFloat64(found), testutil.ToFloat64(notFound), testutil.ToFloat64(unmatched),
+		testutil.ToFloat64(loginFailures), testutil.ToFloat64(loginSuccesses), testutil.ToFloat64(metrics.RateLimited)}
+
+	suite.authenticate(suite.loginRequest())
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewBufferString(`{"username":"admin","password":"wrong-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	for _, target := range []string{"/api/v1/company/" + company.ID.String(), "/api/v1/company/" + uuid.NewString(), "/api/v1/unknown"} {
+		req, _ := http.NewRequest("GET", target, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	suite.config.RateLimit = 0.001
+	suite.config.RateBurst = 1
+	router, err = suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	for range 2 {
+		req, _ := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	after := []float64{testutil.ToFloat64(found), testutil.ToFloat64(notFound), testutil.ToFloat64(unmatched),
+		testutil.ToFloat64(loginFailures), testutil.ToFloat64(loginSuccesses), testutil.ToFloat64(metrics.RateLimited)}
+	for i := range before {
+		suite.Equal(before[i]+1, after[i], i)
+	}
+}
+
+func (suite *RestApiTestSuite) TestTracing() {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracing.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+	suite.NoError(tracing.RegisterDB(suite.companyApi.db))
+
+	company := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+	loginResponse := suite.authenticate(suite.loginRequest())
+	exporter.Reset()
+
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	req, _ := http.NewRequest("GET", "/api/v1/company/"+company.ID.String()+"/history", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+
+	spans := exporter.GetSpans()
+	server := spans[len(spans)-1]
+	suite.Equal("/api/v1/company/:id/history", server.Name)
+	suite.Equal(trace.SpanKindServer, server.SpanKind)
+	suite.Equal("4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	suite.Equal("00f067aa0ba902b7", server.Parent.SpanID().String())
+	suite.True(server.Parent.IsRemote())
+	suite.Contains(server.Attributes, tracing.AttributeUsername.String(suite.config.AuthUser))
+	suite.Contains(server.Attributes, tracing.AttributeCompanyID.String(company.ID.String()))
+
+	// The queries of the company service are children of the request.
+	var queries int
+	for _, span := range spans[:len(spans)-1] {
+		if span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			continue
+		}
+		suite.Equal(server.SpanContext.SpanID(), span.Parent.SpanID(), span.Name)
+		if span.Name == "gorm.query" {
+			queries++
+		}
+	}
+	suite.NotZero(queries)
+}
+
+func (suite *RestApiTestSuite) TestRequestLogging() {
+	var output bytes.Buffer
+	restApi := NewRestApi(suite.ctx, zerolog.New(&output), suite.config, suite.companyApi.db)
+	router, err := restApi.BuildRouter()
+	suite.NoError(err)
+	loginResponse := suite.authenticate(suite.loginRequest())
+	company := suite.testCompany()
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+
+	req, _ := http.NewRequest("GET", "/api/v1/company/"+company.ID.String()+"/history", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResponse.Token))
+	req.Header.Set("X-Request-ID", "request-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("request-42", w.Header().Get("X-Request-ID"))
+
+	line := suite.logLine(&output)
+	suite.Equal("info", line["level"])
+	suite.Equal("access", line["type"])
+	suite.Equal("request-42", line["request_id"])
+	suite.Equal(suite.config.AuthUser, line["user"])
+	suite.Equal("GET", line["method"])
+	suite.Equal("/api/v1/company/:id/history", line["route"])
+	suite.Equal("/api/v1/company/"+company.ID.String()+"/history", line["path"])
+	suite.Equal(float64(http.StatusOK), line["status"])
+	suite.Contains(line, "latency_ms")
+	suite.NotZero(line["bytes_out"])
+
+	// IDs that could break the logs or the audit records are replaced.
+	for _, requestID := range []string{"", "request 42\nforged", strings.Repeat("a", 101)} {
+		req, _ = http.NewRequest("GET", "/api/v1/unknown", nil)
+		req.Header.Set("X-Request-ID", requestID)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		suite.Equal(http.StatusNotFound, w.Code)
+		_, err := uuid.Parse(w.Header().Get("X-Request-ID"))
+		suite.NoError(err, requestID)
+
+		line = suite.logLine(&output)
+		suite.Equal(w.Header().Get("X-Request-ID"), line["request_id"])
+		suite.Equal("unmatched", line["route"])
+		suite.NotContains(line, "user")
+	}
+}
+
+func (suite *RestApiTestSuite) TestRecovery() {
+	var output bytes.Buffer
+	restApi := NewRestApi(suite.ctx, zerolog.New(&output), suite.config, suite.companyApi.db)
+	router, err := restApi.BuildRouter()
+	suite.NoError(err)
+	router.GET("/api/v1/panic", func(c *gin.Context) { panic("something went wrong") })
+
+	req, _ := http.NewRequest("GET", "/api/v1/panic", nil)
+	req.Header.Set("X-Request-ID", "request-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusInternalServerError, w.Code)
+	suite.Equal(problem.ContentType, w.Header().Get("Content-Type"))
+	var response problem.Problem
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Equal(problem.CodeInternal, response.Code)
+	suite.NotContains(w.Body.String(), "something went wrong")
+
+	panicLine := suite.logLine(&output)
+	suite.Equal("error", panicLine["level"])
+	suite.Equal("panic", panicLine["type"])
+	suite.Equal("request-42", panicLine["request_id"])
+	suite.Equal("something went wrong", panicLine["panic"])
+	suite.Contains(panicLine["stack"], "api_test.go")
+
+	accessLine := suite.logLine(&output)
+	suite.Equal("error", accessLine["level"])
+	suite.Equal("access", accessLine["type"])
+	suite.Equal(float64(http.StatusInternalServerError), accessLine["status"])
+}
+
+func (suite *RestApiTestSuite) TestHealth_NotRateLimited() {
+	suite.config.RateLimit = 0.001
+	suite.config.RateBurst = 1
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	for range 3 {
+		req, _ := http.NewRequest("GET", "/api/v1/health", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		suite.Equal(http.StatusNoContent, w.Code)
+	}
+
+	codes := map[int]int{}
+	for range 2 {
+		req, _ := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes[w.Code]++
+	}
+	suite.Equal(map[int]int{http.StatusOK: 1, http.StatusTooManyRequests: 1}, codes)
+}
+
 func (suite *RestApiTestSuite) TestDeleteCompany_Unauthorized() {
 	company := suite.testCompany()
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	req, _ := http.NewRequest("DELETE", "/api/v1/company/"+company.ID.String(), nil)
@@ -260,3 +1073,13 @@ func (suite *RestApiTestSuite) authenticate(login dto.LoginRequest) dto.LoginRes
 	suite.NoError(err)
 	return loginResponse
 }
+
+// logLine reads the next JSON log line written to output.
+func (suite *RestApiTestSuite) logLine(output *bytes.Buffer) map[string]any {
+	line, err := output.ReadBytes('\n')
+	suite.Require().NoError(err)
+	var fields map[string]any
+	suite.Require().NoError(json.Unmarshal(line, &fields))
+
+	return fields
+}
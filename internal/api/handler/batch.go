@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	"net/http"
+)
+
+// CompanyBatchRequest is the body of POST /company:batch.
+type CompanyBatchRequest struct {
+	// Atomic applies all the operations or none.
+	Atomic     bool                    `json:"atomic"`
+	Operations []CompanyBatchOperation `json:"operations"`
+}
+
+// CompanyBatchOperation creates, updates or deletes a company. The company of an update
+// is a JSON Merge Patch of the stored one.
+type CompanyBatchOperation struct {
+	Op      string          `json:"op"`
+	ID      uuid.UUID       `json:"id,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Company json.RawMessage `json:"company,omitempty"`
+}
+
+// CompanyBatchResponse holds the result of every operation, in the order of the request.
+type CompanyBatchResponse struct {
+	Results []CompanyBatchResult `json:"results"`
+}
+
+type CompanyBatchResult struct {
+	Status  int              `json:"status"`
+	Company *dto.Company     `json:"company,omitempty"`
+	Error   *problem.Problem `json:"error,omitempty"`
+}
+
+// batchPermissions are the permissions needed by the batch operations.
+var batchPermissions = map[string]model.Permission{
+	service.BatchCreate: model.PermissionCompanyCreate,
+	service.BatchUpdate: model.PermissionCompanyUpdate,
+	service.BatchDelete: model.PermissionCompanyDelete,
+}
+
+// Action serves the custom methods of the company collection, e.g. POST /company:batch.
+func (ch *CompanyHandler) Action(c *gin.Context) {
+	switch c.Param("action") {
+	case ":batch":
+		ch.Batch(c)
+	default:
+		_ = c.Error(problem.New(http.StatusNotFound, problem.CodeNotFound, "Route not found."))
+	}
+}
+
+// Batch applies a list of company operations. A best-effort batch answers 200 with the
+// result of every operation; a failed atomic batch answers with the status of the failed one.
+func (ch *CompanyHandler) Batch(c *gin.Context) {
+	var request CompanyBatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+		return
+	}
+
+	user, _ := middleware.Identity(c)
+	operations := make([]service.CompanyBatchOperation, 0, len(request.Operations))
+	for _, operation := range request.Operations {
+		permission, ok := batchPermissions[operation.Op]
+		if ok && (user == nil || !user.Role.Can(permission)) {
+			_ = c.Error(problem.New(http.StatusForbidden, problem.CodeForbidden, "Missing permission "+string(permission)+"."))
+			return
+		}
+
+		batchOperation, err := companyBatchOperation(operation)
+		if err != nil {
+			_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+			return
+		}
+		operations = append(operations, batchOperation)
+	}
+
+	results, err := ch.company.Batch(requestContext(c), operations, request.Atomic)
+	if err != nil && results == nil {
+		_ = c.Error(err)
+		return
+	}
+
+	status := http.StatusOK
+	response := CompanyBatchResponse{Results: make([]CompanyBatchResult, 0, len(results))}
+	for _, result := range results {
+		if result.Err == nil {
+			batchResult := CompanyBatchResult{Status: http.StatusOK}
+			if result.Company != nil {
+				company := dto.NewCompany(result.Company)
+				batchResult.Company = &company
+			}
+			response.Results = append(response.Results, batchResult)
+			continue
+		}
+
+		resultProblem := problem.FromError(result.Err)
+		response.Results = append(response.Results, CompanyBatchResult{Status: resultProblem.Status, Error: &resultProblem})
+		if err != nil && !errors.Is(result.Err, service.ErrBatchAborted) {
+			status = resultProblem.Status
+		}
+	}
+
+	c.JSON(status, response)
+}
+
+func companyBatchOperation(operation CompanyBatchOperation) (service.CompanyBatchOperation, error) {
+	result := service.CompanyBatchOperation{Op: operation.Op, ID: operation.ID, Version: operation.Version}
+	switch operation.Op {
+	case service.BatchCreate:
+		if len(operation.Company) == 0 {
+			return result, errors.New("create needs a company")
+		}
+		var request dto.CompanyRequest
+		if err := json.Unmarshal(operation.Company, &request); err != nil {
+			return result, err
+		}
+		result.Company = &model.Company{}
+		request.Apply(result.Company)
+	case service.BatchUpdate:
+		if len(operation.Company) == 0 {
+			return result, errors.New("update needs a company")
+		}
+		result.Patch = func(company *model.Company) error {
+			return patchCompany(company, ContentTypeMergePatch, operation.Company)
+		}
+	}
+
+	return result, nil
+}
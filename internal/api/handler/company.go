@@ -1,14 +1,28 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/dto"
 	"github.com/vcsfrl/xm/internal/model"
 	"github.com/vcsfrl/xm/internal/service"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+var (
+	errInvalidID    = problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid UUID.")
+	errPrecondition = problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, "Company was modified.")
+)
+
+// CompanyHandler serves the company endpoints. Errors are attached to the context
+// with c.Error and rendered by middleware.Problems.
 type CompanyHandler struct {
 	company *service.Company
 }
@@ -18,17 +32,21 @@ func NewCompanyHandler(company *service.Company) *CompanyHandler {
 }
 
 func (ch *CompanyHandler) Create(c *gin.Context) {
-	var company model.Company
-	if err := c.ShouldBindJSON(&company); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var request dto.CompanyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
 		return
 	}
 
-	if err := ch.company.Create(&company); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var company model.Company
+	request.Apply(&company)
+	if err := ch.company.Create(requestContext(c), &company); err != nil {
+		_ = c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusOK, company)
+	c.Header("ETag", companyETag(&company))
+	c.JSON(http.StatusOK, dto.NewCompany(&company))
 }
 
 func (ch *CompanyHandler) Get(c *gin.Context) {
@@ -38,73 +56,341 @@ func (ch *CompanyHandler) Get(c *gin.Context) {
 
 	uuid, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID"})
+		_ = c.Error(errInvalidID)
+		return
+	}
+
+	includeDeleted, err := includeDeletedParam(c)
+	if err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidQuery, err))
+		return
+	}
+
+	if includeDeleted {
+		company, err = ch.company.GetIncludingDeleted(requestContext(c), uuid)
+	} else {
+		company, err = ch.company.Get(requestContext(c), uuid)
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	etag := companyETag(company)
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && ifNoneMatch(header, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewCompany(company))
+}
+
+// List returns a page of companies.
+//
+// Query parameters: type (repeatable), registered, min_employees, max_employees,
+// name_prefix, sort (comma separated fields, "-" prefix for descending), limit, cursor
+// and include_deleted.
+func (ch *CompanyHandler) List(c *gin.Context) {
+	query, err := parseCompanyListQuery(c)
+	if err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidQuery, err))
+		return
+	}
+
+	companies, err := ch.company.List(requestContext(c), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.CompanyListResponse{
+		Items:      dto.NewCompanies(companies.Items),
+		NextCursor: companies.NextCursor,
+	})
+}
+
+// Search returns a page of the companies whose name or description match the words of q,
+// most relevant first.
+//
+// Query parameters: q, type (repeatable), registered, limit and cursor.
+func (ch *CompanyHandler) Search(c *gin.Context) {
+	query := service.CompanySearchQuery{Query: c.Query("q"), Cursor: c.Query("cursor")}
+	for _, companyType := range c.QueryArray("type") {
+		query.Types = append(query.Types, model.CompanyType(companyType))
+	}
+
+	if value, ok := c.GetQuery("registered"); ok {
+		registered, err := strconv.ParseBool(value)
+		if err != nil {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid registered: "+value))
+			return
+		}
+		query.Registered = &registered
+	}
+
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid limit: "+value))
+			return
+		}
+		query.Limit = limit
+	}
+
+	result, err := ch.company.Search(requestContext(c), query)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	company, err = ch.company.Get(uuid)
+	response := dto.CompanySearchResponse{Items: make([]dto.CompanySearchItem, 0, len(result.Items)), NextCursor: result.NextCursor}
+	for _, hit := range result.Items {
+		response.Items = append(response.Items, dto.CompanySearchItem{
+			Company: dto.NewCompany(&hit.Company),
+			Rank:    hit.Rank,
+			Highlights: dto.CompanyHighlights{
+				Name:        hit.NameSnippet,
+				Description: hit.DescriptionSnippet,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// History returns the audit records of a company, newest first.
+func (ch *CompanyHandler) History(c *gin.Context) {
+	uuid, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error getting company"})
+		_ = c.Error(errInvalidID)
 		return
 	}
 
-	if company == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+	limit := 0
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid limit: "+value))
+			return
+		}
+	}
+
+	history, err := ch.company.History(requestContext(c), uuid, limit, c.Query("cursor"))
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, company)
+	c.JSON(http.StatusOK, dto.CompanyHistoryResponse{
+		Items:      history.Items,
+		NextCursor: history.NextCursor,
+	})
 }
 
+// Update changes a company. The body is a JSON Merge Patch (application/merge-patch+json),
+// a JSON Patch (application/json-patch+json) or a JSON object (application/json) applied as a
+// merge patch: the fields present in the body, zero values included, overwrite the stored ones
+// and the absent fields are left unchanged.
 func (ch *CompanyHandler) Update(c *gin.Context) {
 	var company *model.Company
 	id := c.Param("id")
 
 	uuid, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID"})
+		_ = c.Error(errInvalidID)
 		return
 	}
 
-	company, err = ch.company.Get(uuid)
+	company, err = ch.company.Get(requestContext(c), uuid)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error getting company"})
+		_ = c.Error(err)
 		return
 	}
 
-	fmt.Println(company)
-
-	if company == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+	header := c.GetHeader("If-Match")
+	if header != "" && !ifMatch(header, companyETag(company)) {
+		_ = c.Error(errPrecondition)
 		return
 	}
 
-	if err := c.ShouldBindJSON(company); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	switch contentType := c.ContentType(); contentType {
+	case ContentTypeMergePatch, ContentTypeJSONPatch:
+		body, err := c.GetRawData()
+		if err != nil {
+			_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+			return
+		}
+		if err := patchCompany(company, contentType, body); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	case gin.MIMEJSON, "":
+		// Plain JSON only overwrites the fields it sets.
+		request := dto.NewCompanyRequest(company)
+		if err := c.ShouldBindJSON(&request); err != nil {
+			_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+			return
+		}
+		request.Apply(company)
+	default:
+		_ = c.Error(problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia, "Unsupported content type "+contentType+"."))
 		return
 	}
-	company.ID = uuid
 
-	if err := ch.company.Update(company); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating company"})
+	if err := ch.company.Update(requestContext(c), company); err != nil {
+		_ = c.Error(versionConflict(err, header))
 		return
 	}
 
-	c.JSON(http.StatusOK, company)
+	c.Header("ETag", companyETag(company))
+	c.JSON(http.StatusOK, dto.NewCompany(company))
 }
 
 func (ch *CompanyHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 	uuid, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID"})
+		_ = c.Error(errInvalidID)
 		return
 	}
 
-	if err := ch.company.Delete(uuid); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting company"})
+	version := 0
+	header := c.GetHeader("If-Match")
+	if header != "" {
+		company, err := ch.company.Get(requestContext(c), uuid)
+		if err != nil && !errors.Is(err, service.ErrNotFound) {
+			_ = c.Error(err)
+			return
+		}
+		if err != nil || !ifMatch(header, companyETag(company)) {
+			_ = c.Error(errPrecondition)
+			return
+		}
+		version = company.Version
+	}
+
+	if err := ch.company.Delete(requestContext(c), uuid, version); err != nil {
+		_ = c.Error(versionConflict(err, header))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Company deleted"})
 }
+
+// Restore undoes the soft deletion of a company.
+func (ch *CompanyHandler) Restore(c *gin.Context) {
+	uuid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		_ = c.Error(errInvalidID)
+		return
+	}
+
+	company, err := ch.company.Restore(requestContext(c), uuid)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("ETag", companyETag(company))
+	c.JSON(http.StatusOK, dto.NewCompany(company))
+}
+
+// IncludesDeleted reports whether the request asks for soft deleted companies.
+func IncludesDeleted(c *gin.Context) bool {
+	includeDeleted, err := includeDeletedParam(c)
+	return err == nil && includeDeleted
+}
+
+func includeDeletedParam(c *gin.Context) (bool, error) {
+	value, ok := c.GetQuery("include_deleted")
+	if !ok {
+		return false, nil
+	}
+
+	includeDeleted, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid include_deleted: %s", value)
+	}
+
+	return includeDeleted, nil
+}
+
+// versionConflict turns the version conflict of a write that lost a race with a concurrent
+// one into a failed precondition when the client sent one. It returns other errors unchanged.
+func versionConflict(err error, ifMatchHeader string) error {
+	if ifMatchHeader != "" && errors.Is(err, service.ErrVersionConflict) {
+		return &problem.Error{Status: errPrecondition.Status, Code: errPrecondition.Code, Detail: errPrecondition.Detail, Err: err}
+	}
+
+	return err
+}
+
+func parseCompanyListQuery(c *gin.Context) (service.CompanyListQuery, error) {
+	query := service.CompanyListQuery{
+		NamePrefix: c.Query("name_prefix"),
+		Cursor:     c.Query("cursor"),
+	}
+
+	includeDeleted, err := includeDeletedParam(c)
+	if err != nil {
+		return query, err
+	}
+	query.IncludeDeleted = includeDeleted
+
+	for _, companyType := range c.QueryArray("type") {
+		query.Types = append(query.Types, model.CompanyType(companyType))
+	}
+
+	if value, ok := c.GetQuery("registered"); ok {
+		registered, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid registered: %s", value)
+		}
+		query.Registered = &registered
+	}
+
+	if value, ok := c.GetQuery("min_employees"); ok {
+		minEmployees, err := strconv.Atoi(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid min_employees: %s", value)
+		}
+		query.MinEmployees = &minEmployees
+	}
+
+	if value, ok := c.GetQuery("max_employees"); ok {
+		maxEmployees, err := strconv.Atoi(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid max_employees: %s", value)
+		}
+		query.MaxEmployees = &maxEmployees
+	}
+
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("invalid limit: %s", value)
+		}
+		query.Limit = limit
+	}
+
+	if value := c.Query("sort"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			sort := service.CompanySort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+			query.Sort = append(query.Sort, sort)
+		}
+	}
+
+	return query, nil
+}
+
+// requestContext returns the request context, carrying the request ID set by middleware.Logger, with the authenticated user.
+func requestContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if user, ok := middleware.Identity(c); ok {
+		ctx = service.WithActor(ctx, *user)
+	}
+
+	return ctx
+}
@@ -2,12 +2,18 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/api/problem"
 	db2 "github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/dto"
 	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
 	"github.com/vcsfrl/xm/internal/service"
 	"github.com/vcsfrl/xm/internal/validator"
 	"net/http"
@@ -33,11 +39,13 @@ func (suite *CompanyHandlerSuite) SetupTest() {
 	suite.NoError(err)
 	suite.NotNil(db)
 
-	suite.companyService = service.NewCompanyService(db, validator.CompanyValidator(suite.logger))
+	suite.companyService = service.NewCompanyService(repository.NewSqliteCompanyRepository(db), validator.CompanyValidator(suite.logger))
 	suite.handler = NewCompanyHandler(suite.companyService)
 
 	suite.router = gin.Default()
+	suite.router.Use(middleware.Problems(suite.logger))
 	suite.router.POST("/company", suite.handler.Create)
+	suite.router.GET("/company", suite.handler.List)
 	suite.router.GET("/company/:id", suite.handler.Get)
 	suite.router.PATCH("/company/:id", suite.handler.Update)
 	suite.router.DELETE("/company/:id", suite.handler.Delete)
@@ -75,7 +83,7 @@ func (suite *CompanyHandlerSuite) TestGetCompany() {
 		Registered:        true,
 		Type:              model.CompanyTypeCorporation,
 	}
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	req, _ := http.NewRequest("GET", "/company/"+company.ID.String(), nil)
@@ -91,6 +99,69 @@ func (suite *CompanyHandlerSuite) TestGetCompany() {
 	suite.Equal(company.Name, responseCompany.Name)
 }
 
+func (suite *CompanyHandlerSuite) TestProblems() {
+	company := model.Company{
+		Name:              "TestCompany",
+		AmountOfEmployees: 10,
+		Type:              model.CompanyTypeCorporation,
+	}
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"GET", "/company/" + uuid.NewString(), "", http.StatusNotFound, problem.CodeNotFound},
+		{"GET", "/company/not-a-uuid", "", http.StatusBadRequest, problem.CodeInvalidRequest},
+		{"GET", "/company?limit=abc", "", http.StatusBadRequest, problem.CodeInvalidQuery},
+		{"PATCH", "/company/" + uuid.NewString(), `{"Description":"missing"}`, http.StatusNotFound, problem.CodeNotFound},
+		{"POST", "/company", `{"Name":`, http.StatusBadRequest, problem.CodeInvalidRequest},
+		{"POST", "/company", `{"Name":"TestCompany","AmountOfEmployees":5,"Type":"Corporations"}`, http.StatusConflict, problem.CodeDuplicateName},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		suite.Equal(test.status, w.Code, "%s %s", test.method, test.path)
+		suite.Equal(problem.ContentType, w.Header().Get("Content-Type"))
+
+		var response problem.Problem
+		suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		suite.Equal(test.code, response.Code, "%s %s", test.method, test.path)
+		suite.Equal(test.status, response.Status)
+		suite.NotEmpty(response.Title)
+	}
+
+	// Sqlite error messages stay out of the response.
+	req, _ := http.NewRequest("POST", "/company", bytes.NewBufferString(`{"Name":"TestCompany","AmountOfEmployees":5,"Type":"Corporations"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.NotContains(w.Body.String(), "UNIQUE")
+}
+
+func (suite *CompanyHandlerSuite) TestValidationProblem() {
+	req, _ := http.NewRequest("POST", "/company", bytes.NewBufferString(`{"Name":"TestCompany","AmountOfEmployees":-1,"Type":"Unknown"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	suite.Equal(http.StatusUnprocessableEntity, w.Code)
+
+	var response problem.Problem
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Equal(problem.CodeValidationFailed, response.Code)
+	suite.ElementsMatch([]service.FieldError{
+		{Field: "AmountOfEmployees", Code: "min", Message: "must be at least 0"},
+		{Field: "Type", Code: "company_type", Message: "is not a known company type"},
+	}, response.Errors)
+}
+
 func (suite *CompanyHandlerSuite) TestUpdateCompany() {
 	company := model.Company{
 		Name:              "TestCompany",
@@ -99,7 +170,7 @@ func (suite *CompanyHandlerSuite) TestUpdateCompany() {
 		Registered:        true,
 		Type:              model.CompanyTypeCorporation,
 	}
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	updatedCompany := model.Company{
@@ -138,7 +209,7 @@ func (suite *CompanyHandlerSuite) TestUpdatePartialCompany() {
 		Registered:        true,
 		Type:              model.CompanyTypeCorporation,
 	}
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	updatedCompany := model.Company{
@@ -161,6 +232,99 @@ func (suite *CompanyHandlerSuite) TestUpdatePartialCompany() {
 	suite.Equal(company.Description, responseCompany.Description)
 }
 
+func (suite *CompanyHandlerSuite) TestMergePatchCompany() {
+	company := model.Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              model.CompanyTypeCorporation,
+	}
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+
+	tests := []struct {
+		patch  string
+		status int
+		code   string
+	}{
+		{`{"Description":null,"Registered":false,"AmountOfEmployees":15}`, http.StatusOK, ""},
+		{`{"Type":null}`, http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{`{"ID":"` + uuid.NewString() + `"}`, http.StatusUnprocessableEntity, problem.CodeInvalidPatch},
+		{`{"Unknown":1}`, http.StatusUnprocessableEntity, problem.CodeInvalidPatch},
+		{`{"AmountOfEmployees":"many"}`, http.StatusUnprocessableEntity, problem.CodeInvalidPatch},
+		{`{"Name":`, http.StatusBadRequest, problem.CodeInvalidRequest},
+		{`{"AmountOfEmployees":-1}`, http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{`{"AmountOfEmployees":0}`, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("PATCH", "/company/"+company.ID.String(), bytes.NewBufferString(test.patch))
+		req.Header.Set("Content-Type", ContentTypeMergePatch)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		suite.Equal(test.status, w.Code, test.patch)
+		if test.code != "" {
+			suite.Contains(w.Body.String(), `"code":"`+test.code+`"`, test.patch)
+		}
+	}
+
+	result, err := suite.companyService.Get(context.Background(), company.ID)
+	suite.NoError(err)
+	suite.Equal("TestCompany", result.Name)
+	suite.Empty(result.Description)
+	suite.False(result.Registered)
+	suite.Equal(0, result.AmountOfEmployees)
+	suite.Equal(3, result.Version)
+}
+
+func (suite *CompanyHandlerSuite) TestJSONPatchCompany() {
+	company := model.Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        false,
+		Type:              model.CompanyTypeCorporation,
+	}
+	suite.NoError(suite.companyService.Create(context.Background(), &company))
+
+	tests := []struct {
+		patch  string
+		status int
+		code   string
+	}{
+		{`[{"op":"test","path":"/Registered","value":false},{"op":"replace","path":"/Registered","value":true},{"op":"replace","path":"/Description","value":""}]`, http.StatusOK, ""},
+		{`[{"op":"test","path":"/AmountOfEmployees","value":99},{"op":"replace","path":"/Name","value":"Other"}]`, http.StatusConflict, problem.CodePatchTestFailed},
+		{`[{"op":"replace","path":"/Missing","value":1}]`, http.StatusUnprocessableEntity, problem.CodeInvalidPatch},
+		{`[{"op":"remove","path":"/Name"}]`, http.StatusUnprocessableEntity, problem.CodeValidationFailed},
+		{`{"op":"replace"}`, http.StatusBadRequest, problem.CodeInvalidRequest},
+		{`[{"op":"replace","path":"/AmountOfEmployees","value":0},{"op":"test","path":"/AmountOfEmployees","value":0}]`, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("PATCH", "/company/"+company.ID.String(), bytes.NewBufferString(test.patch))
+		req.Header.Set("Content-Type", ContentTypeJSONPatch)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		suite.Equal(test.status, w.Code, test.patch)
+		if test.code != "" {
+			suite.Contains(w.Body.String(), `"code":"`+test.code+`"`, test.patch)
+		}
+	}
+
+	result, err := suite.companyService.Get(context.Background(), company.ID)
+	suite.NoError(err)
+	suite.Equal("TestCompany", result.Name)
+	suite.Empty(result.Description)
+	suite.True(result.Registered)
+	suite.Zero(result.AmountOfEmployees)
+
+	req, _ := http.NewRequest("PATCH", "/company/"+company.ID.String(), bytes.NewBufferString(`Name=Other`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusUnsupportedMediaType, w.Code)
+}
+
 func (suite *CompanyHandlerSuite) TestDeleteCompany() {
 	company := model.Company{
 		Name:              "TestCompany",
@@ -169,7 +333,7 @@ func (suite *CompanyHandlerSuite) TestDeleteCompany() {
 		Registered:        true,
 		Type:              model.CompanyTypeCorporation,
 	}
-	err := suite.companyService.Create(&company)
+	err := suite.companyService.Create(context.Background(), &company)
 	suite.NoError(err)
 
 	req, _ := http.NewRequest("DELETE", "/company/"+company.ID.String(), nil)
@@ -183,3 +347,111 @@ func (suite *CompanyHandlerSuite) TestDeleteCompany() {
 
 	suite.Equal("Company deleted", response["message"])
 }
+
+func (suite *CompanyHandlerSuite) TestListCompanies() {
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		company := model.Company{
+			Name:              name,
+			AmountOfEmployees: 10,
+			Registered:        true,
+			Type:              model.CompanyTypeCorporation,
+		}
+		err := suite.companyService.Create(context.Background(), &company)
+		suite.NoError(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/company?sort=-Name&limit=2&type=Corporations", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	suite.Equal(http.StatusOK, w.Code)
+
+	var response dto.CompanyListResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	suite.NoError(err)
+	suite.Len(response.Items, 2)
+	suite.Equal("Gamma", response.Items[0].Name)
+	suite.Equal("Beta", response.Items[1].Name)
+	suite.NotEmpty(response.NextCursor)
+
+	req, _ = http.NewRequest("GET", "/company?sort=-Name&limit=2&type=Corporations&cursor="+response.NextCursor, nil)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	suite.Equal(http.StatusOK, w.Code)
+	response = dto.CompanyListResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	suite.NoError(err)
+	suite.Len(response.Items, 1)
+	suite.Equal("Alpha", response.Items[0].Name)
+	suite.Empty(response.NextCursor)
+}
+
+func (suite *CompanyHandlerSuite) TestListCompanies_InvalidQuery() {
+	for _, query := range []string{"limit=abc", "registered=maybe", "sort=Unknown"} {
+		req, _ := http.NewRequest("GET", "/company?"+query, nil)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		suite.Equal(http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func (suite *CompanyHandlerSuite) TestConditionalRequests() {
+	company := model.Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              model.CompanyTypeCorporation,
+	}
+	err := suite.companyService.Create(context.Background(), &company)
+	suite.NoError(err)
+
+	req, _ := http.NewRequest("GET", "/company/"+company.ID.String(), nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	suite.Equal(`"1"`, etag)
+
+	req, _ = http.NewRequest("GET", "/company/"+company.ID.String(), nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusNotModified, w.Code)
+	suite.Empty(w.Body.Bytes())
+
+	req, _ = http.NewRequest("PATCH", "/company/"+company.ID.String(), bytes.NewBufferString(`{"Description":"first"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal(`"2"`, w.Header().Get("ETag"))
+
+	// The second editor still holds the first version.
+	req, _ = http.NewRequest("PATCH", "/company/"+company.ID.String(), bytes.NewBufferString(`{"Description":"second"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+	suite.Contains(w.Body.String(), problem.CodePreconditionFailed)
+
+	req, _ = http.NewRequest("DELETE", "/company/"+company.ID.String(), nil)
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+
+	result, err := suite.companyService.Get(context.Background(), company.ID)
+	suite.NoError(err)
+	suite.Equal("first", result.Description)
+
+	req, _ = http.NewRequest("DELETE", "/company/"+company.ID.String(), nil)
+	req.Header.Set("If-Match", `"2"`)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+}
@@ -1,19 +1,32 @@
 package handler
 
 import (
-	"github.com/go-chi/chi/v5"
-	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"expvar"
+	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/metrics"
 	"net/http"
+	"net/http/pprof"
 )
 
+// NewDebug returns the router of the debug endpoints: pprof, expvar and the Prometheus metrics.
 func NewDebug(logger zerolog.Logger) http.Handler {
-	//TODO: make this work with gin
-	r := chi.NewRouter()
-	r.Use(chiMiddleware.RequestID)
-	r.Use(middleware.LoggerMiddleware(logger))
-	r.Mount("/debug", chiMiddleware.Profiler())
+	r := gin.New()
+	r.Use(middleware.Logger(logger))
+	r.Use(middleware.Recovery(logger))
+
+	debug := r.Group("/debug")
+	debug.GET("/vars", gin.WrapH(expvar.Handler()))
+	debug.GET("/pprof", func(c *gin.Context) { c.Redirect(http.StatusMovedPermanently, "/debug/pprof/") })
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.Any("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	// The other profiles, e.g. heap or goroutine, are served by the index.
+	debug.GET("/pprof/:profile", gin.WrapF(pprof.Index))
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	return r
 }
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	suite.Run(t, new(DebugSuite))
+}
+
+type DebugSuite struct {
+	suite.Suite
+}
+
+func (suite *DebugSuite) TestRoutes() {
+	router := NewDebug(zerolog.Nop())
+
+	for target, contentType := range map[string]string{
+		"/debug/pprof/":             "text/html; charset=utf-8",
+		"/debug/pprof/cmdline":      "text/plain; charset=utf-8",
+		"/debug/pprof/heap?debug=1": "text/plain; charset=utf-8",
+		"/debug/vars":               "application/json; charset=utf-8",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		suite.Equal(http.StatusOK, w.Code, target)
+		suite.Equal(contentType, w.Header().Get("Content-Type"), target)
+		suite.NotEmpty(w.Header().Get("X-Request-ID"), target)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Contains(w.Body.String(), "go_goroutines")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof", nil))
+	suite.Equal(http.StatusMovedPermanently, w.Code)
+	suite.Equal("/debug/pprof/", w.Header().Get("Location"))
+}
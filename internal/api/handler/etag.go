@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/vcsfrl/xm/internal/model"
+	"strings"
+)
+
+// companyETag is the entity tag of a company representation, derived from its version.
+func companyETag(company *model.Company) string {
+	return fmt.Sprintf(`"%d"`, company.Version)
+}
+
+// ifMatch reports whether an If-Match header matches the entity tag, using the strong comparison.
+func ifMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifNoneMatch reports whether an If-None-Match header matches the entity tag, using the weak comparison.
+func ifNoneMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultEventStreamInterval = time.Second
+	eventStreamHeartbeat       = 15 * time.Second
+)
+
+// CompanyEventsHandler streams the change events of the companies as server-sent events.
+type CompanyEventsHandler struct {
+	ctx      context.Context
+	company  *service.Company
+	interval time.Duration
+}
+
+// NewCompanyEventsHandler returns a handler polling the new events every interval. The streams
+// end when ctx is done, so that they do not hold up the shutdown of the server.
+func NewCompanyEventsHandler(ctx context.Context, company *service.Company, interval time.Duration) *CompanyEventsHandler {
+	if interval <= 0 {
+		interval = DefaultEventStreamInterval
+	}
+
+	return &CompanyEventsHandler{ctx: ctx, company: company, interval: interval}
+}
+
+// Stream sends the company events as they happen, in the order they were committed, with their
+// sequence number as event ID.
+// A client reconnecting with the Last-Event-ID header, or the last_event_id query parameter,
+// resumes after that event; other clients only get the events following their connection.
+// The company_id and type query parameters, both repeatable, filter the events.
+func (h *CompanyEventsHandler) Stream(c *gin.Context) {
+	query := service.CompanyEventQuery{}
+	for _, value := range c.QueryArray("company_id") {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid company_id: "+value))
+			return
+		}
+		query.CompanyIDs = append(query.CompanyIDs, id)
+	}
+	for _, companyType := range c.QueryArray("type") {
+		query.Types = append(query.Types, model.CompanyType(companyType))
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid last event id: "+lastEventID))
+			return
+		}
+		query.AfterSequence = id
+	} else {
+		sequence, err := h.company.LastEventSequence(requestContext(c))
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		query.AfterSequence = sequence
+	}
+
+	ctx, cancel := context.WithCancel(requestContext(c))
+	defer cancel()
+	stop := context.AfterFunc(h.ctx, cancel)
+	defer stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	poll := time.NewTicker(h.interval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		for {
+			events, next, err := h.company.Events(ctx, query)
+			if err != nil {
+				// The response is already sent, the client reconnects with the last event it got.
+				if ctx.Err() == nil {
+					_ = c.Error(err)
+				}
+				return
+			}
+			for _, outboxEvent := range events {
+				if err := writeEvent(c.Writer, outboxEvent); err != nil {
+					return
+				}
+			}
+			if len(events) > 0 {
+				c.Writer.Flush()
+			}
+			if next == query.AfterSequence {
+				break
+			}
+			query.AfterSequence = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			// A comment, ignored by the clients, keeps the idle connections open through proxies.
+			if _, err := io.WriteString(c.Writer, ":\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-poll.C:
+		}
+	}
+}
+
+func writeEvent(w io.Writer, outboxEvent model.OutboxEvent) error {
+	err := sse.Encode(w, sse.Event{
+		Id:    strconv.FormatUint(*outboxEvent.Sequence, 10),
+		Event: outboxEvent.Type,
+		Data:  event.NewMessage(outboxEvent),
+	})
+	if err != nil {
+		return fmt.Errorf("write event %d: %w", outboxEvent.ID, err)
+	}
+
+	return nil
+}
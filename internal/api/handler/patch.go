@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/model"
+	"net/http"
+)
+
+const (
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// companyDocument is the representation of a company that patches apply to.
+// Unlike model.Company it has every field, so that patches can test and clear them.
+type companyDocument struct {
+	ID                uuid.UUID         `json:"ID"`
+	Name              string            `json:"Name"`
+	Description       string            `json:"Description"`
+	AmountOfEmployees int               `json:"AmountOfEmployees"`
+	Registered        bool              `json:"Registered"`
+	Type              model.CompanyType `json:"Type"`
+}
+
+// patchCompany applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) to the company.
+// The result is not validated; that is left to the service.
+func patchCompany(company *model.Company, contentType string, patch []byte) error {
+	document, err := json.Marshal(companyDocument{
+		ID:                company.ID,
+		Name:              company.Name,
+		Description:       company.Description,
+		AmountOfEmployees: company.AmountOfEmployees,
+		Registered:        company.Registered,
+		Type:              company.Type,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch contentType {
+	case ContentTypeMergePatch:
+		if !json.Valid(patch) {
+			return problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "Malformed merge patch.")
+		}
+		document, err = jsonpatch.MergePatch(document, patch)
+		if err != nil {
+			return problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err)
+		}
+	case ContentTypeJSONPatch:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err)
+		}
+		document, err = operations.Apply(document)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return problem.Wrap(http.StatusConflict, problem.CodePatchTestFailed, err)
+		}
+		if err != nil {
+			return problem.Wrap(http.StatusUnprocessableEntity, problem.CodeInvalidPatch, err)
+		}
+	default:
+		return fmt.Errorf("unsupported patch content type %q", contentType)
+	}
+
+	var patched companyDocument
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return problem.Wrap(http.StatusUnprocessableEntity, problem.CodeInvalidPatch, err)
+	}
+	if patched.ID != company.ID {
+		return problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidPatch, "The ID cannot be changed.")
+	}
+
+	company.Name = patched.Name
+	company.Description = patched.Description
+	company.AmountOfEmployees = patched.AmountOfEmployees
+	company.Registered = patched.Registered
+	company.Type = patched.Type
+
+	return nil
+}
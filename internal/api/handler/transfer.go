@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	"net/http"
+	"strconv"
+)
+
+// CompanyImportResponse sums up an import.
+type CompanyImportResponse struct {
+	DryRun  bool                 `json:"dry_run"`
+	Created int                  `json:"created"`
+	Updated int                  `json:"updated"`
+	Failed  int                  `json:"failed"`
+	Errors  []CompanyImportError `json:"errors"`
+}
+
+// CompanyImportError is the problem of a line of an import. Line numbers start at 1.
+type CompanyImportError struct {
+	Line  int             `json:"line"`
+	Error problem.Problem `json:"error"`
+}
+
+// Export streams the companies matching the list query parameters, without paging.
+// The format query parameter is csv (default), ndjson or json.
+func (ch *CompanyHandler) Export(c *gin.Context) {
+	format, err := service.ParseCompanyFormat(c.DefaultQuery("format", string(service.CompanyFormatCSV)))
+	if err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidQuery, err))
+		return
+	}
+
+	query, err := parseCompanyListQuery(c)
+	if err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidQuery, err))
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="companies.`+string(format)+`"`)
+	c.Status(http.StatusOK)
+	// Errors after the first page was written can only cut the response short.
+	if _, err := ch.company.Export(requestContext(c), c.Writer, format, query); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// Import creates the companies of the body. The format query parameter is csv, ndjson or json,
+// by default the one of the Content-Type. With dry_run=true nothing is saved, with upsert=true
+// the companies with a known name are updated, which needs the update permission.
+// Invalid lines do not fail the request, they are reported with their line numbers.
+func (ch *CompanyHandler) Import(c *gin.Context) {
+	format, err := importFormat(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var options service.CompanyImportOptions
+	for name, value := range map[string]*bool{"dry_run": &options.DryRun, "upsert": &options.Upsert} {
+		if parameter, ok := c.GetQuery(name); ok {
+			if *value, err = strconv.ParseBool(parameter); err != nil {
+				_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid "+name+": "+parameter))
+				return
+			}
+		}
+	}
+
+	if user, _ := middleware.Identity(c); options.Upsert && (user == nil || !user.Role.Can(model.PermissionCompanyUpdate)) {
+		_ = c.Error(problem.New(http.StatusForbidden, problem.CodeForbidden, "Missing permission "+string(model.PermissionCompanyUpdate)+"."))
+		return
+	}
+
+	result, err := ch.company.Import(requestContext(c), c.Request.Body, format, options)
+	if err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+		return
+	}
+
+	response := CompanyImportResponse{
+		DryRun:  options.DryRun,
+		Created: result.Created,
+		Updated: result.Updated,
+		Failed:  len(result.Errors),
+		Errors:  make([]CompanyImportError, 0, len(result.Errors)),
+	}
+	for _, lineError := range result.Errors {
+		response.Errors = append(response.Errors, CompanyImportError{Line: lineError.Line, Error: problem.FromError(lineError.Err)})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// importFormat returns the format of the format query parameter or of the Content-Type.
+func importFormat(c *gin.Context) (service.CompanyFormat, error) {
+	if value, ok := c.GetQuery("format"); ok {
+		format, err := service.ParseCompanyFormat(value)
+		if err != nil {
+			return "", problem.Wrap(http.StatusBadRequest, problem.CodeInvalidQuery, err)
+		}
+
+		return format, nil
+	}
+
+	for _, format := range []service.CompanyFormat{service.CompanyFormatCSV, service.CompanyFormatNDJSON, service.CompanyFormatJSON} {
+		if c.ContentType() == format.ContentType() {
+			return format, nil
+		}
+	}
+
+	return "", problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia, "Expected text/csv, application/x-ndjson or application/json.")
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	"net/http"
+	"strconv"
+)
+
+var errInvalidDeliveryID = problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid delivery ID.")
+
+// WebhookHandler serves the webhook administration endpoints.
+type WebhookHandler struct {
+	webhook *service.Webhook
+}
+
+func NewWebhookHandler(webhook *service.Webhook) *WebhookHandler {
+	return &WebhookHandler{webhook: webhook}
+}
+
+// Create registers a webhook. The response is the only one disclosing its secret.
+func (wh *WebhookHandler) Create(c *gin.Context) {
+	var request dto.WebhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+		return
+	}
+
+	webhook := model.Webhook{
+		URL:        request.URL,
+		Events:     request.Events,
+		CompanyIDs: request.CompanyIDs,
+		Secret:     request.Secret,
+	}
+	if err := wh.webhook.Create(requestContext(c), &webhook); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.WebhookCreatedResponse{Webhook: webhook, Secret: webhook.Secret})
+}
+
+func (wh *WebhookHandler) List(c *gin.Context) {
+	webhooks, err := wh.webhook.List(requestContext(c))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.WebhookListResponse{Items: webhooks})
+}
+
+func (wh *WebhookHandler) Get(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		_ = c.Error(errInvalidID)
+		return
+	}
+
+	webhook, err := wh.webhook.Get(requestContext(c), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+func (wh *WebhookHandler) Delete(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		_ = c.Error(errInvalidID)
+		return
+	}
+
+	if err := wh.webhook.Delete(requestContext(c), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// Deliveries lists the deliveries of a webhook, newest first; status=dead lists the dead-letter deliveries.
+func (wh *WebhookHandler) Deliveries(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		_ = c.Error(errInvalidID)
+		return
+	}
+
+	limit := 0
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, "invalid limit: "+value))
+			return
+		}
+	}
+
+	deliveries, err := wh.webhook.Deliveries(requestContext(c), id, c.Query("status"), limit, c.Query("cursor"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.WebhookDeliveryListResponse{
+		Items:      deliveries.Items,
+		NextCursor: deliveries.NextCursor,
+	})
+}
+
+// Redeliver schedules a delivery again, typically a dead one once the receiver is fixed.
+func (wh *WebhookHandler) Redeliver(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		_ = c.Error(errInvalidID)
+		return
+	}
+	deliveryID, err := strconv.ParseUint(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		_ = c.Error(errInvalidDeliveryID)
+		return
+	}
+
+	delivery, err := wh.webhook.Redeliver(requestContext(c), id, deliveryID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
@@ -1,26 +1,35 @@
 package middleware
 
 import (
+	"errors"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/api/problem"
 	"github.com/vcsfrl/xm/internal/config"
 	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/metrics"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"net/http"
 	"time"
 )
 
 const identityKey = "id"
+const roleKey = "role"
 
 type AuthenticationManager struct {
 	AuthMiddleware *jwt.GinJWTMiddleware
 	config         *config.Config
 	logger         zerolog.Logger
+	users          *service.User
 }
 
-func NewAuthenticationManager(config *config.Config, logger zerolog.Logger) (*AuthenticationManager, error) {
+func NewAuthenticationManager(config *config.Config, logger zerolog.Logger, users *service.User) (*AuthenticationManager, error) {
 	var err error
 
-	result := &AuthenticationManager{config: config, logger: logger}
+	result := &AuthenticationManager{config: config, logger: logger, users: users}
 	result.AuthMiddleware, err = jwt.New(result.buildMiddleware())
 	if err != nil {
 		return nil, err
@@ -62,6 +71,7 @@ func (am *AuthenticationManager) payloadFunc() func(data interface{}) jwt.MapCla
 		if v, ok := data.(*dto.AuthUser); ok {
 			return jwt.MapClaims{
 				identityKey: v.Username,
+				roleKey:     string(v.Role),
 			}
 		}
 		return jwt.MapClaims{}
@@ -71,8 +81,10 @@ func (am *AuthenticationManager) payloadFunc() func(data interface{}) jwt.MapCla
 func (am *AuthenticationManager) identityHandler() func(c *gin.Context) interface{} {
 	return func(c *gin.Context) interface{} {
 		claims := jwt.ExtractClaims(c)
+		role, _ := claims[roleKey].(string)
 		return &dto.AuthUser{
 			Username: claims[identityKey].(string),
+			Role:     model.Role(role),
 		}
 	}
 }
@@ -84,34 +96,147 @@ func (am *AuthenticationManager) authenticator() func(c *gin.Context) (interface
 		if err := c.ShouldBind(&loginVals); err != nil {
 			return "", jwt.ErrMissingLoginValues
 		}
-		userName := loginVals.Username
-		password := loginVals.Password
 
-		if userName == am.config.AuthUser && password == am.config.AuthPassword {
-			return &dto.AuthUser{
-				Username: userName,
-			}, nil
+		return am.authenticate(loginVals.Username, loginVals.Password)
+	}
+}
+
+func (am *AuthenticationManager) authenticate(username string, password string) (*dto.AuthUser, error) {
+	user, err := am.users.Authenticate(username, password)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+		if !errors.Is(err, service.ErrInvalidCredentials) {
+			am.logger.Error().Err(err).Msg("Authenticate user.")
 		}
 		return nil, jwt.ErrFailedAuthentication
 	}
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
+
+	return &dto.AuthUser{
+		ID:       user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+	}, nil
 }
 
-// authorizator is the function that checks if the user is authorized to access the resource
+// authorizator is the function that checks if the user is authorized to access the resource.
+// Tokens of removed users, or issued before a role change, are rejected.
 func (am *AuthenticationManager) authorizator() func(data interface{}, c *gin.Context) bool {
 	return func(data interface{}, c *gin.Context) bool {
-		if v, ok := data.(*dto.AuthUser); ok && v.Username == am.config.AuthUser {
-			return true
+		v, ok := data.(*dto.AuthUser)
+		if !ok {
+			return false
+		}
+
+		return am.authorize(v)
+	}
+}
+
+func (am *AuthenticationManager) authorize(v *dto.AuthUser) bool {
+	user, err := am.users.Get(v.Username)
+	if err != nil {
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			am.logger.Error().Err(err).Msg("Authorize user.")
 		}
 		return false
 	}
+	if user.Role != v.Role {
+		return false
+	}
+	v.ID = user.ID
+
+	return true
+}
+
+// Login returns a token for the credentials, the one of the login route, to the APIs not served by gin.
+func (am *AuthenticationManager) Login(username string, password string) (string, time.Time, error) {
+	user, err := am.authenticate(username, password)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return am.AuthMiddleware.TokenGenerator(user)
+}
+
+// Authenticate returns the user of a token of the login route, to the APIs not served by gin.
+// Like the routes, it rejects the tokens of removed users, or issued before a role change.
+func (am *AuthenticationManager) Authenticate(token string) (*dto.AuthUser, error) {
+	parsed, err := am.AuthMiddleware.ParseTokenString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.ExtractClaimsFromToken(parsed)
+	username, _ := claims[identityKey].(string)
+	role, _ := claims[roleKey].(string)
+	user := &dto.AuthUser{Username: username, Role: model.Role(role)}
+	if username == "" || !am.authorize(user) {
+		return nil, jwt.ErrForbidden
+	}
+
+	return user, nil
+}
+
+// Identity returns the authenticated user of the request, if any.
+func Identity(c *gin.Context) (*dto.AuthUser, bool) {
+	identity, ok := c.Get(identityKey)
+	if !ok {
+		return nil, false
+	}
+
+	user, ok := identity.(*dto.AuthUser)
+	return user, ok
+}
+
+// RequirePermission aborts with 403 when the role of the authenticated user lacks the permission.
+// It must run after AuthMiddleware.MiddlewareFunc.
+func (am *AuthenticationManager) RequirePermission(permission model.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := Identity(c)
+		if !ok {
+			am.unauthorized()(c, http.StatusUnauthorized, jwt.ErrForbidden.Error())
+			c.Abort()
+			return
+		}
+
+		if !user.Role.Can(permission) {
+			am.unauthorized()(c, http.StatusForbidden, "Missing permission "+string(permission)+".")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermissionIf authenticates the request and requires the permission only when the
+// condition holds, so that a public route can offer privileged options.
+func (am *AuthenticationManager) RequirePermissionIf(condition func(c *gin.Context) bool, permission model.Permission) gin.HandlersChain {
+	authenticate := am.AuthMiddleware.MiddlewareFunc()
+	require := am.RequirePermission(permission)
+
+	return gin.HandlersChain{
+		func(c *gin.Context) {
+			if condition(c) {
+				authenticate(c)
+			}
+		},
+		func(c *gin.Context) {
+			if condition(c) {
+				require(c)
+			}
+		},
+	}
 }
 
 // unauthorized is the function that handles unauthorized access
 func (am *AuthenticationManager) unauthorized() func(c *gin.Context, code int, message string) {
 	return func(c *gin.Context, code int, message string) {
-		c.JSON(code, gin.H{
-			"code":    code,
-			"message": message,
-		})
+		problemCode := problem.CodeUnauthorized
+		if code == http.StatusForbidden {
+			problemCode = problem.CodeForbidden
+		}
+
+		problem.RenderError(c, problem.New(code, problemCode, message))
 	}
 }
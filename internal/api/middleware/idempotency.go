@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/service"
+	"io"
+	"net/http"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// replayedHeaders are the response headers stored with the response of an idempotent request.
+var replayedHeaders = []string{"Content-Type", "ETag"}
+
+// Idempotency replays the stored response of a request sent again with the same
+// Idempotency-Key header, and rejects a key reused with a different body.
+// Keys are scoped to the authenticated user and the route; only successful
+// responses are stored, failed requests can be retried with the same key.
+// It must run after AuthMiddleware.MiddlewareFunc.
+func Idempotency(idempotency *service.Idempotency, logger zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			_ = c.Error(problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "Idempotency-Key is too long."))
+			c.Abort()
+			return
+		}
+
+		body, err := c.GetRawData()
+		if err != nil {
+			_ = c.Error(problem.Wrap(http.StatusBadRequest, problem.CodeInvalidRequest, err))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		scope := c.Request.Method + " " + c.FullPath()
+		if user, ok := Identity(c); ok {
+			scope = user.Username + " " + scope
+		}
+
+		stored, err := idempotency.Begin(c.Request.Context(), scope, key, hex.EncodeToString(hash[:]))
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if stored != nil {
+			for name, value := range stored.Headers {
+				c.Header(name, value)
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.Status, stored.Headers["Content-Type"], stored.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		// The outcome is saved even when the client went away, so that its retry finds it.
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := writer.Status()
+		if writer.Written() && status >= http.StatusOK && status < http.StatusMultipleChoices {
+			headers := map[string]string{}
+			for _, name := range replayedHeaders {
+				if value := writer.Header().Get(name); value != "" {
+					headers[name] = value
+				}
+			}
+			if err := idempotency.Complete(ctx, scope, key, status, headers, writer.body.Bytes()); err != nil {
+				logger.Error().Err(err).Msg("Complete idempotent request.")
+			}
+			return
+		}
+
+		if err := idempotency.Release(ctx, scope, key); err != nil {
+			logger.Error().Err(err).Msg("Release idempotency key.")
+		}
+	}
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
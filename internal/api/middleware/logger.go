@@ -1,56 +1,111 @@
 package middleware
 
 import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"github.com/vcsfrl/xm/internal/service"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"regexp"
 	"runtime/debug"
 	"time"
-
-	chiMiddleware "github.com/go-chi/chi/v5/middleware"
-	"github.com/rs/zerolog"
 )
 
-func LoggerMiddleware(logger zerolog.Logger) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, r *http.Request) {
-			log := logger.With().Logger()
-
-			ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-			t1 := time.Now()
-			defer func() {
-				t2 := time.Now()
-
-				// Recover and record stack traces in case of a panic
-				if rec := recover(); rec != nil {
-					log.Error().
-						Str("type", "error").
-						Timestamp().
-						Interface("recover_info", rec).
-						Bytes("debug_stack", debug.Stack()).
-						Msg("log system error")
-					http.Error(ww, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-				}
-
-				// log end request
-				log.Info().
-					Str("type", "access").
-					Timestamp().
-					Fields(map[string]interface{}{
-						"remote_ip":  r.RemoteAddr,
-						"url":        r.URL.Path,
-						"proto":      r.Proto,
-						"method":     r.Method,
-						"user_agent": r.Header.Get("User-Agent"),
-						"status":     ww.Status(),
-						"latency_ms": float64(t2.Sub(t1).Nanoseconds()) / 1000000.0,
-						"bytes_in":   r.Header.Get("Content-Length"),
-						"bytes_out":  ww.BytesWritten(),
-					}).
-					Msg("incoming_request")
-			}()
-
-			next.ServeHTTP(ww, r)
+// RequestIDHeader carries the ID of a request, from the client or assigned, in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern accepts the IDs of the clients that fit in the audit records and cannot break
+// the log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,100}$`)
+
+// Logger assigns every request an ID, the X-Request-ID header when valid or else a new UUID,
+// echoes it in the response and puts it, with a logger carrying it, in the context of the request.
+// Once the request is served, it writes an access log line.
+func Logger(logger zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startedAt := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		fields := logger.With().Str("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			fields = fields.Str("trace_id", spanContext.TraceID().String())
+		}
+		requestLogger := fields.Logger()
+		ctx := service.WithRequestID(requestLogger.WithContext(c.Request.Context()), requestID)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := c.Writer.Status()
+		event := requestLogger.Info()
+		if status >= http.StatusInternalServerError {
+			event = requestLogger.Error()
 		}
-		return http.HandlerFunc(fn)
+		if user, ok := Identity(c); ok {
+			event = event.Str("user", user.Username)
+		}
+		event.
+			Str("type", "access").
+			Str("method", c.Request.Method).
+			Str("route", route).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Float64("latency_ms", float64(time.Since(startedAt).Microseconds())/1000).
+			Int64("bytes_in", max(c.Request.ContentLength, 0)).
+			Int("bytes_out", max(c.Writer.Size(), 0)).
+			Str("remote_ip", c.ClientIP()).
+			Str("user_agent", c.Request.UserAgent()).
+			Msg("Request served.")
+	}
+}
+
+// Recovery answers the requests whose handler panicked with an internal error problem and logs the
+// panic with its stack. It must run after Logger, to log on the logger of the request.
+func Recovery(logger zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// The server aborts the response on purpose.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			requestLogger(c, logger).Error().
+				Str("type", "panic").
+				Str("panic", fmt.Sprint(recovered)).
+				Str("stack", string(debug.Stack())).
+				Str("method", c.Request.Method).
+				Str("path", c.Request.URL.Path).
+				Msg("Recover from panic.")
+			if !c.Writer.Written() {
+				problem.Render(c, problem.FromError(fmt.Errorf("panic: %v", recovered)))
+			}
+			c.Abort()
+		}()
+
+		c.Next()
 	}
 }
+
+// requestLogger returns the logger put in the context of the request by Logger, or logger.
+func requestLogger(c *gin.Context, logger zerolog.Logger) *zerolog.Logger {
+	if contextLogger := zerolog.Ctx(c.Request.Context()); contextLogger.GetLevel() != zerolog.Disabled {
+		return contextLogger
+	}
+
+	return &logger
+}
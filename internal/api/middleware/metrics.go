@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vcsfrl/xm/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels the requests of no route, so that unknown paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts and times the requests by route template, e.g. /api/v1/company/:id, and status.
+// It must run before the middlewares writing the responses, to observe their final status.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startedAt := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(startedAt).Seconds())
+	}
+}
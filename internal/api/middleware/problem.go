@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"net/http"
+)
+
+// Problems renders the last error a handler attached with c.Error as problem details,
+// unless the handler already wrote a response. Internal errors are logged, on the logger of the
+// request when Logger runs before.
+func Problems(logger zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		result := problem.FromError(err)
+		if result.Status >= http.StatusInternalServerError {
+			requestLogger(c, logger).Error().Err(err).Str("method", c.Request.Method).Str("path", c.Request.URL.Path).Msg("Handle request.")
+		}
+
+		problem.Render(c, result)
+	}
+}
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/vcsfrl/xm/internal/api/problem"
 	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/metrics"
 	"golang.org/x/time/rate"
 	"net/http"
 )
@@ -14,7 +16,8 @@ func RateLimiter(config *config.Config) func(c *gin.Context) {
 
 	return func(c *gin.Context) {
 		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+			metrics.RateLimited.Inc()
+			problem.RenderError(c, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests."))
 			c.Abort()
 			return
 		}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vcsfrl/xm/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Tracing starts a server span for every request, continuing the trace of its traceparent header,
+// and records the authenticated user on it. The spans are exported by the tracer provider
+// installed by tracing.Init.
+func Tracing() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		otelgin.Middleware(tracing.ServiceName, otelgin.WithPropagators(tracing.Propagator)),
+		func(c *gin.Context) {
+			// The user is only known once the authentication middlewares ran.
+			ctx := c.Request.Context()
+			c.Next()
+
+			if user, ok := Identity(c); ok {
+				tracing.SetUsername(ctx, user.Username)
+			}
+		},
+	}
+}
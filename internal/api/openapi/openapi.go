@@ -0,0 +1,45 @@
+// Package openapi serves the OpenAPI description of the REST API and a page rendering it.
+package openapi
+
+import (
+	"embed"
+	"github.com/gin-gonic/gin"
+	"github.com/vcsfrl/xm/internal/api/problem"
+	"net/http"
+)
+
+// Document is the OpenAPI 3.1 description of the routes of the REST API.
+// Paths are relative to the /api/v1 server URL.
+//
+//go:embed openapi.json
+var Document []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// redoc holds the Redoc bundle rendering the page, see redoc/README.md.
+//
+//go:embed redoc
+var redoc embed.FS
+
+// Spec serves the OpenAPI document.
+func Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", Document)
+}
+
+// Docs serves a page that renders the OpenAPI document.
+func Docs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
+
+// Redoc serves the script of the docs page, answering 404 when the bundle was not downloaded
+// before the build.
+func Redoc(c *gin.Context) {
+	bundle, err := redoc.ReadFile("redoc/redoc.standalone.js")
+	if err != nil {
+		_ = c.Error(problem.New(http.StatusNotFound, problem.CodeNotFound, "Redoc is not bundled, see make redoc."))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/javascript; charset=utf-8", bundle)
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/api/openapi"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/model"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// openapiActions are the custom methods dispatched by the /company:action route.
+var openapiActions = []string{"batch"}
+
+var openapiPathParameter = regexp.MustCompile(`\{(\w+)}`)
+
+func (suite *RestApiTestSuite) TestOpenAPI_Routes() {
+	spec := suite.openapiSpec()
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	routes := map[string]bool{}
+	for _, route := range router.Routes() {
+		path, found := strings.CutPrefix(route.Path, "/api/v1")
+		suite.True(found, route.Path)
+		path = regexp.MustCompile(`/:(\w+)`).ReplaceAllString(path, "/{$1}")
+		paths := []string{path}
+		if strings.HasSuffix(path, ":action") {
+			paths = nil
+			for _, action := range openapiActions {
+				paths = append(paths, strings.TrimSuffix(path, "action")+action)
+			}
+		}
+		for _, path := range paths {
+			routes[route.Method+" "+path] = true
+			suite.NotNil(spec.operation(route.Method, path), "%s %s is not documented", route.Method, path)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			suite.True(routes[strings.ToUpper(method)+" "+path], "%s %s is not routed", method, path)
+		}
+	}
+}
+
+func (suite *RestApiTestSuite) TestOpenAPI_Document() {
+	spec := suite.openapiSpec()
+	suite.Equal("3.1.0", spec.OpenAPI)
+	suite.Equal(map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+		filterKeys(spec.Components["securitySchemes"]["bearerAuth"], "type", "scheme", "bearerFormat"))
+
+	var document any
+	suite.NoError(json.Unmarshal(openapi.Document, &document))
+	for _, ref := range references(document) {
+		name, found := strings.CutPrefix(ref, "#/components/")
+		suite.True(found, ref)
+		kind, name, _ := strings.Cut(name, "/")
+		suite.Contains(spec.Components[kind], name, "%s does not resolve", ref)
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			declared := map[string]bool{}
+			for _, parameter := range spec.parameters(method, path) {
+				if parameter["in"] == "path" {
+					suite.Equal(true, parameter["required"], "%s %s: %s", method, path, parameter["name"])
+					declared[parameter["name"].(string)] = true
+				}
+			}
+			for _, match := range openapiPathParameter.FindAllStringSubmatch(path, -1) {
+				suite.True(declared[match[1]], "%s %s does not declare %s", method, path, match[1])
+			}
+		}
+	}
+
+	company := spec.Components["schemas"]["Company"].(map[string]any)
+	var fields []string
+	for _, field := range reflect.VisibleFields(reflect.TypeFor[dto.Company]()) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name != "-" && !field.Anonymous {
+			fields = append(fields, name)
+		}
+	}
+	var properties []string
+	for property := range company["properties"].(map[string]any) {
+		properties = append(properties, property)
+	}
+	suite.ElementsMatch(fields, properties)
+
+	var types []model.CompanyType
+	for _, companyType := range spec.Components["schemas"]["CompanyType"].(map[string]any)["enum"].([]any) {
+		types = append(types, model.CompanyType(companyType.(string)))
+	}
+	suite.Equal(model.CompanyTypes, types)
+}
+
+// TestOpenAPI_Responses sends a bare request to every operation, without and with a token, and
+// checks that the answer is documented.
+func (suite *RestApiTestSuite) TestOpenAPI_Responses() {
+	spec := suite.openapiSpec()
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+	loginResponse := suite.authenticate(suite.loginRequest())
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			operation := spec.operation(method, path)
+			target := "/api/v1" + openapiPathParameter.ReplaceAllString(path, uuid.NewString())
+
+			for _, token := range []string{"", loginResponse.Token} {
+				// The event stream only ends with its request.
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				req, _ := http.NewRequestWithContext(ctx, strings.ToUpper(method), target, nil)
+				if token != "" {
+					req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				cancel()
+
+				name := fmt.Sprintf("%s %s (token: %t)", method, path, token != "")
+				if token == "" && operation.requiresToken() {
+					suite.Equal(http.StatusUnauthorized, w.Code, name)
+				}
+				response, found := operation.Responses[fmt.Sprint(w.Code)]
+				if !suite.True(found, "%s: %d is not documented", name, w.Code) {
+					continue
+				}
+				response = spec.resolve(response)
+				if w.Body.Len() == 0 {
+					continue
+				}
+				contentType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+				suite.NoError(err, name)
+				suite.Contains(response["content"], contentType, "%s: %d %s is not documented", name, w.Code, contentType)
+			}
+		}
+	}
+}
+
+func (suite *RestApiTestSuite) TestOpenAPI_Serve() {
+	router, err := suite.companyApi.BuildRouter()
+	suite.NoError(err)
+
+	req, _ := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("application/json", w.Header().Get("Content-Type"))
+	suite.JSONEq(string(openapi.Document), w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/api/v1/docs", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Contains(w.Body.String(), `spec-url="openapi.json"`)
+	// The page loads no third party script.
+	suite.NotContains(w.Body.String(), "://")
+
+	req, _ = http.NewRequest("GET", "/api/v1/docs/redoc.standalone.js", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("text/javascript; charset=utf-8", w.Header().Get("Content-Type"))
+	suite.NotEmpty(w.Body.Bytes())
+}
+
+type openapiSpec struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components map[string]map[string]any             `json:"components"`
+}
+
+type openapiOperation struct {
+	Security   []map[string][]string     `json:"security"`
+	Parameters []map[string]any          `json:"parameters"`
+	Responses  map[string]map[string]any `json:"responses"`
+}
+
+// requiresToken tells whether the operation has no anonymous security requirement.
+func (o *openapiOperation) requiresToken() bool {
+	return len(o.Security) > 0 && !slices.ContainsFunc(o.Security, func(requirement map[string][]string) bool {
+		return len(requirement) == 0
+	})
+}
+
+func (suite *RestApiTestSuite) openapiSpec() *openapiSpec {
+	var spec openapiSpec
+	suite.Require().NoError(json.Unmarshal(openapi.Document, &spec))
+
+	return &spec
+}
+
+func (s *openapiSpec) operation(method string, path string) *openapiOperation {
+	raw, found := s.Paths[path][strings.ToLower(method)]
+	if !found {
+		return nil
+	}
+	var operation openapiOperation
+	if err := json.Unmarshal(raw, &operation); err != nil {
+		return nil
+	}
+
+	return &operation
+}
+
+// parameters returns the resolved parameters of the path and of the operation.
+func (s *openapiSpec) parameters(method string, path string) []map[string]any {
+	var parameters []map[string]any
+	if raw, found := s.Paths[path]["parameters"]; found {
+		_ = json.Unmarshal(raw, &parameters)
+	}
+	if operation := s.operation(method, path); operation != nil {
+		parameters = append(parameters, operation.Parameters...)
+	}
+	for i, parameter := range parameters {
+		parameters[i] = s.resolve(parameter)
+	}
+
+	return parameters
+}
+
+func (s *openapiSpec) resolve(object map[string]any) map[string]any {
+	ref, found := object["$ref"].(string)
+	if !found {
+		return object
+	}
+	kind, name, _ := strings.Cut(strings.TrimPrefix(ref, "#/components/"), "/")
+	resolved, _ := s.Components[kind][name].(map[string]any)
+
+	return resolved
+}
+
+// references returns all the $ref values of a JSON document.
+func references(document any) []string {
+	var refs []string
+	switch value := document.(type) {
+	case map[string]any:
+		for key, child := range value {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				refs = append(refs, ref)
+				continue
+			}
+			refs = append(refs, references(child)...)
+		}
+	case []any:
+		for _, child := range value {
+			refs = append(refs, references(child)...)
+		}
+	}
+
+	return refs
+}
+
+func filterKeys(object any, keys ...string) map[string]any {
+	filtered := map[string]any{}
+	for key, value := range object.(map[string]any) {
+		if slices.Contains(keys, key) {
+			filtered[key] = value
+		}
+	}
+
+	return filtered
+}
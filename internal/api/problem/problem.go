@@ -0,0 +1,144 @@
+// Package problem renders API errors as RFC 7807 problem details.
+//
+// Every problem carries a stable code, which clients should match on instead of the
+// human readable title and detail.
+package problem
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/vcsfrl/xm/internal/service"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Stable problem codes.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeInvalidQuery       = "invalid_query"
+	CodeValidationFailed   = "validation_failed"
+	CodeInvalidPatch       = "invalid_patch"
+	CodePatchTestFailed    = "patch_test_failed"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeDuplicateName      = "duplicate_name"
+	CodeDeletedName        = "deleted_name"
+	CodeVersionConflict    = "version_conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeIdempotencyReused  = "idempotency_key_reused"
+	CodeIdempotencyInUse   = "idempotency_key_in_use"
+	CodeConflict           = "conflict"
+	CodeBatchAborted       = "batch_aborted"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+// Problem is the body of an error response.
+type Problem struct {
+	Type     string               `json:"type"`
+	Title    string               `json:"title"`
+	Status   int                  `json:"status"`
+	Detail   string               `json:"detail,omitempty"`
+	Instance string               `json:"instance,omitempty"`
+	Code     string               `json:"code"`
+	Errors   []service.FieldError `json:"errors,omitempty"`
+}
+
+// Error is an error raised by the API layer itself, with its status and code.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Err    error
+}
+
+func New(status int, code string, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Wrap returns an error with the status and code that keeps err in its chain.
+func Wrap(status int, code string, err error) *Error {
+	return &Error{Status: status, Code: code, Detail: err.Error(), Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// FromError maps an error to its problem. Unknown errors are internal errors,
+// whose details are not disclosed.
+func FromError(err error) Problem {
+	var apiError *Error
+	var validationError *service.ValidationError
+	switch {
+	case errors.As(err, &apiError):
+		return newProblem(apiError.Status, apiError.Code, apiError.Detail)
+	case errors.As(err, &validationError):
+		detail := "The company has invalid fields."
+		if errors.Is(err, service.ErrWebhookService) {
+			detail = "The webhook has invalid fields."
+		}
+		result := newProblem(http.StatusUnprocessableEntity, CodeValidationFailed, detail)
+		result.Errors = validationError.Fields
+		return result
+	case errors.Is(err, service.ErrInvalidBatch), errors.Is(err, service.ErrInvalidImport),
+		errors.Is(err, service.ErrInvalidLine), errors.Is(err, service.ErrUnknownFormat):
+		return newProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, service.ErrBatchAborted):
+		return newProblem(http.StatusFailedDependency, CodeBatchAborted, "Not applied because another operation of the batch failed.")
+	case errors.Is(err, service.ErrInvalidListQuery):
+		return newProblem(http.StatusBadRequest, CodeInvalidQuery, err.Error())
+	case errors.Is(err, service.ErrWebhookNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, "Webhook not found.")
+	case errors.Is(err, service.ErrWebhookDeliveryNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, "Webhook delivery not found.")
+	case errors.Is(err, service.ErrNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, "Company not found.")
+	case errors.Is(err, service.ErrDeletedName):
+		return newProblem(http.StatusConflict, CodeDeletedName, "A deleted company has this name, restore it first.")
+	case errors.Is(err, service.ErrDuplicateName):
+		return newProblem(http.StatusConflict, CodeDuplicateName, "A company with this name already exists.")
+	case errors.Is(err, service.ErrVersionConflict):
+		return newProblem(http.StatusConflict, CodeVersionConflict, "Company was modified.")
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		return newProblem(http.StatusUnprocessableEntity, CodeIdempotencyReused, "The Idempotency-Key was used with a different request.")
+	case errors.Is(err, service.ErrIdempotencyKeyInUse):
+		return newProblem(http.StatusConflict, CodeIdempotencyInUse, "A request with this Idempotency-Key is in progress.")
+	case errors.Is(err, service.ErrConflict):
+		return newProblem(http.StatusConflict, CodeConflict, "")
+	default:
+		return newProblem(http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+// RenderError writes the problem of the error as the response.
+func RenderError(c *gin.Context, err error) {
+	Render(c, FromError(err))
+}
+
+// Render writes the problem as the response.
+func Render(c *gin.Context, problem Problem) {
+	if problem.Instance == "" {
+		problem.Instance = c.Request.URL.Path
+	}
+
+	c.Header("Content-Type", ContentType)
+	c.JSON(problem.Status, problem)
+}
+
+func newProblem(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
@@ -1,12 +1,49 @@
 package config
 
+import "time"
+
 type Config struct {
 	AppPort       string
+	GrpcPort      string
 	TracePort     string
+	HealthPort    string
 	AuthUser      string
 	AuthPassword  string
 	AuthJwtSecret string
+	DbDriver      string
 	DbPath        string
-	RateLimit     float64
-	RateBurst     int
+	DbDsn         string
+
+	DbLogLevel           string
+	DbSlowQueryThreshold time.Duration
+	DbLogParameters      bool
+
+	RateLimit float64
+	RateBurst int
+
+	EventPublisher        string
+	EventFilePath         string
+	EventDispatchInterval time.Duration
+	EventMaxAttempts      int
+	EventStreamInterval   time.Duration
+	KafkaBrokers          string
+	KafkaTopic            string
+
+	PurgeRetentionDays int
+	PurgeInterval      time.Duration
+
+	IdempotencyKeyTTL time.Duration
+
+	WebhookDispatchInterval time.Duration
+	WebhookMaxAttempts      int
+	WebhookWorkers          int
+	WebhookAllowedNetworks  string
+
+	TracingEndpoint    string
+	TracingSampleRatio float64
+
+	HealthMaxEventLag   time.Duration
+	HealthMinFreeDiskMb int
+
+	ShutdownDelay time.Duration
 }
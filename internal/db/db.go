@@ -1,29 +1,69 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
 	"github.com/vcsfrl/xm/internal/config"
-	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/migration"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
-func InitSqlite(config *config.Config) (*gorm.DB, error) {
+const (
+	DriverSqlite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var (
+	ErrUnknownDriver = errors.New("unknown database driver")
+	// ErrSqliteFts5 is returned when the binary was built without the sqlite_fts5 tag, the company
+	// search index needs FTS5.
+	ErrSqliteFts5 = errors.New("SQLite is built without FTS5, build with -tags sqlite_fts5")
+)
+
+// Init opens the database selected by the configured driver. The queries are logged to logger.
+func Init(config *config.Config, logger gormlogger.Interface) (*gorm.DB, error) {
+	switch config.DbDriver {
+	case DriverSqlite, "":
+		return InitSqlite(config, logger)
+	case DriverPostgres:
+		return InitPostgres(config, logger)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, config.DbDriver)
+	}
+}
+
+func InitSqlite(config *config.Config, logger gormlogger.Interface) (*gorm.DB, error) {
 	var err error
 	var db *gorm.DB
 
-	// TODO integrate zerolog
-	//gormLogger := gormzerolog.NewGormLogger().WithInfo(func() gormzerolog.Event {
-	//	return &gormzerolog.GormLoggerEvent{Event: logger.Info()}
-	//})
+	dsn := config.DbPath
+	if config.DbDsn != "" {
+		dsn = config.DbDsn
+	}
 
-	db, err = gorm.Open(sqlite.Open(config.DbPath), &gorm.Config{
-		Logger: nil,
+	db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger,
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, err
 	}
+	if err := checkSqliteFts5(db); err != nil {
+		return nil, err
+	}
 
-	err = db.AutoMigrate(&model.Company{})
+	return db, nil
+}
+
+func InitPostgres(config *config.Config, logger gormlogger.Interface) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(config.DbDsn), &gorm.Config{
+		Logger:         logger,
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -31,17 +71,46 @@ func InitSqlite(config *config.Config) (*gorm.DB, error) {
 	return db, nil
 }
 
+// InitTestSqlite opens an in-memory database with every migration applied.
 func InitTestSqlite() (*gorm.DB, error) {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
-		Logger: nil,
+		Logger:         nil,
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, err
 	}
-	err = db.AutoMigrate(&model.Company{})
+	// Every connection to :memory: opens a new empty database, the concurrent requests must share one.
+	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := checkSqliteFts5(db); err != nil {
+		return nil, err
+	}
+
+	migrator, err := migration.NewMigrator(db, zerolog.Nop())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(0); err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
+
+// checkSqliteFts5 fails when the SQLite library lacks FTS5, rather than the migration creating the
+// search index.
+func checkSqliteFts5(db *gorm.DB) error {
+	var enabled bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return fmt.Errorf("check FTS5: %w", err)
+	}
+	if !enabled {
+		return ErrSqliteFts5
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/config"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+var ErrUnknownLogLevel = errors.New("unknown database log level")
+
+// logLevels are the values of XM_DB_LOG_LEVEL, from the quietest.
+var logLevels = map[string]gormlogger.LogLevel{
+	"silent": gormlogger.Silent,
+	"error":  gormlogger.Error,
+	"warn":   gormlogger.Warn,
+	"info":   gormlogger.Info,
+}
+
+// Logger writes the GORM logs to zerolog: the failed queries as errors, the slow queries as
+// warnings and, at the info level, every query.
+type Logger struct {
+	logger        zerolog.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+	parameters    bool
+	requestID     func(ctx context.Context) string
+}
+
+// NewLogger returns a logger of the queries configured by XM_DB_LOG_LEVEL, XM_DB_SLOW_QUERY_THRESHOLD
+// and XM_DB_LOG_PARAMETERS. The values of the queries are redacted unless XM_DB_LOG_PARAMETERS is set.
+// requestID, if not nil, returns the ID of the request of a query, to correlate them.
+func NewLogger(logger zerolog.Logger, config *config.Config, requestID func(ctx context.Context) string) (*Logger, error) {
+	level := gormlogger.Warn
+	if config.DbLogLevel != "" {
+		var found bool
+		level, found = logLevels[strings.ToLower(config.DbLogLevel)]
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownLogLevel, config.DbLogLevel)
+		}
+	}
+
+	slowThreshold := config.DbSlowQueryThreshold
+	if slowThreshold == 0 {
+		slowThreshold = DefaultSlowQueryThreshold
+	}
+
+	return &Logger{
+		logger:        logger.With().Str("component", "db").Logger(),
+		level:         level,
+		slowThreshold: slowThreshold,
+		parameters:    config.DbLogParameters,
+		requestID:     requestID,
+	}, nil
+}
+
+func (l *Logger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	logger := *l
+	logger.level = level
+
+	return &logger
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.event(ctx, l.logger.Info()).Msgf(msg, data...)
+	}
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.event(ctx, l.logger.Warn()).Msgf(msg, data...)
+	}
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.event(ctx, l.logger.Error()).Msgf(msg, data...)
+	}
+}
+
+// Trace logs a query once it ran. A missing record is not an error, the services answer it with a 404.
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	var event *zerolog.Event
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		event, msg = l.logger.Error().Err(err), "Query failed."
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= gormlogger.Warn:
+		event, msg = l.logger.Warn().Dur("threshold", l.slowThreshold), "Slow query."
+	case l.level >= gormlogger.Info:
+		event, msg = l.logger.Info(), "Query."
+	default:
+		return
+	}
+
+	sql, rows := fc()
+	event = event.Str("sql", sql).Dur("elapsed", elapsed).Str("caller", caller())
+	if rows >= 0 {
+		event = event.Int64("rows", rows)
+	}
+	l.event(ctx, event).Msg(msg)
+}
+
+// ParamsFilter leaves the placeholders of the values in the logged queries, unless the values are logged.
+func (l *Logger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.parameters {
+		return sql, params
+	}
+
+	return sql, nil
+}
+
+// event adds the request and the trace of the query, if any.
+func (l *Logger) event(ctx context.Context, event *zerolog.Event) *zerolog.Event {
+	if ctx == nil {
+		return event
+	}
+	if l.requestID != nil {
+		if requestID := l.requestID(ctx); requestID != "" {
+			event = event.Str("request_id", requestID)
+		}
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		event = event.Str("trace_id", spanContext.TraceID().String()).Str("span_id", spanContext.SpanID().String())
+	}
+
+	return event
+}
+
+// caller returns the file and line of the code running the query, the first frame out of GORM and
+// of this logger.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "gorm.io/") && !strings.Contains(frame.Function, "internal/db.(*Logger)") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/model"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	suite.Run(t, new(LoggerFixture))
+}
+
+type LoggerFixture struct {
+	suite.Suite
+	output *bytes.Buffer
+}
+
+type requestIDKey struct{}
+
+func (lf *LoggerFixture) SetupTest() {
+	lf.output = &bytes.Buffer{}
+}
+
+func (lf *LoggerFixture) TestTrace_Error() {
+	database := lf.open(&config.Config{})
+	company := model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	lf.NoError(database.Create(&company).Error)
+	lf.Empty(lf.lines())
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "request-1")
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9}, SpanID: trace.SpanID{0x00, 0xf0}, TraceFlags: trace.FlagsSampled,
+	})
+	ctx = trace.ContextWithSpanContext(ctx, spanContext)
+	duplicate := model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	lf.ErrorIs(database.WithContext(ctx).Create(&duplicate).Error, gorm.ErrDuplicatedKey)
+
+	lines := lf.lines()
+	lf.Require().Len(lines, 1)
+	lf.Equal("error", lines[0]["level"])
+	lf.Equal("Query failed.", lines[0]["message"])
+	lf.Equal("db", lines[0]["component"])
+	lf.Equal(gorm.ErrDuplicatedKey.Error(), lines[0]["error"])
+	lf.Equal("request-1", lines[0]["request_id"])
+	lf.Equal(spanContext.TraceID().String(), lines[0]["trace_id"])
+	lf.Equal(spanContext.SpanID().String(), lines[0]["span_id"])
+	lf.Contains(lines[0]["sql"], "INSERT INTO `companies`")
+	lf.Contains(lines[0]["caller"], "logger_test.go")
+	// The values are redacted.
+	lf.NotContains(lines[0]["sql"], "TestCompany")
+}
+
+func (lf *LoggerFixture) TestTrace_NotFound() {
+	database := lf.open(&config.Config{DbLogLevel: "error"})
+	var company model.Company
+	lf.ErrorIs(database.First(&company, "name = ?", "Unknown").Error, gorm.ErrRecordNotFound)
+
+	lf.Empty(lf.lines())
+}
+
+func (lf *LoggerFixture) TestTrace_Slow() {
+	database := lf.open(&config.Config{DbSlowQueryThreshold: time.Nanosecond})
+	var companies []model.Company
+	lf.NoError(database.Find(&companies).Error)
+
+	lines := lf.lines()
+	lf.Require().Len(lines, 1)
+	lf.Equal("warn", lines[0]["level"])
+	lf.Equal("Slow query.", lines[0]["message"])
+	lf.NotContains(lines[0], "request_id")
+
+	database = lf.open(&config.Config{DbLogLevel: "error", DbSlowQueryThreshold: time.Nanosecond})
+	lf.NoError(database.Find(&companies).Error)
+	lf.Empty(lf.lines())
+}
+
+func (lf *LoggerFixture) TestTrace_Info() {
+	database := lf.open(&config.Config{DbLogLevel: "INFO", DbLogParameters: true})
+	var companies []model.Company
+	lf.NoError(database.Find(&companies, "name = ?", "TestCompany").Error)
+
+	lines := lf.lines()
+	lf.Require().Len(lines, 1)
+	lf.Equal("info", lines[0]["level"])
+	lf.Equal("Query.", lines[0]["message"])
+	lf.Contains(lines[0]["sql"], `"TestCompany"`)
+	lf.Equal(float64(0), lines[0]["rows"])
+
+	// Debug logs every query, whatever the configured level.
+	database = lf.open(&config.Config{DbLogLevel: "silent"})
+	lf.NoError(database.Find(&companies).Error)
+	lf.Empty(lf.lines())
+	lf.NoError(database.Debug().Find(&companies).Error)
+	lf.Len(lf.lines(), 1)
+}
+
+func (lf *LoggerFixture) TestNewLogger_UnknownLevel() {
+	_, err := NewLogger(zerolog.Nop(), &config.Config{DbLogLevel: "verbose"}, nil)
+	lf.ErrorIs(err, ErrUnknownLogLevel)
+}
+
+// open returns a migrated in-memory database logging to the output of the fixture.
+func (lf *LoggerFixture) open(config *config.Config) *gorm.DB {
+	database, err := InitTestSqlite()
+	lf.Require().NoError(err)
+	logger, err := NewLogger(zerolog.New(lf.output), config, func(ctx context.Context) string {
+		requestID, _ := ctx.Value(requestIDKey{}).(string)
+		return requestID
+	})
+	lf.Require().NoError(err)
+	database.Logger = logger
+	lf.output.Reset()
+
+	return database
+}
+
+func (lf *LoggerFixture) lines() []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(lf.output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]any
+		lf.Require().NoError(json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	lf.output.Reset()
+
+	return lines
+}
@@ -1,6 +1,10 @@
 package dto
 
-import "time"
+import (
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"time"
+)
 
 type LoginRequest struct {
 	Username string `form:"username" json:"username" binding:"required"`
@@ -14,6 +18,112 @@ type LoginResponse struct {
 }
 
 type AuthUser struct {
-	ID       uint   `json:"ID"`
-	Username string `json:"Name"`
+	ID       uint       `json:"ID"`
+	Username string     `json:"Name"`
+	Role     model.Role `json:"Role"`
+}
+
+// CompanyRequest holds the writable fields of a company, the body of a create or an update.
+// The ID, the version and the deletion state are managed by the service.
+type CompanyRequest struct {
+	Name              string            `json:"Name"`
+	Description       string            `json:"Description"`
+	AmountOfEmployees int               `json:"AmountOfEmployees"`
+	Registered        bool              `json:"Registered"`
+	Type              model.CompanyType `json:"Type"`
+}
+
+// NewCompanyRequest returns the writable fields of company, for a request to overwrite some of them.
+func NewCompanyRequest(company *model.Company) CompanyRequest {
+	return CompanyRequest{
+		Name:              company.Name,
+		Description:       company.Description,
+		AmountOfEmployees: company.AmountOfEmployees,
+		Registered:        company.Registered,
+		Type:              company.Type,
+	}
+}
+
+// Apply copies the fields of the request to company.
+func (r CompanyRequest) Apply(company *model.Company) {
+	company.Name = r.Name
+	company.Description = r.Description
+	company.AmountOfEmployees = r.AmountOfEmployees
+	company.Registered = r.Registered
+	company.Type = r.Type
+}
+
+// Company is a company as answered, with its deletion time when it is soft deleted.
+type Company struct {
+	model.Company
+	DeletedAt *time.Time `json:"DeletedAt,omitempty"`
+}
+
+func NewCompany(company *model.Company) Company {
+	result := Company{Company: *company}
+	if company.DeletedAt.Valid {
+		result.DeletedAt = &company.DeletedAt.Time
+	}
+
+	return result
+}
+
+func NewCompanies(companies []model.Company) []Company {
+	result := make([]Company, 0, len(companies))
+	for i := range companies {
+		result = append(result, NewCompany(&companies[i]))
+	}
+
+	return result
+}
+
+type CompanyListResponse struct {
+	Items      []Company `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type CompanyHistoryResponse struct {
+	Items      []model.CompanyAudit `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+type CompanySearchResponse struct {
+	Items      []CompanySearchItem `json:"items"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// CompanySearchItem is a found company with its relevance and the matched words of its
+// name and description marked with <mark> and </mark>.
+type CompanySearchItem struct {
+	Company
+	Rank       float64           `json:"Rank"`
+	Highlights CompanyHighlights `json:"Highlights"`
+}
+
+type CompanyHighlights struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description,omitempty"`
+}
+
+type WebhookRequest struct {
+	URL        string      `json:"URL"`
+	Events     []string    `json:"Events"`
+	CompanyIDs []uuid.UUID `json:"CompanyIDs"`
+	// Secret is generated when empty.
+	Secret string `json:"Secret"`
+}
+
+// WebhookCreatedResponse is a new webhook with its secret, which is not disclosed afterwards.
+type WebhookCreatedResponse struct {
+	model.Webhook
+	Secret string `json:"Secret"`
+}
+
+type WebhookListResponse struct {
+	Items []model.Webhook `json:"items"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Items      []model.WebhookDelivery `json:"items"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
 }
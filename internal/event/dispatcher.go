@@ -0,0 +1,273 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	DefaultDispatchInterval  = time.Second
+	DefaultDispatchBatchSize = 100
+	DefaultMaxAttempts       = 10
+	minBackoff               = time.Second
+	maxBackoff               = 5 * time.Minute
+	maxLastErrorLength       = 500
+)
+
+// sequenceLock is the key of the PostgreSQL advisory lock serializing the numbering of the outbox
+// events, "xm_event" in ASCII.
+const sequenceLock int64 = 0x786d5f6576656e74
+
+var ErrDispatcher = errors.New("event dispatcher error")
+
+// Dispatcher numbers the committed outbox events and publishes them in sequence order.
+//
+// The IDs of the events are allocated when they are written, so a lower ID can be committed after
+// a higher one. The sequence numbers are given once the events are committed, in the order the
+// dispatcher finds them, and order the change feed, the webhooks and the published messages.
+// Without a publisher the dispatcher only numbers the events.
+//
+// Events are marked as published only after the publisher accepted them, so
+// delivery is at-least-once: consumers must tolerate duplicates by event ID.
+//
+// A failed event holds back the later ones and is retried with exponential backoff. After
+// maxAttempts attempts it is dead: it is skipped, so that it does not block the others, until
+// it is requeued. On PostgreSQL the replicas claim the events they publish, so that they do
+// not publish them twice; the order is then only kept within a replica.
+type Dispatcher struct {
+	db          *gorm.DB
+	publisher   Publisher
+	logger      zerolog.Logger
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+}
+
+// NewDispatcher returns a dispatcher of the outbox events to the publisher, nil to only number them.
+func NewDispatcher(db *gorm.DB, publisher Publisher, logger zerolog.Logger, interval time.Duration, maxAttempts int) *Dispatcher {
+	if interval <= 0 {
+		interval = DefaultDispatchInterval
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	return &Dispatcher{
+		db:          db,
+		publisher:   publisher,
+		logger:      logger,
+		interval:    interval,
+		batchSize:   DefaultDispatchBatchSize,
+		maxAttempts: maxAttempts,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		now:         time.Now,
+	}
+}
+
+// Run dispatches pending events until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.logger.Info().Dur("interval", d.interval).Int("max_attempts", d.maxAttempts).Msg("Event dispatcher started.")
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			count, err := d.Dispatch(ctx)
+			if err != nil {
+				d.logger.Error().Err(err).Msg("Dispatch events.")
+			}
+			if err != nil || count < d.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			d.logger.Info().Msg("Event dispatcher stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch numbers the new events, then publishes one batch of pending events and returns how many
+// were published. It stops at the first failure so that events are not published out of order.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	if err := d.Sequence(ctx); err != nil {
+		return 0, err
+	}
+	if d.publisher == nil {
+		return 0, nil
+	}
+
+	if d.db.Dialector.Name() != "postgres" {
+		return d.dispatch(ctx, d.db.WithContext(ctx), false)
+	}
+
+	// The claimed rows stay locked until the transaction ends, the other replicas skip them.
+	var count int
+	var dispatchErr error
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		count, dispatchErr = d.dispatch(ctx, tx, true)
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("%w: commit: %w", ErrDispatcher, err)
+	}
+
+	return count, dispatchErr
+}
+
+// Sequence numbers the committed events that have no sequence number yet, in ID order. The numbering
+// is serialized across the replicas, so that the numbers follow the order of the numbering.
+func (d *Dispatcher) Sequence(ctx context.Context) error {
+	for {
+		count, err := d.sequence(d.db.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("%w: sequence: %w", ErrDispatcher, err)
+		}
+		if count < d.batchSize {
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) sequence(db *gorm.DB) (int, error) {
+	count := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			// Held until the commit, so that the numbers of a replica are visible before the next
+			// replica reads the highest one. SQLite has a single writer already.
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", sequenceLock).Error; err != nil {
+				return err
+			}
+		}
+
+		var ids []uint64
+		err := tx.Model(&model.OutboxEvent{}).Where("sequence IS NULL").Order("id ASC").Limit(d.batchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		var last uint64
+		if err := tx.Model(&model.OutboxEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			last++
+			if err := tx.Model(&model.OutboxEvent{}).Where("id = ?", id).Update("sequence", last).Error; err != nil {
+				return err
+			}
+		}
+		count = len(ids)
+
+		return nil
+	})
+
+	return count, err
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, db *gorm.DB, claim bool) (int, error) {
+	query := db.Where("published_at IS NULL AND dead_at IS NULL AND sequence IS NOT NULL").Order("sequence ASC").Limit(d.batchSize)
+	if claim {
+		query = query.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked})
+	}
+	var events []model.OutboxEvent
+	if err := query.Find(&events).Error; err != nil {
+		return 0, fmt.Errorf("%w: load: %w", ErrDispatcher, err)
+	}
+
+	for i, event := range events {
+		now := d.now()
+		if event.NextAttemptAt != nil && event.NextAttemptAt.After(now) {
+			return i, nil
+		}
+
+		if err := d.publisher.Publish(ctx, NewMessage(event)); err != nil {
+			return i, errors.Join(fmt.Errorf("%w: publish %d: %w", ErrDispatcher, event.ID, err), d.fail(db, event, err, now))
+		}
+
+		err := db.Model(&event).Updates(map[string]any{
+			"published_at":    now,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": nil,
+		}).Error
+		if err != nil {
+			return i, fmt.Errorf("%w: mark %d: %w", ErrDispatcher, event.ID, err)
+		}
+	}
+
+	return len(events), nil
+}
+
+// fail records a failed attempt to publish the event, and schedules the next one or gives up.
+func (d *Dispatcher) fail(db *gorm.DB, event model.OutboxEvent, err error, now time.Time) error {
+	lastError := err.Error()
+	if len(lastError) > maxLastErrorLength {
+		lastError = lastError[:maxLastErrorLength]
+	}
+	attempts := event.Attempts + 1
+	updates := map[string]any{
+		"attempts":   attempts,
+		"last_error": lastError,
+	}
+	if attempts >= d.maxAttempts {
+		updates["dead_at"] = now
+		updates["next_attempt_at"] = nil
+		d.logger.Error().Uint64("event", event.ID).Int("attempts", attempts).Str("error", lastError).Msg("Event dead.")
+	} else {
+		updates["next_attempt_at"] = now.Add(d.backoff(attempts))
+	}
+
+	return db.Model(&event).Updates(updates).Error
+}
+
+// Requeue gives the dead events new attempts and returns how many there were.
+func (d *Dispatcher) Requeue(ctx context.Context) (int, error) {
+	result := d.db.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("dead_at IS NOT NULL").
+		Updates(map[string]any{"dead_at": nil, "attempts": 0, "next_attempt_at": nil})
+	if result.Error != nil {
+		return 0, fmt.Errorf("%w: requeue: %w", ErrDispatcher, result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// backoff returns the delay before the next attempt, doubled after every failed attempt.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.maxBackoff)
+}
+
+// Lag returns the age of the oldest pending event, 0 when every event is published or dead.
+func (d *Dispatcher) Lag(ctx context.Context) (time.Duration, error) {
+	var events []model.OutboxEvent
+	err := d.db.WithContext(ctx).
+		Where("published_at IS NULL AND dead_at IS NULL").
+		Order("id ASC").
+		Limit(1).
+		Find(&events).Error
+	if err != nil {
+		return 0, fmt.Errorf("%w: lag: %w", ErrDispatcher, err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	return time.Since(events[0].CreatedAt), nil
+}
@@ -0,0 +1,301 @@
+package event
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/validator"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	suite.Run(t, new(DispatcherFixture))
+}
+
+type DispatcherFixture struct {
+	suite.Suite
+
+	db             *gorm.DB
+	logger         zerolog.Logger
+	companyService *service.Company
+}
+
+func (df *DispatcherFixture) SetupTest() {
+	var err error
+	df.db, err = db.InitTestSqlite()
+	df.NoError(err)
+	df.logger = zerolog.Nop()
+	df.companyService = service.NewCompanyService(repository.NewSqliteCompanyRepository(df.db), validator.CompanyValidator(df.logger))
+}
+
+func (df *DispatcherFixture) TestDispatch() {
+	company := df.testCompany()
+	df.NoError(df.companyService.Create(context.Background(), company))
+	company.Description = "updated"
+	df.NoError(df.companyService.Update(context.Background(), company))
+	df.NoError(df.companyService.Delete(context.Background(), company.ID, 0))
+
+	publisher := NewMemoryPublisher()
+	messages, cancel := publisher.Subscribe(10)
+	defer cancel()
+
+	dispatcher := NewDispatcher(df.db, publisher, df.logger, time.Second, 3)
+	count, err := dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(3, count)
+
+	var types []string
+	for range 3 {
+		message := <-messages
+		df.Equal(company.ID, message.CompanyID)
+		types = append(types, message.Type)
+	}
+	df.Equal([]string{model.EventCompanyCreated, model.EventCompanyUpdated, model.EventCompanyDeleted}, types)
+
+	count, err = dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(0, count)
+}
+
+func (df *DispatcherFixture) TestDispatch_Sequence() {
+	publisher := NewMemoryPublisher()
+	messages, cancel := publisher.Subscribe(10)
+	defer cancel()
+	dispatcher := NewDispatcher(df.db, publisher, df.logger, time.Second, 3)
+
+	// The event with the higher ID commits first: it is numbered and published first.
+	df.NoError(df.db.Create(df.testEvent(2)).Error)
+	count, err := dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	message := <-messages
+	df.Equal(uint64(2), message.ID)
+	df.Equal(uint64(1), message.Sequence)
+
+	df.NoError(df.db.Create(df.testEvent(1)).Error)
+	count, err = dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	message = <-messages
+	df.Equal(uint64(1), message.ID)
+	df.Equal(uint64(2), message.Sequence)
+
+	// Without a publisher, the events are numbered and left unpublished.
+	df.NoError(df.db.Create(df.testEvent(3)).Error)
+	count, err = NewDispatcher(df.db, nil, df.logger, time.Second, 3).Dispatch(context.Background())
+	df.NoError(err)
+	df.Zero(count)
+	var numbered model.OutboxEvent
+	df.NoError(df.db.First(&numbered, 3).Error)
+	df.Equal(uint64(3), *numbered.Sequence)
+	df.Nil(numbered.PublishedAt)
+}
+
+func (df *DispatcherFixture) TestDispatch_PublishFailure() {
+	first := df.testCompany()
+	df.NoError(df.companyService.Create(context.Background(), first))
+	second := df.testCompany()
+	second.Name = "SecondCompany"
+	df.NoError(df.companyService.Create(context.Background(), second))
+	third := df.testCompany()
+	third.Name = "ThirdCompany"
+	df.NoError(df.companyService.Create(context.Background(), third))
+
+	publisher := &failingPublisher{failOn: second.ID}
+	dispatcher := NewDispatcher(df.db, publisher, df.logger, time.Second, 3)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	count, err := dispatcher.Dispatch(context.Background())
+	df.ErrorIs(err, ErrDispatcher)
+	df.Equal(1, count)
+
+	pending := df.pending()
+	df.Len(pending, 2)
+	df.Equal(second.ID, pending[0].AggregateID)
+	df.Equal(1, pending[0].Attempts)
+	df.Equal("broker unavailable", pending[0].LastError)
+	df.WithinDuration(now.Add(time.Second), *pending[0].NextAttemptAt, time.Millisecond)
+
+	// The failed event holds back the later ones until its next attempt.
+	count, err = dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(0, count)
+
+	now = now.Add(time.Second)
+	_, err = dispatcher.Dispatch(context.Background())
+	df.ErrorIs(err, ErrDispatcher)
+	df.WithinDuration(now.Add(2*time.Second), *df.pending()[0].NextAttemptAt, time.Millisecond)
+
+	// After the last attempt, the event is dead and no longer blocks the others.
+	now = now.Add(2 * time.Second)
+	_, err = dispatcher.Dispatch(context.Background())
+	df.ErrorIs(err, ErrDispatcher)
+	var dead model.OutboxEvent
+	df.NoError(df.db.Where("aggregate_id = ?", second.ID).First(&dead).Error)
+	df.Equal(3, dead.Attempts)
+	df.NotNil(dead.DeadAt)
+	df.Nil(dead.PublishedAt)
+
+	count, err = dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	df.Empty(df.pending())
+
+	lag, err := dispatcher.Lag(context.Background())
+	df.NoError(err)
+	df.Zero(lag)
+
+	// Requeued, the dead event is published once the publisher accepts it.
+	requeued, err := dispatcher.Requeue(context.Background())
+	df.NoError(err)
+	df.Equal(1, requeued)
+	publisher.failOn = uuid.Nil
+	count, err = dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	df.Empty(df.pending())
+	var published model.OutboxEvent
+	df.NoError(df.db.Where("aggregate_id = ?", second.ID).First(&published).Error)
+	df.Nil(published.DeadAt)
+	df.NotNil(published.PublishedAt)
+}
+
+func (df *DispatcherFixture) TestBackoff() {
+	dispatcher := NewDispatcher(df.db, NewMemoryPublisher(), df.logger, time.Second, 0)
+	df.Equal(DefaultMaxAttempts, dispatcher.maxAttempts)
+	df.Equal(time.Second, dispatcher.backoff(1))
+	df.Equal(4*time.Second, dispatcher.backoff(3))
+	df.Equal(maxBackoff, dispatcher.backoff(20))
+}
+
+func (df *DispatcherFixture) TestMemoryPublisher() {
+	publisher := NewMemoryPublisher()
+	messages, cancel := publisher.Subscribe(1)
+
+	df.NoError(publisher.Publish(context.Background(), Message{ID: 1}))
+	// The buffer is full, the message is dropped rather than blocking the publisher.
+	df.NoError(publisher.Publish(context.Background(), Message{ID: 2}))
+	df.Equal(uint64(1), publisher.Dropped())
+	df.Equal(uint64(1), (<-messages).ID)
+
+	// Cancelling while publishing does not deadlock.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			_ = publisher.Publish(context.Background(), Message{ID: uint64(i)})
+		}
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		df.Fail("publish blocked")
+	}
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelCtx()
+	df.ErrorIs(publisher.Publish(ctx, Message{ID: 3}), context.Canceled)
+}
+
+func (df *DispatcherFixture) TestLag() {
+	dispatcher := NewDispatcher(df.db, NewMemoryPublisher(), df.logger, time.Second, 3)
+	lag, err := dispatcher.Lag(context.Background())
+	df.NoError(err)
+	df.Zero(lag)
+
+	df.NoError(df.companyService.Create(context.Background(), df.testCompany()))
+	df.NoError(df.db.Model(&model.OutboxEvent{}).Where("1 = 1").Update("created_at", time.Now().Add(-time.Minute)).Error)
+	lag, err = dispatcher.Lag(context.Background())
+	df.NoError(err)
+	df.GreaterOrEqual(lag, time.Minute)
+
+	_, err = dispatcher.Dispatch(context.Background())
+	df.NoError(err)
+	lag, err = dispatcher.Lag(context.Background())
+	df.NoError(err)
+	df.Zero(lag)
+}
+
+func (df *DispatcherFixture) TestFilePublisher() {
+	company := df.testCompany()
+	df.NoError(df.companyService.Create(context.Background(), company))
+
+	path := filepath.Join(df.T().TempDir(), "events.ndjson")
+	publisher, err := NewFilePublisher(path)
+	df.NoError(err)
+
+	_, err = NewDispatcher(df.db, publisher, df.logger, time.Second, 3).Dispatch(context.Background())
+	df.NoError(err)
+	df.NoError(publisher.Close())
+
+	file, err := os.Open(path)
+	df.NoError(err)
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	df.True(scanner.Scan())
+	var message Message
+	df.NoError(json.Unmarshal(scanner.Bytes(), &message))
+	df.Equal(model.EventCompanyCreated, message.Type)
+
+	var payload model.Company
+	df.NoError(json.Unmarshal(message.Company, &payload))
+	df.Equal(company.Name, payload.Name)
+	df.False(scanner.Scan())
+}
+
+// pending returns the events left to publish.
+func (df *DispatcherFixture) pending() []model.OutboxEvent {
+	var pending []model.OutboxEvent
+	df.NoError(df.db.Where("published_at IS NULL AND dead_at IS NULL").Order("id ASC").Find(&pending).Error)
+
+	return pending
+}
+
+func (df *DispatcherFixture) testEvent(id uint64) *model.OutboxEvent {
+	return &model.OutboxEvent{
+		ID:          id,
+		Type:        model.EventCompanyCreated,
+		AggregateID: uuid.New(),
+		Payload:     "{}",
+		CreatedAt:   time.Now(),
+	}
+}
+
+func (df *DispatcherFixture) testCompany() *model.Company {
+	return &model.Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              model.CompanyTypeCorporation,
+	}
+}
+
+type failingPublisher struct {
+	failOn uuid.UUID
+}
+
+func (p *failingPublisher) Publish(_ context.Context, message Message) error {
+	if message.CompanyID == p.failOn {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func (p *failingPublisher) Close() error {
+	return nil
+}
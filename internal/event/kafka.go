@@ -0,0 +1,57 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"strconv"
+)
+
+// KafkaPublisher publishes messages to a Kafka topic, keyed by company ID so that
+// the events of a company keep their order within a partition.
+type KafkaPublisher struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewKafkaPublisher(brokers []string, topic string) (*KafkaPublisher, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "xm"
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = 3
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKafkaPublisher(producer, topic), nil
+}
+
+func newKafkaPublisher(producer sarama.SyncProducer, topic string) *KafkaPublisher {
+	return &KafkaPublisher{producer: producer, topic: topic}
+}
+
+func (p *KafkaPublisher) Publish(_ context.Context, message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(message.CompanyID.String()),
+		Value: sarama.ByteEncoder(data),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("event-type"), Value: []byte(message.Type)},
+			{Key: []byte("event-id"), Value: []byte(strconv.FormatUint(message.ID, 10))},
+		},
+	})
+
+	return err
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.producer.Close()
+}
@@ -0,0 +1,100 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/model"
+	"testing"
+	"time"
+)
+
+func TestKafkaPublisher(t *testing.T) {
+	suite.Run(t, new(KafkaPublisherFixture))
+}
+
+type KafkaPublisherFixture struct {
+	suite.Suite
+
+	broker *sarama.MockBroker
+}
+
+func (kf *KafkaPublisherFixture) SetupTest() {
+	kf.broker = sarama.NewMockBroker(kf.T(), 1)
+	kf.broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(kf.T()).
+			SetBroker(kf.broker.Addr(), kf.broker.BrokerID()).
+			SetLeader("xm.company", 0, kf.broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(kf.T()),
+	})
+}
+
+func (kf *KafkaPublisherFixture) TearDownTest() {
+	kf.broker.Close()
+}
+
+func (kf *KafkaPublisherFixture) TestPublish() {
+	publisher, err := NewKafkaPublisher([]string{kf.broker.Addr()}, "xm.company")
+	kf.NoError(err)
+
+	kf.NoError(publisher.Publish(context.Background(), kf.testMessage()))
+	kf.NoError(publisher.Close())
+
+	produced := 0
+	for _, exchange := range kf.broker.History() {
+		if _, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	kf.Equal(1, produced)
+}
+
+func (kf *KafkaPublisherFixture) TestPublish_Message() {
+	producer := mocks.NewSyncProducer(kf.T(), nil)
+	publisher := newKafkaPublisher(producer, "xm.company")
+
+	message := kf.testMessage()
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(produced *sarama.ProducerMessage) error {
+		kf.Equal("xm.company", produced.Topic)
+
+		key, err := produced.Key.Encode()
+		kf.NoError(err)
+		kf.Equal(message.CompanyID.String(), string(key))
+
+		value, err := produced.Value.Encode()
+		kf.NoError(err)
+
+		var published Message
+		kf.NoError(json.Unmarshal(value, &published))
+		kf.Equal(message.ID, published.ID)
+		kf.Equal(model.EventCompanyCreated, published.Type)
+		kf.JSONEq(`{"Name":"TestCompany"}`, string(published.Company))
+
+		return nil
+	})
+
+	kf.NoError(publisher.Publish(context.Background(), message))
+	kf.NoError(publisher.Close())
+}
+
+func (kf *KafkaPublisherFixture) TestPublish_Failure() {
+	producer := mocks.NewSyncProducer(kf.T(), nil)
+	publisher := newKafkaPublisher(producer, "xm.company")
+
+	producer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+	kf.ErrorIs(publisher.Publish(context.Background(), kf.testMessage()), sarama.ErrNotLeaderForPartition)
+	kf.NoError(publisher.Close())
+}
+
+func (kf *KafkaPublisherFixture) testMessage() Message {
+	return NewMessage(model.OutboxEvent{
+		ID:          1,
+		Type:        model.EventCompanyCreated,
+		AggregateID: uuid.New(),
+		Payload:     `{"Name":"TestCompany"}`,
+		CreatedAt:   time.Now(),
+	})
+}
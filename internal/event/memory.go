@@ -0,0 +1,83 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryPublisher fans published messages out to in-process subscribers.
+//
+// A subscriber whose buffer is full misses the message, it never blocks the publisher;
+// Dropped counts the missed messages.
+type MemoryPublisher struct {
+	mu          sync.RWMutex
+	subscribers map[chan Message]struct{}
+	closed      bool
+	dropped     atomic.Uint64
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{subscribers: make(map[chan Message]struct{})}
+}
+
+// Subscribe returns a channel receiving every message published after the call
+// and a function to cancel the subscription.
+func (p *MemoryPublisher) Subscribe(buffer int) (<-chan Message, func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	messages := make(chan Message, buffer)
+	if p.closed {
+		close(messages)
+		return messages, func() {}
+	}
+	p.subscribers[messages] = struct{}{}
+
+	return messages, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if _, ok := p.subscribers[messages]; ok {
+			delete(p.subscribers, messages)
+			close(messages)
+		}
+	}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The sends do not block, so holding the lock cannot deadlock with a cancelled subscription.
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for subscriber := range p.subscribers {
+		select {
+		case subscriber <- message:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+
+	return nil
+}
+
+// Dropped returns the number of messages missed by subscribers with a full buffer.
+func (p *MemoryPublisher) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+func (p *MemoryPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for subscriber := range p.subscribers {
+		close(subscriber)
+	}
+	p.subscribers = make(map[chan Message]struct{})
+	p.closed = true
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/model"
+	"strings"
+	"time"
+)
+
+const (
+	PublisherNone  = "none"
+	PublisherFile  = "file"
+	PublisherKafka = "kafka"
+)
+
+var ErrUnknownPublisher = errors.New("unknown event publisher")
+
+// Publisher delivers outbox events to downstream consumers.
+type Publisher interface {
+	Publish(ctx context.Context, message Message) error
+	Close() error
+}
+
+// Message is the wire representation of a published event. The ID identifies the event, the
+// Sequence, numbered by the dispatcher before it is published, is its position in the feed.
+type Message struct {
+	ID         uint64          `json:"id"`
+	Sequence   uint64          `json:"sequence,omitempty"`
+	Type       string          `json:"type"`
+	CompanyID  uuid.UUID       `json:"company_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Company    json.RawMessage `json:"company"`
+}
+
+func NewMessage(event model.OutboxEvent) Message {
+	message := Message{
+		ID:         event.ID,
+		Type:       event.Type,
+		CompanyID:  event.AggregateID,
+		OccurredAt: event.CreatedAt,
+		Company:    json.RawMessage(event.Payload),
+	}
+	if event.Sequence != nil {
+		message.Sequence = *event.Sequence
+	}
+
+	return message
+}
+
+// NewPublisher builds the publisher selected in the configuration.
+// It returns nil when event publishing is disabled.
+func NewPublisher(config *config.Config) (Publisher, error) {
+	switch config.EventPublisher {
+	case PublisherNone, "":
+		return nil, nil
+	case PublisherFile:
+		publisher, err := NewFilePublisher(config.EventFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return publisher, nil
+	case PublisherKafka:
+		publisher, err := NewKafkaPublisher(strings.Split(config.KafkaBrokers, ","), config.KafkaTopic)
+		if err != nil {
+			return nil, err
+		}
+		return publisher, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPublisher, config.EventPublisher)
+	}
+}
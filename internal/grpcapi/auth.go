@@ -0,0 +1,87 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	xmv1 "github.com/vcsfrl/xm/proto/xm/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+)
+
+// methodPermissions are the permissions of the methods that always need a token. The other
+// methods are anonymous.
+var methodPermissions = map[string]model.Permission{
+	xmv1.CompanyService_CreateCompany_FullMethodName:  model.PermissionCompanyCreate,
+	xmv1.CompanyService_UpdateCompany_FullMethodName:  model.PermissionCompanyUpdate,
+	xmv1.CompanyService_DeleteCompany_FullMethodName:  model.PermissionCompanyDelete,
+	xmv1.CompanyService_RestoreCompany_FullMethodName: model.PermissionCompanyRestore,
+}
+
+type authServer struct {
+	xmv1.UnimplementedAuthServiceServer
+	authManager *middleware.AuthenticationManager
+}
+
+func (s *authServer) Login(_ context.Context, request *xmv1.LoginRequest) (*xmv1.LoginResponse, error) {
+	token, expire, err := s.authManager.Login(request.GetUsername(), request.GetPassword())
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return &xmv1.LoginResponse{Token: token, Expire: timestamppb.New(expire)}, nil
+}
+
+// authorizer checks the JWT of the authorization metadata, signed as the tokens of the REST API.
+type authorizer struct {
+	authManager *middleware.AuthenticationManager
+}
+
+// interceptor requires the permission of the method, and adds the request ID of the metadata to the context.
+func (a *authorizer) interceptor(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if requestID := metadataValue(ctx, "x-request-id"); requestID != "" {
+		ctx = service.WithRequestID(ctx, requestID)
+	}
+
+	if permission, ok := methodPermissions[info.FullMethod]; ok {
+		var err error
+		if ctx, err = a.authorize(ctx, permission); err != nil {
+			return nil, err
+		}
+	}
+
+	return handler(ctx, request)
+}
+
+// authorize returns the context with the user of the token, provided the role of the user has the permission.
+func (a *authorizer) authorize(ctx context.Context, permission model.Permission) (context.Context, error) {
+	authorization := metadataValue(ctx, "authorization")
+	token, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token in the authorization metadata")
+	}
+
+	user, err := a.authManager.Authenticate(strings.TrimSpace(token))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !user.Role.Can(permission) {
+		return nil, status.Error(codes.PermissionDenied, "missing permission "+string(permission))
+	}
+
+	return service.WithActor(ctx, *user), nil
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -0,0 +1,227 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	xmv1 "github.com/vcsfrl/xm/proto/xm/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+)
+
+var companyTypes = map[model.CompanyType]xmv1.CompanyType{
+	model.CompanyTypeCorporation:        xmv1.CompanyType_COMPANY_TYPE_CORPORATIONS,
+	model.CompanyTypeNonProfit:          xmv1.CompanyType_COMPANY_TYPE_NON_PROFIT,
+	model.CompanyTypeCooperative:        xmv1.CompanyType_COMPANY_TYPE_COOPERATIVE,
+	model.CompanyTypeSoleProprietorship: xmv1.CompanyType_COMPANY_TYPE_SOLE_PROPRIETORSHIP,
+}
+
+type companyServer struct {
+	xmv1.UnimplementedCompanyServiceServer
+	company *service.Company
+	auth    *authorizer
+	logger  zerolog.Logger
+}
+
+func (s *companyServer) CreateCompany(ctx context.Context, request *xmv1.CreateCompanyRequest) (*xmv1.Company, error) {
+	company := fromProto(request.GetCompany())
+	if err := s.company.Create(ctx, company); err != nil {
+		return nil, s.status(err)
+	}
+
+	return toProto(company), nil
+}
+
+func (s *companyServer) GetCompany(ctx context.Context, request *xmv1.GetCompanyRequest) (*xmv1.Company, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	var company *model.Company
+	if request.GetIncludeDeleted() {
+		if ctx, err = s.auth.authorize(ctx, model.PermissionCompanyReadDeleted); err != nil {
+			return nil, err
+		}
+		company, err = s.company.GetIncludingDeleted(ctx, id)
+	} else {
+		company, err = s.company.Get(ctx, id)
+	}
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	return toProto(company), nil
+}
+
+func (s *companyServer) ListCompanies(ctx context.Context, request *xmv1.ListCompaniesRequest) (*xmv1.ListCompaniesResponse, error) {
+	query := service.CompanyListQuery{
+		Registered:     request.Registered,
+		NamePrefix:     request.GetNamePrefix(),
+		Limit:          int(request.GetPageSize()),
+		Cursor:         request.GetPageToken(),
+		IncludeDeleted: request.GetIncludeDeleted(),
+	}
+	if request.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid page_size")
+	}
+	for _, companyType := range request.GetTypes() {
+		query.Types = append(query.Types, fromProtoType(companyType))
+	}
+	if request.MinEmployees != nil {
+		minEmployees := int(request.GetMinEmployees())
+		query.MinEmployees = &minEmployees
+	}
+	if request.MaxEmployees != nil {
+		maxEmployees := int(request.GetMaxEmployees())
+		query.MaxEmployees = &maxEmployees
+	}
+	if request.GetOrderBy() != "" {
+		for _, field := range strings.Split(request.GetOrderBy(), ",") {
+			field = strings.TrimSpace(field)
+			query.Sort = append(query.Sort, service.CompanySort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")})
+		}
+	}
+
+	if query.IncludeDeleted {
+		var err error
+		if ctx, err = s.auth.authorize(ctx, model.PermissionCompanyReadDeleted); err != nil {
+			return nil, err
+		}
+	}
+
+	list, err := s.company.List(ctx, query)
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	response := &xmv1.ListCompaniesResponse{NextPageToken: list.NextCursor}
+	for _, company := range list.Items {
+		response.Companies = append(response.Companies, toProto(&company))
+	}
+
+	return response, nil
+}
+
+func (s *companyServer) UpdateCompany(ctx context.Context, request *xmv1.UpdateCompanyRequest) (*xmv1.Company, error) {
+	id, err := parseID(request.GetCompany().GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	company, err := s.company.Get(ctx, id)
+	if err != nil {
+		return nil, s.status(err)
+	}
+	if request.GetVersion() != 0 {
+		company.Version = int(request.GetVersion())
+	}
+
+	paths := request.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"name", "description", "amount_of_employees", "registered", "type"}
+	}
+	changes := request.GetCompany()
+	for _, path := range paths {
+		switch path {
+		case "name":
+			company.Name = changes.GetName()
+		case "description":
+			company.Description = changes.GetDescription()
+		case "amount_of_employees":
+			company.AmountOfEmployees = int(changes.GetAmountOfEmployees())
+		case "registered":
+			company.Registered = changes.GetRegistered()
+		case "type":
+			company.Type = fromProtoType(changes.GetType())
+		default:
+			return nil, status.Error(codes.InvalidArgument, "unknown update_mask path "+path)
+		}
+	}
+
+	if err := s.company.Update(ctx, company); err != nil {
+		return nil, s.status(err)
+	}
+
+	return toProto(company), nil
+}
+
+func (s *companyServer) DeleteCompany(ctx context.Context, request *xmv1.DeleteCompanyRequest) (*emptypb.Empty, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.company.Delete(ctx, id, int(request.GetVersion())); err != nil {
+		return nil, s.status(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *companyServer) RestoreCompany(ctx context.Context, request *xmv1.RestoreCompanyRequest) (*xmv1.Company, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	company, err := s.company.Restore(ctx, id)
+	if err != nil {
+		return nil, s.status(err)
+	}
+
+	return toProto(company), nil
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid company id")
+	}
+
+	return parsed, nil
+}
+
+func toProto(company *model.Company) *xmv1.Company {
+	result := &xmv1.Company{
+		Id:                company.ID.String(),
+		Name:              company.Name,
+		Description:       company.Description,
+		AmountOfEmployees: int32(company.AmountOfEmployees),
+		Registered:        company.Registered,
+		Type:              companyTypes[company.Type],
+		Version:           int64(company.Version),
+	}
+	if company.DeletedAt.Valid {
+		result.DeletedAt = timestamppb.New(company.DeletedAt.Time)
+	}
+
+	return result
+}
+
+// fromProto returns the company of a create request; the fields set by the server are ignored.
+func fromProto(company *xmv1.Company) *model.Company {
+	return &model.Company{
+		Name:              company.GetName(),
+		Description:       company.GetDescription(),
+		AmountOfEmployees: int(company.GetAmountOfEmployees()),
+		Registered:        company.GetRegistered(),
+		Type:              fromProtoType(company.GetType()),
+	}
+}
+
+// fromProtoType returns the company type of the enum value, or an empty one, which fails validation.
+func fromProtoType(companyType xmv1.CompanyType) model.CompanyType {
+	for modelType, protoType := range companyTypes {
+		if protoType == companyType {
+			return modelType
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,66 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// status maps a service error to its gRPC status, as problem.FromError does for the REST API.
+// Validation errors carry the invalid fields as BadRequest details. Unknown errors are logged
+// and their details are not disclosed.
+func (s *companyServer) status(err error) error {
+	var validationError *service.ValidationError
+	switch {
+	case errors.As(err, &validationError):
+		result := status.New(codes.InvalidArgument, "the company has invalid fields")
+		details := &errdetails.BadRequest{}
+		for _, field := range validationError.Fields {
+			details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Message,
+				Reason:      field.Code,
+			})
+		}
+		if withDetails, err := result.WithDetails(details); err == nil {
+			result = withDetails
+		}
+		return result.Err()
+	case errors.Is(err, service.ErrInvalidListQuery):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, "company not found")
+	case errors.Is(err, service.ErrDuplicateName):
+		return status.Error(codes.AlreadyExists, "a company with this name already exists")
+	case errors.Is(err, service.ErrVersionConflict):
+		return status.Error(codes.Aborted, "company was modified")
+	case errors.Is(err, service.ErrConflict):
+		return status.Error(codes.FailedPrecondition, "conflict")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		s.logger.Error().Err(err).Msg("Company service error.")
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// recoverer turns the panics of the handlers into internal errors, as the recovery middleware of gin does.
+func recoverer(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (response any, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logger.Error().Str("method", info.FullMethod).Msgf("Panic in grpc handler: %v", recovered)
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+
+		return handler(ctx, request)
+	}
+}
@@ -0,0 +1,112 @@
+// Package grpcapi serves the company service over gRPC, next to the REST API.
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/validator"
+	xmv1 "github.com/vcsfrl/xm/proto/xm/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"gorm.io/gorm"
+	"net"
+	"time"
+)
+
+const serverShutdownDelay = 5
+
+type GrpcApi struct {
+	ctx    context.Context
+	logger zerolog.Logger
+	config *config.Config
+	db     *gorm.DB
+	srv    *grpc.Server
+	health *health.Server
+}
+
+func NewGrpcApi(ctx context.Context, logger zerolog.Logger, config *config.Config, db *gorm.DB) *GrpcApi {
+	return &GrpcApi{ctx: ctx, logger: logger, config: config, db: db}
+}
+
+func (g *GrpcApi) Run() {
+	g.logger.Info().Msg("Running grpc api")
+
+	srv, err := g.BuildServer()
+	if err != nil {
+		g.logger.Error().Err(err).Msg("Failed to build grpc server")
+		return
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", g.config.GrpcPort))
+	if err != nil {
+		g.logger.Error().Err(err).Msg("Failed to listen")
+		return
+	}
+
+	g.srv = srv
+	if err := srv.Serve(listener); err != nil {
+		g.logger.Error().Err(err).Msg("Failed to run the grpc server")
+		return
+	}
+}
+
+// BuildServer returns a server of the auth and company services, with reflection and health checking.
+func (g *GrpcApi) BuildServer() (*grpc.Server, error) {
+	companyRepository, err := repository.NewCompanyRepository(g.db)
+	if err != nil {
+		g.logger.Error().Err(err).Msg("Failed to create company repository")
+		return nil, err
+	}
+	companyService := service.NewCompanyService(companyRepository, validator.CompanyValidator(g.logger))
+
+	userService := service.NewUserService(repository.NewUserRepository(g.db))
+	authManager, err := middleware.NewAuthenticationManager(g.config, g.logger, userService)
+	if err != nil {
+		g.logger.Error().Err(err).Msg("Failed to create auth manager")
+		return nil, err
+	}
+
+	auth := &authorizer{authManager: authManager}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(recoverer(g.logger), rateLimiter(g.config), auth.interceptor))
+	xmv1.RegisterAuthServiceServer(srv, &authServer{authManager: authManager})
+	xmv1.RegisterCompanyServiceServer(srv, &companyServer{company: companyService, auth: auth, logger: g.logger})
+
+	g.health = health.NewServer()
+	g.health.SetServingStatus(xmv1.CompanyService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, g.health)
+	reflection.Register(srv)
+
+	return srv, nil
+}
+
+func (g *GrpcApi) Close() error {
+	g.logger.Info().Msg("Shutting down grpc api")
+	if g.srv == nil {
+		g.logger.Info().Msg("Grpc server is not running")
+		return nil
+	}
+	g.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		g.srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(serverShutdownDelay * time.Second):
+		g.logger.Warn().Msg("Grpc server did not stop in time, closing the connections")
+		g.srv.Stop()
+	}
+
+	g.logger.Info().Msg("Grpc server shutdown successfully")
+	return nil
+}
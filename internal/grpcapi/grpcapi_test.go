@@ -0,0 +1,258 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/config"
+	db2 "github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/validator"
+	xmv1 "github.com/vcsfrl/xm/proto/xm/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGrpcApiSuite(t *testing.T) {
+	suite.Run(t, new(GrpcApiTestSuite))
+}
+
+type GrpcApiTestSuite struct {
+	suite.Suite
+	ctx            context.Context
+	config         *config.Config
+	grpcApi        *GrpcApi
+	companyService *service.Company
+	userService    *service.User
+	conn           *grpc.ClientConn
+	auth           xmv1.AuthServiceClient
+	companies      xmv1.CompanyServiceClient
+}
+
+func (suite *GrpcApiTestSuite) SetupTest() {
+	logger := zerolog.Nop()
+	db, err := db2.InitTestSqlite()
+	suite.NoError(err)
+
+	suite.ctx = context.Background()
+	suite.config = &config.Config{AuthJwtSecret: "secret", AuthUser: "admin", AuthPassword: "admin-password",
+		RateLimit: 1000, RateBurst: 100}
+	suite.companyService = service.NewCompanyService(repository.NewSqliteCompanyRepository(db), validator.CompanyValidator(logger))
+	suite.userService = service.NewUserService(repository.NewUserRepository(db))
+	_, err = suite.userService.Add(suite.config.AuthUser, suite.config.AuthPassword, model.RoleAdmin)
+	suite.NoError(err)
+
+	suite.grpcApi = NewGrpcApi(suite.ctx, logger, suite.config, db)
+	srv, err := suite.grpcApi.BuildServer()
+	suite.NoError(err)
+	suite.grpcApi.srv = srv
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	suite.conn, err = grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	suite.NoError(err)
+	suite.auth = xmv1.NewAuthServiceClient(suite.conn)
+	suite.companies = xmv1.NewCompanyServiceClient(suite.conn)
+}
+
+func (suite *GrpcApiTestSuite) TearDownTest() {
+	suite.NoError(suite.conn.Close())
+	suite.NoError(suite.grpcApi.Close())
+}
+
+func (suite *GrpcApiTestSuite) TestLogin() {
+	_, err := suite.auth.Login(suite.ctx, &xmv1.LoginRequest{Username: suite.config.AuthUser, Password: "wrong"})
+	suite.Equal(codes.Unauthenticated, status.Code(err))
+
+	response, err := suite.auth.Login(suite.ctx, &xmv1.LoginRequest{Username: suite.config.AuthUser, Password: suite.config.AuthPassword})
+	suite.NoError(err)
+	suite.NotEmpty(response.GetToken())
+	suite.WithinDuration(time.Now().Add(time.Hour), response.GetExpire().AsTime(), time.Minute)
+}
+
+func (suite *GrpcApiTestSuite) TestLogin_RateLimited() {
+	interceptor := rateLimiter(&config.Config{RateLimit: 0.001, RateBurst: 1})
+	info := &grpc.UnaryServerInfo{FullMethod: xmv1.AuthService_Login_FullMethodName}
+	handler := func(context.Context, any) (any, error) { return &xmv1.LoginResponse{}, nil }
+
+	_, err := interceptor(suite.ctx, &xmv1.LoginRequest{}, info, handler)
+	suite.NoError(err)
+	_, err = interceptor(suite.ctx, &xmv1.LoginRequest{}, info, handler)
+	suite.Equal(codes.ResourceExhausted, status.Code(err))
+
+	info = &grpc.UnaryServerInfo{FullMethod: healthpb.Health_Check_FullMethodName}
+	_, err = interceptor(suite.ctx, &healthpb.HealthCheckRequest{}, info, handler)
+	suite.NoError(err)
+}
+
+func (suite *GrpcApiTestSuite) TestCompanies() {
+	ctx := suite.authenticated(suite.config.AuthUser, suite.config.AuthPassword)
+
+	created, err := suite.companies.CreateCompany(ctx, &xmv1.CreateCompanyRequest{Company: testCompany()})
+	suite.NoError(err)
+	suite.NotEmpty(created.GetId())
+	suite.Equal(int64(1), created.GetVersion())
+	suite.Equal(xmv1.CompanyType_COMPANY_TYPE_CORPORATIONS, created.GetType())
+
+	_, err = suite.companies.CreateCompany(ctx, &xmv1.CreateCompanyRequest{Company: testCompany()})
+	suite.Equal(codes.AlreadyExists, status.Code(err))
+
+	invalid := testCompany()
+	invalid.Name = "Invalid"
+	invalid.Type = xmv1.CompanyType_COMPANY_TYPE_UNSPECIFIED
+	_, err = suite.companies.CreateCompany(ctx, &xmv1.CreateCompanyRequest{Company: invalid})
+	suite.Equal(codes.InvalidArgument, status.Code(err))
+	details := status.Convert(err).Details()
+	suite.Len(details, 1)
+	suite.Equal("Type", details[0].(*errdetails.BadRequest).GetFieldViolations()[0].GetField())
+
+	got, err := suite.companies.GetCompany(suite.ctx, &xmv1.GetCompanyRequest{Id: created.GetId()})
+	suite.NoError(err)
+	suite.Equal(created.GetName(), got.GetName())
+
+	_, err = suite.companies.GetCompany(suite.ctx, &xmv1.GetCompanyRequest{Id: "not-an-id"})
+	suite.Equal(codes.InvalidArgument, status.Code(err))
+
+	updated, err := suite.companies.UpdateCompany(ctx, &xmv1.UpdateCompanyRequest{
+		Company:    &xmv1.Company{Id: created.GetId(), Registered: false, Description: "Ignored"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"registered"}},
+		Version:    created.GetVersion(),
+	})
+	suite.NoError(err)
+	suite.False(updated.GetRegistered())
+	suite.Equal(created.GetDescription(), updated.GetDescription())
+	suite.Equal(int64(2), updated.GetVersion())
+
+	_, err = suite.companies.UpdateCompany(ctx, &xmv1.UpdateCompanyRequest{
+		Company:    &xmv1.Company{Id: created.GetId(), Name: "Renamed"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		Version:    created.GetVersion(),
+	})
+	suite.Equal(codes.Aborted, status.Code(err))
+
+	_, err = suite.companies.UpdateCompany(ctx, &xmv1.UpdateCompanyRequest{
+		Company:    &xmv1.Company{Id: created.GetId()},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"id"}},
+	})
+	suite.Equal(codes.InvalidArgument, status.Code(err))
+
+	other := testCompany()
+	other.Name = "Other"
+	_, err = suite.companies.CreateCompany(ctx, &xmv1.CreateCompanyRequest{Company: other})
+	suite.NoError(err)
+
+	registered := false
+	list, err := suite.companies.ListCompanies(suite.ctx, &xmv1.ListCompaniesRequest{Registered: &registered})
+	suite.NoError(err)
+	suite.Len(list.GetCompanies(), 1)
+	suite.Equal(created.GetId(), list.GetCompanies()[0].GetId())
+
+	list, err = suite.companies.ListCompanies(suite.ctx, &xmv1.ListCompaniesRequest{OrderBy: "Name", PageSize: 1})
+	suite.NoError(err)
+	suite.Equal("Other", list.GetCompanies()[0].GetName())
+	list, err = suite.companies.ListCompanies(suite.ctx, &xmv1.ListCompaniesRequest{OrderBy: "Name", PageSize: 1, PageToken: list.GetNextPageToken()})
+	suite.NoError(err)
+	suite.Equal(created.GetId(), list.GetCompanies()[0].GetId())
+	suite.Empty(list.GetNextPageToken())
+
+	_, err = suite.companies.DeleteCompany(ctx, &xmv1.DeleteCompanyRequest{Id: created.GetId(), Version: 1})
+	suite.Equal(codes.Aborted, status.Code(err))
+	_, err = suite.companies.DeleteCompany(ctx, &xmv1.DeleteCompanyRequest{Id: created.GetId()})
+	suite.NoError(err)
+
+	_, err = suite.companies.GetCompany(suite.ctx, &xmv1.GetCompanyRequest{Id: created.GetId()})
+	suite.Equal(codes.NotFound, status.Code(err))
+	_, err = suite.companies.GetCompany(suite.ctx, &xmv1.GetCompanyRequest{Id: created.GetId(), IncludeDeleted: true})
+	suite.Equal(codes.Unauthenticated, status.Code(err))
+	deleted, err := suite.companies.GetCompany(ctx, &xmv1.GetCompanyRequest{Id: created.GetId(), IncludeDeleted: true})
+	suite.NoError(err)
+	suite.NotNil(deleted.GetDeletedAt())
+
+	list, err = suite.companies.ListCompanies(ctx, &xmv1.ListCompaniesRequest{IncludeDeleted: true})
+	suite.NoError(err)
+	suite.Len(list.GetCompanies(), 2)
+
+	restored, err := suite.companies.RestoreCompany(ctx, &xmv1.RestoreCompanyRequest{Id: created.GetId()})
+	suite.NoError(err)
+	suite.Nil(restored.GetDeletedAt())
+
+	history, err := suite.companyService.History(suite.ctx, uuid.MustParse(created.GetId()), 10, "")
+	suite.NoError(err)
+	suite.Equal(suite.config.AuthUser, history.Items[0].ActorUsername)
+}
+
+func (suite *GrpcApiTestSuite) TestPermissions() {
+	_, err := suite.userService.Add("viewer", "viewer-password", model.RoleViewer)
+	suite.NoError(err)
+
+	_, err = suite.companies.CreateCompany(suite.ctx, &xmv1.CreateCompanyRequest{Company: testCompany()})
+	suite.Equal(codes.Unauthenticated, status.Code(err))
+
+	invalidToken := metadata.AppendToOutgoingContext(suite.ctx, "authorization", "Bearer invalid")
+	_, err = suite.companies.CreateCompany(invalidToken, &xmv1.CreateCompanyRequest{Company: testCompany()})
+	suite.Equal(codes.Unauthenticated, status.Code(err))
+
+	viewer := suite.authenticated("viewer", "viewer-password")
+	_, err = suite.companies.CreateCompany(viewer, &xmv1.CreateCompanyRequest{Company: testCompany()})
+	suite.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = suite.companies.ListCompanies(viewer, &xmv1.ListCompaniesRequest{IncludeDeleted: true})
+	suite.Equal(codes.PermissionDenied, status.Code(err))
+
+	// Tokens of removed users are rejected.
+	suite.NoError(suite.userService.Remove("viewer"))
+	_, err = suite.companies.ListCompanies(viewer, &xmv1.ListCompaniesRequest{IncludeDeleted: true})
+	suite.Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *GrpcApiTestSuite) TestHealthAndReflection() {
+	response, err := healthpb.NewHealthClient(suite.conn).Check(suite.ctx, &healthpb.HealthCheckRequest{Service: xmv1.CompanyService_ServiceDesc.ServiceName})
+	suite.NoError(err)
+	suite.Equal(healthpb.HealthCheckResponse_SERVING, response.GetStatus())
+
+	stream, err := reflectionpb.NewServerReflectionClient(suite.conn).ServerReflectionInfo(suite.ctx)
+	suite.NoError(err)
+	suite.NoError(stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}))
+	reflection, err := stream.Recv()
+	suite.NoError(err)
+	var services []string
+	for _, service := range reflection.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	suite.Subset(services, []string{xmv1.AuthService_ServiceDesc.ServiceName, xmv1.CompanyService_ServiceDesc.ServiceName})
+	suite.NoError(stream.CloseSend())
+}
+
+func (suite *GrpcApiTestSuite) authenticated(username string, password string) context.Context {
+	response, err := suite.auth.Login(suite.ctx, &xmv1.LoginRequest{Username: username, Password: password})
+	suite.Require().NoError(err)
+
+	return metadata.AppendToOutgoingContext(suite.ctx, "authorization", "Bearer "+response.GetToken())
+}
+
+func testCompany() *xmv1.Company {
+	return &xmv1.Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              xmv1.CompanyType_COMPANY_TYPE_CORPORATIONS,
+	}
+}
@@ -0,0 +1,32 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/metrics"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// rateLimiter limits the calls with the rate and burst of the REST API, so that the gRPC port, and
+// its Login method in particular, is not an unthrottled way around the limit. The health checks are
+// not limited, as the REST probes.
+func rateLimiter(config *config.Config) grpc.UnaryServerInterceptor {
+	limiter := rate.NewLimiter(rate.Limit(config.RateLimit), config.RateBurst)
+
+	return func(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+			return handler(ctx, request)
+		}
+		if !limiter.Allow() {
+			metrics.RateLimited.Inc()
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+
+		return handler(ctx, request)
+	}
+}
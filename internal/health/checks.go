@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/migration"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Ping checks that the database answers.
+func Ping(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Migrations checks that the schema of the database is the one of this build.
+func Migrations(migrator *migration.Migrator) Check {
+	return func(context.Context) error {
+		return migrator.Check()
+	}
+}
+
+// EventLag checks that the oldest event waiting to be published is not older than maxLag.
+func EventLag(dispatcher *event.Dispatcher, maxLag time.Duration) Check {
+	return func(ctx context.Context) error {
+		lag, err := dispatcher.Lag(ctx)
+		if err != nil {
+			return err
+		}
+		if lag > maxLag {
+			return fmt.Errorf("oldest pending event is %s old, more than %s", lag.Round(time.Second), maxLag)
+		}
+
+		return nil
+	}
+}
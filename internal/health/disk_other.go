@@ -0,0 +1,12 @@
+//go:build !unix
+
+package health
+
+import "context"
+
+// DiskSpace is not checked on this platform.
+func DiskSpace(string, uint64) Check {
+	return func(context.Context) error {
+		return nil
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// DiskSpace checks that the file system of the path has at least minFree bytes available.
+func DiskSpace(path string, minFree uint64) Check {
+	return func(context.Context) error {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err != nil {
+			return err
+		}
+
+		free := uint64(stat.Bavail) * uint64(stat.Bsize)
+		if free < minFree {
+			return fmt.Errorf("%d MB available on %s, less than %d MB", free>>20, path, minFree>>20)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+// Package health serves the liveness and readiness probes of the service.
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/api/middleware"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultTimeout = 2 * time.Second
+
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+	StatusWarning = "warning"
+)
+
+// ErrShuttingDown fails the readiness of a service draining its requests before it stops.
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check returns an error when a dependency of the service is not usable.
+type Check func(ctx context.Context) error
+
+// Report is the answer of a probe.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type namedCheck struct {
+	name     string
+	check    Check
+	critical bool
+}
+
+// Health runs the readiness checks. The service is live as long as it answers, it is ready when
+// every critical check passes and it is not shutting down.
+type Health struct {
+	logger       zerolog.Logger
+	timeout      time.Duration
+	mu           sync.RWMutex
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+func New(logger zerolog.Logger, timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Health{logger: logger, timeout: timeout}
+}
+
+// Add registers a readiness check. The checks run concurrently, each within the timeout.
+func (h *Health) Add(name string, check Check) {
+	h.add(namedCheck{name: name, check: check, critical: true})
+}
+
+// AddWarning registers a check that is reported without failing the readiness, for the problems
+// that taking the service out of the load balancer would not solve, e.g. a broker that is down.
+func (h *Health) AddWarning(name string, check Check) {
+	h.add(namedCheck{name: name, check: check})
+}
+
+// Shutdown fails the readiness from now on, so that no new requests are routed to the service,
+// and returns once delay elapsed, giving the load balancers the time to notice it before the
+// servers are closed.
+func (h *Health) Shutdown(delay time.Duration) {
+	h.shuttingDown.Store(true)
+	if delay > 0 {
+		h.logger.Info().Dur("delay", delay).Msg("Not ready, wait before closing the servers.")
+		time.Sleep(delay)
+	}
+}
+
+// Ready runs the checks and reports whether they all pass.
+func (h *Health) Ready(ctx context.Context) Report {
+	if h.shuttingDown.Load() {
+		return Report{Status: StatusFailing, Checks: []CheckResult{{Name: "shutdown", Status: StatusFailing, Error: ErrShuttingDown.Error()}}}
+	}
+
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = h.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusFailing {
+			report.Status = StatusFailing
+		}
+	}
+
+	return report
+}
+
+// Handler serves /livez and /readyz, answering 503 when the service is not ready.
+func (h *Health) Handler() http.Handler {
+	r := gin.New()
+	r.Use(middleware.Recovery(h.logger))
+	r.GET("/livez", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Report{Status: StatusOK})
+	})
+	r.GET("/readyz", func(c *gin.Context) {
+		report := h.Ready(c.Request.Context())
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	})
+
+	return r
+}
+
+func (h *Health) add(check namedCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, check)
+}
+
+func (h *Health) run(ctx context.Context, check namedCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	err := check.check(ctx)
+	result := CheckResult{
+		Name:       check.name,
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(startedAt).Microseconds()) / 1000,
+	}
+	if err != nil {
+		h.logger.Warn().Err(err).Str("check", check.name).Msg("Health check failed.")
+		result.Status = StatusFailing
+		if !check.critical {
+			result.Status = StatusWarning
+		}
+		result.Error = err.Error()
+	}
+
+	return result
+}
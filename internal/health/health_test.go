@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/migration"
+	"github.com/vcsfrl/xm/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	suite.Run(t, new(HealthFixture))
+}
+
+type HealthFixture struct {
+	suite.Suite
+	health *Health
+}
+
+func (hf *HealthFixture) SetupTest() {
+	hf.health = New(zerolog.Nop(), 100*time.Millisecond)
+}
+
+func (hf *HealthFixture) TestReadyz() {
+	hf.health.Add("ok", func(context.Context) error { return nil })
+	code, report := hf.probe("/readyz")
+	hf.Equal(http.StatusOK, code)
+	hf.Equal(StatusOK, report.Status)
+	hf.Require().Len(report.Checks, 1)
+	hf.Equal(CheckResult{Name: "ok", Status: StatusOK, DurationMs: report.Checks[0].DurationMs}, report.Checks[0])
+
+	hf.health.Add("failing", func(context.Context) error { return errors.New("unreachable") })
+	hf.health.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	code, report = hf.probe("/readyz")
+	hf.Equal(http.StatusServiceUnavailable, code)
+	hf.Equal(StatusFailing, report.Status)
+	hf.Require().Len(report.Checks, 3)
+	hf.Equal(StatusOK, report.Checks[0].Status)
+	hf.Equal("failing", report.Checks[1].Name)
+	hf.Equal("unreachable", report.Checks[1].Error)
+	hf.Equal("slow", report.Checks[2].Name)
+	hf.Equal(context.DeadlineExceeded.Error(), report.Checks[2].Error)
+}
+
+func (hf *HealthFixture) TestReadyz_Warning() {
+	hf.health.Add("ok", func(context.Context) error { return nil })
+	hf.health.AddWarning("events", func(context.Context) error { return errors.New("lagging") })
+
+	code, report := hf.probe("/readyz")
+	hf.Equal(http.StatusOK, code)
+	hf.Equal(StatusOK, report.Status)
+	hf.Require().Len(report.Checks, 2)
+	hf.Equal(StatusOK, report.Checks[0].Status)
+	hf.Equal(StatusWarning, report.Checks[1].Status)
+	hf.Equal("lagging", report.Checks[1].Error)
+}
+
+func (hf *HealthFixture) TestShutdown() {
+	hf.health.Add("ok", func(context.Context) error { return nil })
+	hf.health.Shutdown(0)
+
+	code, report := hf.probe("/readyz")
+	hf.Equal(http.StatusServiceUnavailable, code)
+	hf.Equal(Report{Status: StatusFailing, Checks: []CheckResult{{Name: "shutdown", Status: StatusFailing, Error: ErrShuttingDown.Error()}}}, report)
+
+	// The service stays live while it drains its requests.
+	code, report = hf.probe("/livez")
+	hf.Equal(http.StatusOK, code)
+	hf.Equal(Report{Status: StatusOK}, report)
+}
+
+func (hf *HealthFixture) TestShutdown_Delay() {
+	delay := 500 * time.Millisecond
+	startedAt := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hf.health.Shutdown(delay)
+	}()
+
+	// Not ready while the servers are still open.
+	hf.Eventually(func() bool {
+		code, _ := hf.probe("/readyz")
+		return code == http.StatusServiceUnavailable
+	}, delay, 10*time.Millisecond)
+	select {
+	case <-done:
+		hf.Fail("shutdown returned before the delay")
+	default:
+	}
+
+	<-done
+	hf.GreaterOrEqual(time.Since(startedAt), delay)
+}
+
+func (hf *HealthFixture) TestChecks() {
+	database, err := db.InitTestSqlite()
+	hf.Require().NoError(err)
+	migrator, err := migration.NewMigrator(database, zerolog.Nop())
+	hf.Require().NoError(err)
+	dispatcher := event.NewDispatcher(database, event.NewMemoryPublisher(), zerolog.Nop(), time.Second, 3)
+	ctx := context.Background()
+
+	hf.NoError(Ping(database)(ctx))
+	hf.NoError(Migrations(migrator)(ctx))
+	hf.NoError(EventLag(dispatcher, time.Minute)(ctx))
+	hf.NoError(DiskSpace(hf.T().TempDir(), 1)(ctx))
+	hf.ErrorContains(DiskSpace(hf.T().TempDir(), 1<<62)(ctx), "MB available")
+
+	hf.NoError(database.Create(&model.OutboxEvent{Type: model.EventCompanyCreated, AggregateID: uuid.New(), Payload: "{}", CreatedAt: time.Now().Add(-2 * time.Minute)}).Error)
+	hf.ErrorContains(EventLag(dispatcher, time.Minute)(ctx), "oldest pending event is 2m0s old")
+
+	_, err = migrator.Down(1)
+	hf.NoError(err)
+	hf.ErrorIs(Migrations(migrator)(ctx), migration.ErrSchemaBehind)
+
+	sqlDB, err := database.DB()
+	hf.NoError(err)
+	hf.NoError(sqlDB.Close())
+	hf.Error(Ping(database)(ctx))
+}
+
+func (hf *HealthFixture) probe(target string) (int, Report) {
+	w := httptest.NewRecorder()
+	hf.health.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	hf.Equal("application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var report Report
+	hf.NoError(json.Unmarshal(w.Body.Bytes(), &report))
+
+	return w.Code, report
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+	"time"
+)
+
+const startedAtKey = "metrics:started_at"
+
+// RegisterDB measures the queries of the database and exposes the stats of its connection pool,
+// labelled with the name. It is meant to be called once, for the database of the application.
+func RegisterDB(db *gorm.DB, name string) error {
+	if err := db.Use(&gormPlugin{}); err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return Registry.Register(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// gormPlugin observes the duration of the queries with callbacks around every GORM operation.
+type gormPlugin struct{}
+
+func (p *gormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("metrics:before_create", start),
+		callbacks.Create().After("gorm:create").Register("metrics:after_create", observe("create")),
+		callbacks.Query().Before("gorm:query").Register("metrics:before_query", start),
+		callbacks.Query().After("gorm:query").Register("metrics:after_query", observe("query")),
+		callbacks.Update().Before("gorm:update").Register("metrics:before_update", start),
+		callbacks.Update().After("gorm:update").Register("metrics:after_update", observe("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", start),
+		callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")),
+		callbacks.Row().Before("gorm:row").Register("metrics:before_row", start),
+		callbacks.Row().After("gorm:row").Register("metrics:after_row", observe("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", start),
+		callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw")),
+	)
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startedAtKey, time.Now())
+}
+
+func observe(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, found := db.InstanceGet(startedAtKey)
+		if !found {
+			return
+		}
+		if startedAt, ok := value.(time.Time); ok {
+			DBQueryDuration.WithLabelValues(operation).Observe(time.Since(startedAt).Seconds())
+		}
+	}
+}
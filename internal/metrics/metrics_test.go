@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	suite.Run(t, new(MetricsFixture))
+}
+
+type MetricsFixture struct {
+	suite.Suite
+}
+
+func (mf *MetricsFixture) TestRegisterDB() {
+	database, err := db.InitTestSqlite()
+	mf.NoError(err)
+	mf.NoError(RegisterDB(database, "test"))
+
+	queries := mf.queryCount("query")
+	creates := mf.queryCount("create")
+	mf.NoError(database.Create(&model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}).Error)
+	var companies []model.Company
+	mf.NoError(database.Find(&companies).Error)
+
+	mf.Equal(queries+1, mf.queryCount("query"))
+	mf.Equal(creates+1, mf.queryCount("create"))
+
+	body := mf.scrape()
+	mf.Contains(body, `go_sql_open_connections{db_name="test"}`)
+	mf.Contains(body, `xm_db_query_duration_seconds_bucket{operation="query"`)
+}
+
+func (mf *MetricsFixture) TestHandler() {
+	Logins.WithLabelValues(LoginFailure).Inc()
+	RateLimited.Inc()
+
+	body := mf.scrape()
+	mf.Contains(body, `xm_auth_logins_total{result="failure"}`)
+	mf.Contains(body, "xm_http_rate_limited_total")
+	mf.Contains(body, "go_goroutines")
+}
+
+func (mf *MetricsFixture) scrape() string {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	mf.Equal(http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	mf.NoError(err)
+
+	return string(body)
+}
+
+// queryCount returns the number of observed queries of the operation.
+func (mf *MetricsFixture) queryCount(operation string) uint64 {
+	families, err := Registry.Gather()
+	mf.Require().NoError(err)
+	for _, family := range families {
+		if family.GetName() != "xm_db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "operation" && label.GetValue() == operation {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+
+	return 0
+}
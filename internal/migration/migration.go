@@ -0,0 +1,371 @@
+package migration
+
+import (
+	"cmp"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql
+var migrationFiles embed.FS
+
+var (
+	ErrMigration    = errors.New("migration error")
+	ErrSchemaBehind = errors.New("database schema is behind, run: xm migrate up")
+	ErrSchemaAhead  = errors.New("database schema is ahead of the application")
+
+	migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	migrationName     = regexp.MustCompile(`^\w+$`)
+)
+
+// migrationLock is the key of the PostgreSQL advisory lock serializing the migrators, "xm_migra" in ASCII.
+const migrationLock int64 = 0x786d5f6d69677261
+
+// Drivers lists the database drivers that have their own migration directory.
+var Drivers = []string{"sqlite", "postgres"}
+
+// Migration is a single schema change with its rollback.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// Status is the state of a known migration.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations of the database driver in version order.
+type Migrator struct {
+	db         *gorm.DB
+	logger     zerolog.Logger
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, logger zerolog.Logger) (*Migrator, error) {
+	migrations, err := Load(migrationFiles, "sql/"+db.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, logger: logger, migrations: migrations}, nil
+}
+
+// Load reads the migrations of a directory, sorted by version.
+func Load(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read %s: %w", ErrMigration, dir, err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: version of %s: %w", ErrMigration, entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(files, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%w: read %s: %w", ErrMigration, entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s", ErrMigration, version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: migration %d has no up script", ErrMigration, migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return migrations, nil
+}
+
+// Up applies the pending migrations, at most steps of them when steps is positive.
+// It returns the number of applied migrations. Each migration is applied and recorded under
+// the migration lock, so that the instances started together apply it once.
+func (m *Migrator) Up(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if steps > 0 && count >= steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		done := false
+		err := m.transaction(func(tx *gorm.DB) error {
+			// Another instance may have applied it while this one waited for the lock.
+			recorded, err := m.recorded(tx, migration.Version)
+			if err != nil || recorded {
+				return err
+			}
+
+			m.logger.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("Apply migration.")
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			done = true
+
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("%w: up %d_%s: %w", ErrMigration, migration.Version, migration.Name, err)
+		}
+		if done {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Down rolls back the last steps applied migrations and returns how many were rolled back.
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range slices.Backward(m.migrations) {
+		if count >= steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return count, fmt.Errorf("%w: migration %d_%s is irreversible", ErrMigration, migration.Version, migration.Name)
+		}
+
+		done := false
+		err := m.transaction(func(tx *gorm.DB) error {
+			recorded, err := m.recorded(tx, migration.Version)
+			if err != nil || !recorded {
+				return err
+			}
+
+			m.logger.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("Roll back migration.")
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			done = true
+
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("%w: down %d_%s: %w", ErrMigration, migration.Version, migration.Name, err)
+		}
+		if done {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Status lists the known migrations and when they were applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if schemaMigration, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &schemaMigration.AppliedAt
+		}
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+// Check returns ErrSchemaBehind when migrations are pending and ErrSchemaAhead when
+// the database has migrations this build does not know about.
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int64]struct{}, len(m.migrations))
+	pending := 0
+	for _, migration := range m.migrations {
+		known[migration.Version] = struct{}{}
+		if _, ok := applied[migration.Version]; !ok {
+			pending++
+		}
+	}
+	for version := range applied {
+		if _, ok := known[version]; !ok {
+			return fmt.Errorf("%w: unknown version %d", ErrSchemaAhead, version)
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d pending migration(s)", ErrSchemaBehind, pending)
+	}
+
+	return nil
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		// Under the lock, the instances started on an empty database do not all create the table.
+		if err := m.transaction(func(tx *gorm.DB) error { return tx.AutoMigrate(&SchemaMigration{}) }); err != nil {
+			return nil, fmt.Errorf("%w: schema_migrations: %w", ErrMigration, err)
+		}
+	}
+	if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("%w: schema_migrations: %w", ErrMigration, err)
+	}
+
+	var schemaMigrations []SchemaMigration
+	if err := m.db.Find(&schemaMigrations).Error; err != nil {
+		return nil, fmt.Errorf("%w: schema_migrations: %w", ErrMigration, err)
+	}
+
+	applied := make(map[int64]SchemaMigration, len(schemaMigrations))
+	for _, schemaMigration := range schemaMigrations {
+		applied[schemaMigration.Version] = schemaMigration
+	}
+
+	return applied, nil
+}
+
+// recorded tells whether the migration of version is recorded as applied.
+func (m *Migrator) recorded(tx *gorm.DB, version int64) (bool, error) {
+	var count int64
+	if err := tx.Model(&SchemaMigration{}).Where("version = ?", version).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// transaction runs fn in a transaction holding the migration lock: a PostgreSQL advisory lock,
+// released on commit, or an immediate SQLite transaction, which takes the write lock on BEGIN
+// rather than on the first write.
+func (m *Migrator) transaction(fn func(tx *gorm.DB) error) error {
+	if m.db.Dialector.Name() == "postgres" {
+		return m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+				return err
+			}
+
+			return fn(tx)
+		})
+	}
+
+	// database/sql cannot begin an immediate transaction: it is begun on a dedicated connection,
+	// without the transactions GORM opens around its writes.
+	return m.db.Connection(func(conn *gorm.DB) error {
+		tx := conn.Session(&gorm.Session{SkipDefaultTransaction: true})
+		if err := tx.Exec("BEGIN IMMEDIATE").Error; err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			_ = tx.Exec("ROLLBACK").Error
+			return err
+		}
+
+		return tx.Exec("COMMIT").Error
+	})
+}
+
+// Create writes empty up and down scripts of a new migration for every driver
+// under dir, numbered after the highest existing version, and returns their paths.
+func Create(dir string, name string) ([]string, error) {
+	if !migrationName.MatchString(name) {
+		return nil, fmt.Errorf("%w: invalid name %q, use letters, digits and underscores", ErrMigration, name)
+	}
+
+	var version int64
+	for _, driver := range Drivers {
+		migrations, err := Load(os.DirFS(dir), driver)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, migration := range migrations {
+			version = max(version, migration.Version)
+		}
+	}
+	version++
+
+	var paths []string
+	for _, driver := range Drivers {
+		if err := os.MkdirAll(filepath.Join(dir, driver), 0o755); err != nil {
+			return nil, fmt.Errorf("%w: create: %w", ErrMigration, err)
+		}
+
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(dir, driver, fmt.Sprintf("%04d_%s.%s.sql", version, strings.ToLower(name), direction))
+			content := fmt.Sprintf("-- %04d_%s (%s, %s)\n", version, name, driver, direction)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return nil, fmt.Errorf("%w: create: %w", ErrMigration, err)
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,155 @@
+package migration
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrator(t *testing.T) {
+	suite.Run(t, new(MigratorFixture))
+}
+
+type MigratorFixture struct {
+	suite.Suite
+
+	db       *gorm.DB
+	migrator *Migrator
+}
+
+func (mf *MigratorFixture) SetupTest() {
+	var err error
+	mf.db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	mf.Require().NoError(err)
+
+	mf.migrator, err = NewMigrator(mf.db, zerolog.Nop())
+	mf.Require().NoError(err)
+}
+
+func (mf *MigratorFixture) TestUpAndDown() {
+	mf.ErrorIs(mf.migrator.Check(), ErrSchemaBehind)
+
+	count, err := mf.migrator.Up(1)
+	mf.NoError(err)
+	mf.Equal(1, count)
+	mf.ErrorIs(mf.migrator.Check(), ErrSchemaBehind)
+
+	count, err = mf.migrator.Up(0)
+	mf.NoError(err)
+	mf.Equal(len(mf.migrator.migrations)-1, count)
+	mf.NoError(mf.migrator.Check())
+	mf.True(mf.db.Migrator().HasTable("companies"))
+
+	statuses, err := mf.migrator.Status()
+	mf.NoError(err)
+	for _, status := range statuses {
+		mf.NotNil(status.AppliedAt, status.Name)
+	}
+
+	count, err = mf.migrator.Down(len(statuses))
+	mf.NoError(err)
+	mf.Equal(len(statuses), count)
+	mf.False(mf.db.Migrator().HasTable("companies"))
+}
+
+func (mf *MigratorFixture) TestUp_Concurrent() {
+	// Two instances started together on the same database.
+	path := filepath.Join(mf.T().TempDir(), "xm.db")
+	var migrators []*Migrator
+	for range 2 {
+		db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+		mf.Require().NoError(err)
+		migrator, err := NewMigrator(db, zerolog.Nop())
+		mf.Require().NoError(err)
+		migrators = append(migrators, migrator)
+	}
+
+	counts := make([]int, len(migrators))
+	errs := make([]error, len(migrators))
+	var wg sync.WaitGroup
+	for i, migrator := range migrators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts[i], errs[i] = migrator.Up(0)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		mf.NoError(err)
+	}
+	mf.Equal(len(migrators[0].migrations), counts[0]+counts[1])
+	mf.NoError(migrators[0].Check())
+	mf.NoError(migrators[1].Check())
+}
+
+func (mf *MigratorFixture) TestWidenCompanyName() {
+	_, err := mf.migrator.Up(1)
+	mf.NoError(err)
+	mf.NoError(mf.db.Exec("INSERT INTO companies (id, name, amount_of_employees, registered, type) VALUES ('1', 'Kept', 1, 1, 'Cooperative')").Error)
+
+	_, err = mf.migrator.Up(0)
+	mf.NoError(err)
+
+	var names []string
+	mf.NoError(mf.db.Table("companies").Pluck("name", &names).Error)
+	mf.Equal([]string{"Kept"}, names)
+
+	var sql string
+	mf.NoError(mf.db.Raw("SELECT sql FROM sqlite_master WHERE name = 'companies'").Scan(&sql).Error)
+	mf.Contains(sql, "varchar(255)")
+}
+
+func (mf *MigratorFixture) TestCheck_SchemaAhead() {
+	_, err := mf.migrator.Up(0)
+	mf.NoError(err)
+	mf.NoError(mf.db.Create(&SchemaMigration{Version: 9999, Name: "future"}).Error)
+
+	mf.ErrorIs(mf.migrator.Check(), ErrSchemaAhead)
+}
+
+func (mf *MigratorFixture) TestLoad() {
+	migrations, err := Load(fstest.MapFS{
+		"sql/0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+		"sql/0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+		"sql/0001_first.down.sql":  {Data: []byte("SELECT -1;")},
+		"sql/README.md":            {Data: []byte("ignored")},
+		"sql/0003_broken.down.sql": {Data: []byte("SELECT -3;")},
+	}, "sql")
+	mf.ErrorIs(err, ErrMigration)
+	mf.Nil(migrations)
+
+	migrations, err = Load(fstest.MapFS{
+		"sql/0002_second.up.sql":  {Data: []byte("SELECT 2;")},
+		"sql/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+		"sql/0001_first.down.sql": {Data: []byte("SELECT -1;")},
+	}, "sql")
+	mf.NoError(err)
+	mf.Len(migrations, 2)
+	mf.Equal(int64(1), migrations[0].Version)
+	mf.Equal("SELECT -1;", migrations[0].Down)
+	mf.Equal("second", migrations[1].Name)
+	mf.Empty(migrations[1].Down)
+}
+
+func (mf *MigratorFixture) TestCreate() {
+	dir := mf.T().TempDir()
+	mf.NoError(os.MkdirAll(filepath.Join(dir, "sqlite"), 0o755))
+	mf.NoError(os.WriteFile(filepath.Join(dir, "sqlite", "0007_existing.up.sql"), []byte("SELECT 1;"), 0o644))
+
+	paths, err := Create(dir, "add_index")
+	mf.NoError(err)
+	mf.Len(paths, 2*len(Drivers))
+	mf.FileExists(filepath.Join(dir, "sqlite", "0008_add_index.up.sql"))
+	mf.FileExists(filepath.Join(dir, "postgres", "0008_add_index.down.sql"))
+
+	_, err = Create(dir, "not valid")
+	mf.ErrorIs(err, ErrMigration)
+}
@@ -0,0 +1 @@
+ALTER TABLE "companies" ALTER COLUMN "name" TYPE varchar(255);
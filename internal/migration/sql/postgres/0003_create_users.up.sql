@@ -0,0 +1,9 @@
+CREATE TABLE "users" (
+    "id" bigserial,
+    "username" varchar(100) NOT NULL,
+    "password_hash" varchar(255) NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_users_username" UNIQUE ("username")
+);
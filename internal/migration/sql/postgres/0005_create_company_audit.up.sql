@@ -0,0 +1,12 @@
+CREATE TABLE "company_audit" (
+    "id" bigserial,
+    "company_id" uuid NOT NULL,
+    "action" varchar(20) NOT NULL,
+    "actor_id" bigint,
+    "actor_username" varchar(100),
+    "request_id" varchar(100),
+    "changes" text,
+    "created_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_company_audit_company_id" ON "company_audit" ("company_id");
@@ -0,0 +1 @@
+ALTER TABLE "companies" ADD COLUMN "version" integer NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE "companies" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_companies_deleted_at" ON "companies" ("deleted_at");
@@ -0,0 +1,2 @@
+DROP INDEX "idx_companies_search";
+ALTER TABLE "companies" DROP COLUMN "search";
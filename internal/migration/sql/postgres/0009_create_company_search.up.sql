@@ -0,0 +1,7 @@
+-- Full-text index of the names and descriptions of the companies, names weigh more.
+-- The simple configuration neither stems nor drops stop words, like the SQLite index.
+ALTER TABLE "companies" ADD COLUMN "search" tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce("name", '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce("description", '')), 'B')
+) STORED;
+CREATE INDEX "idx_companies_search" ON "companies" USING gin ("search");
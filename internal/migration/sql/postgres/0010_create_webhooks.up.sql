@@ -0,0 +1,30 @@
+CREATE TABLE "webhooks" (
+    "id" uuid,
+    "url" varchar(2000) NOT NULL,
+    "secret" varchar(100) NOT NULL,
+    "events" text,
+    "company_ids" text,
+    "last_event_id" bigint NOT NULL DEFAULT 0,
+    "created_at" timestamptz NOT NULL,
+    "updated_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE "webhook_deliveries" (
+    "id" bigserial,
+    "webhook_id" uuid NOT NULL,
+    "event_id" bigint NOT NULL,
+    "event_type" varchar(50) NOT NULL,
+    "payload" text NOT NULL,
+    "status" varchar(20) NOT NULL,
+    "attempts" bigint NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamptz,
+    "last_attempt_at" timestamptz,
+    "response_status" bigint,
+    "last_error" varchar(500),
+    "created_at" timestamptz NOT NULL,
+    "updated_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_webhook_deliveries_webhook_id" ON "webhook_deliveries" ("webhook_id");
+CREATE INDEX "idx_webhook_deliveries_status_next_attempt_at" ON "webhook_deliveries" ("status", "next_attempt_at");
@@ -0,0 +1,3 @@
+ALTER TABLE "outbox_events" ADD COLUMN "next_attempt_at" timestamptz;
+ALTER TABLE "outbox_events" ADD COLUMN "dead_at" timestamptz;
+CREATE INDEX "idx_outbox_events_dead_at" ON "outbox_events" ("dead_at");
@@ -0,0 +1,2 @@
+DROP INDEX "idx_outbox_events_sequence";
+ALTER TABLE "outbox_events" DROP COLUMN "sequence";
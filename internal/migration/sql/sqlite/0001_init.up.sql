@@ -0,0 +1,27 @@
+-- Baseline schema, as previously created by GORM AutoMigrate.
+CREATE TABLE IF NOT EXISTS `companies` (
+    `id` uuid,
+    `name` varchar(50) NOT NULL,
+    `description` varchar(3000),
+    `amount_of_employees` integer NOT NULL,
+    `registered` numeric NOT NULL,
+    `type` varchar(20) NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `uni_companies_name` UNIQUE (`name`)
+);
+
+CREATE TABLE IF NOT EXISTS `outbox_events` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `type` varchar(50) NOT NULL,
+    `aggregate_id` uuid NOT NULL,
+    `payload` text NOT NULL,
+    `created_at` datetime NOT NULL,
+    `published_at` datetime,
+    `attempts` integer NOT NULL DEFAULT 0,
+    `last_error` varchar(500)
+);
+
+CREATE INDEX IF NOT EXISTS `idx_outbox_events_published_at` ON `outbox_events`(`published_at`);
+CREATE INDEX IF NOT EXISTS `idx_outbox_events_aggregate_id` ON `outbox_events`(`aggregate_id`);
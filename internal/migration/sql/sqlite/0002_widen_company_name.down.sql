@@ -0,0 +1,15 @@
+CREATE TABLE `companies_old` (
+    `id` uuid,
+    `name` varchar(50) NOT NULL,
+    `description` varchar(3000),
+    `amount_of_employees` integer NOT NULL,
+    `registered` numeric NOT NULL,
+    `type` varchar(20) NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `uni_companies_name` UNIQUE (`name`)
+);
+INSERT INTO `companies_old` SELECT `id`, substr(`name`, 1, 50), `description`, `amount_of_employees`, `registered`, `type`, `created_at`, `updated_at` FROM `companies`;
+DROP TABLE `companies`;
+ALTER TABLE `companies_old` RENAME TO `companies`;
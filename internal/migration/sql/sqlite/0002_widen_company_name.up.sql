@@ -0,0 +1,16 @@
+-- SQLite cannot alter a column type, so the table is rebuilt.
+CREATE TABLE `companies_new` (
+    `id` uuid,
+    `name` varchar(255) NOT NULL,
+    `description` varchar(3000),
+    `amount_of_employees` integer NOT NULL,
+    `registered` numeric NOT NULL,
+    `type` varchar(20) NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `uni_companies_name` UNIQUE (`name`)
+);
+INSERT INTO `companies_new` SELECT `id`, `name`, `description`, `amount_of_employees`, `registered`, `type`, `created_at`, `updated_at` FROM `companies`;
+DROP TABLE `companies`;
+ALTER TABLE `companies_new` RENAME TO `companies`;
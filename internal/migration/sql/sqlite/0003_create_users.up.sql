@@ -0,0 +1,8 @@
+CREATE TABLE `users` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `username` varchar(100) NOT NULL,
+    `password_hash` varchar(255) NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    CONSTRAINT `uni_users_username` UNIQUE (`username`)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `users` ADD COLUMN `role` varchar(20) NOT NULL DEFAULT 'viewer';
+-- Every existing user had full access before roles were introduced.
+UPDATE `users` SET `role` = 'admin';
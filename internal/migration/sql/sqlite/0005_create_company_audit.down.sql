@@ -0,0 +1 @@
+DROP TABLE `company_audit`;
@@ -0,0 +1,11 @@
+CREATE TABLE `company_audit` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `company_id` uuid NOT NULL,
+    `action` varchar(20) NOT NULL,
+    `actor_id` integer,
+    `actor_username` varchar(100),
+    `request_id` varchar(100),
+    `changes` text,
+    `created_at` datetime NOT NULL
+);
+CREATE INDEX `idx_company_audit_company_id` ON `company_audit`(`company_id`);
@@ -0,0 +1,2 @@
+DROP INDEX `idx_companies_deleted_at`;
+ALTER TABLE `companies` DROP COLUMN `deleted_at`;
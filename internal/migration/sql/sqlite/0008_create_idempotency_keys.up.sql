@@ -0,0 +1,12 @@
+CREATE TABLE `idempotency_keys` (
+    `scope` varchar(255) NOT NULL,
+    `key` varchar(255) NOT NULL,
+    `request_hash` varchar(64) NOT NULL,
+    `status` integer NOT NULL DEFAULT 0,
+    `headers` text,
+    `body` blob,
+    `created_at` datetime NOT NULL,
+    `expires_at` datetime NOT NULL,
+    PRIMARY KEY (`scope`, `key`)
+);
+CREATE INDEX `idx_idempotency_keys_expires_at` ON `idempotency_keys`(`expires_at`);
@@ -0,0 +1,5 @@
+DROP TRIGGER `companies_fts_after_delete`;
+DROP TRIGGER `companies_fts_after_update`;
+DROP TRIGGER `companies_fts_after_insert`;
+DROP TABLE `companies_fts`;
+DROP TABLE `companies_fts_keys`;
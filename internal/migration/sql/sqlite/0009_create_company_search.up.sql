@@ -0,0 +1,36 @@
+-- Full-text index of the names and descriptions of the companies.
+-- FTS5 needs the sqlite_fts5 build tag of go-sqlite3, see the Makefile.
+-- The rows of the index are keyed by companies_fts_keys rather than by the rowid of companies, which
+-- has a uuid primary key and may renumber its rows on VACUUM. The triggers keep the index in sync.
+CREATE TABLE `companies_fts_keys` (
+    `key` integer PRIMARY KEY AUTOINCREMENT,
+    `company_id` uuid NOT NULL UNIQUE
+);
+
+CREATE VIRTUAL TABLE `companies_fts` USING fts5(
+    `name`,
+    `description`,
+    tokenize = 'unicode61 remove_diacritics 1',
+    prefix = '2 3'
+);
+
+CREATE TRIGGER `companies_fts_after_insert` AFTER INSERT ON `companies` BEGIN
+    INSERT INTO `companies_fts_keys`(`company_id`) VALUES (new.`id`);
+    INSERT INTO `companies_fts`(`rowid`, `name`, `description`)
+        SELECT `key`, new.`name`, new.`description` FROM `companies_fts_keys` WHERE `company_id` = new.`id`;
+END;
+
+CREATE TRIGGER `companies_fts_after_update` AFTER UPDATE OF `name`, `description` ON `companies` BEGIN
+    UPDATE `companies_fts` SET `name` = new.`name`, `description` = new.`description`
+        WHERE `rowid` = (SELECT `key` FROM `companies_fts_keys` WHERE `company_id` = new.`id`);
+END;
+
+CREATE TRIGGER `companies_fts_after_delete` AFTER DELETE ON `companies` BEGIN
+    DELETE FROM `companies_fts` WHERE `rowid` = (SELECT `key` FROM `companies_fts_keys` WHERE `company_id` = old.`id`);
+    DELETE FROM `companies_fts_keys` WHERE `company_id` = old.`id`;
+END;
+
+INSERT INTO `companies_fts_keys`(`company_id`) SELECT `id` FROM `companies` ORDER BY `created_at`, `id`;
+INSERT INTO `companies_fts`(`rowid`, `name`, `description`)
+    SELECT `companies_fts_keys`.`key`, `companies`.`name`, `companies`.`description`
+    FROM `companies_fts_keys` JOIN `companies` ON `companies`.`id` = `companies_fts_keys`.`company_id`;
@@ -0,0 +1,29 @@
+CREATE TABLE `webhooks` (
+    `id` uuid,
+    `url` varchar(2000) NOT NULL,
+    `secret` varchar(100) NOT NULL,
+    `events` text,
+    `company_ids` text,
+    `last_event_id` integer NOT NULL DEFAULT 0,
+    `created_at` datetime NOT NULL,
+    `updated_at` datetime NOT NULL,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE `webhook_deliveries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `webhook_id` uuid NOT NULL,
+    `event_id` integer NOT NULL,
+    `event_type` varchar(50) NOT NULL,
+    `payload` text NOT NULL,
+    `status` varchar(20) NOT NULL,
+    `attempts` integer NOT NULL DEFAULT 0,
+    `next_attempt_at` datetime,
+    `last_attempt_at` datetime,
+    `response_status` integer,
+    `last_error` varchar(500),
+    `created_at` datetime NOT NULL,
+    `updated_at` datetime NOT NULL
+);
+CREATE INDEX `idx_webhook_deliveries_webhook_id` ON `webhook_deliveries`(`webhook_id`);
+CREATE INDEX `idx_webhook_deliveries_status_next_attempt_at` ON `webhook_deliveries`(`status`, `next_attempt_at`);
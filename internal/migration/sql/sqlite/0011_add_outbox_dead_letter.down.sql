@@ -0,0 +1,3 @@
+DROP INDEX `idx_outbox_events_dead_at`;
+ALTER TABLE `outbox_events` DROP COLUMN `dead_at`;
+ALTER TABLE `outbox_events` DROP COLUMN `next_attempt_at`;
@@ -0,0 +1,3 @@
+ALTER TABLE `outbox_events` ADD COLUMN `sequence` integer;
+UPDATE `outbox_events` SET `sequence` = `id`;
+CREATE UNIQUE INDEX `idx_outbox_events_sequence` ON `outbox_events` (`sequence`);
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// FieldChange holds the values of a company field before and after a change.
+// Before is nil on create and After is nil on delete.
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// CompanyAudit is an append-only record of a company change.
+type CompanyAudit struct {
+	ID            uint64                 `gorm:"primaryKey;autoIncrement" json:"ID"`
+	CompanyID     uuid.UUID              `gorm:"type:uuid;not null;index" json:"CompanyID"`
+	Action        string                 `gorm:"type:varchar(20);not null" json:"Action"`
+	ActorID       uint                   `json:"ActorID,omitempty"`
+	ActorUsername string                 `gorm:"type:varchar(100)" json:"Actor,omitempty"`
+	RequestID     string                 `gorm:"type:varchar(100)" json:"RequestID,omitempty"`
+	Changes       map[string]FieldChange `gorm:"type:text;serializer:json" json:"Changes"`
+	CreatedAt     time.Time              `gorm:"not null" json:"CreatedAt"`
+}
+
+func (CompanyAudit) TableName() string {
+	return "company_audit"
+}
@@ -23,17 +23,20 @@ var CompanyTypes = []CompanyType{
 }
 
 type Company struct {
-	ID                uuid.UUID   `gorm:"type:uuid;primary_key;" json:"ID,omitempty"`
-	Name              string      `gorm:"type:varchar(50);unique;not null" json:"Name,omitempty" validate:"required"`
-	Description       string      `gorm:"type:varchar(3000)" json:"Description,omitempty"`
-	AmountOfEmployees int         `gorm:"not null" json:"AmountOfEmployees,omitempty" validate:"required"`
-	Registered        bool        `gorm:"not null" json:"Registered"`
-	Type              CompanyType `gorm:"type:varchar(20);not null" json:"Type,omitempty" validate:"required,company_type"`
-	CreatedAt         time.Time   `json:"-"`
-	UpdatedAt         time.Time   `json:"-"`
+	ID                uuid.UUID      `gorm:"type:uuid;primary_key;" json:"ID,omitempty"`
+	Name              string         `gorm:"type:varchar(255);unique;not null" json:"Name,omitempty" validate:"required,max=255"`
+	Description       string         `gorm:"type:varchar(3000)" json:"Description,omitempty"`
+	AmountOfEmployees int            `gorm:"not null" json:"AmountOfEmployees" validate:"min=0"`
+	Registered        bool           `gorm:"not null" json:"Registered"`
+	Type              CompanyType    `gorm:"type:varchar(20);not null" json:"Type,omitempty" validate:"required,company_type"`
+	Version           int            `gorm:"not null;default:1" json:"-"`
+	CreatedAt         time.Time      `json:"-"`
+	UpdatedAt         time.Time      `json:"-"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 func (company *Company) BeforeCreate(tx *gorm.DB) (err error) {
 	company.ID = uuid.New()
+	company.Version = 1
 	return
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	EventCompanyCreated  = "CompanyCreated"
+	EventCompanyUpdated  = "CompanyUpdated"
+	EventCompanyDeleted  = "CompanyDeleted"
+	EventCompanyRestored = "CompanyRestored"
+)
+
+// OutboxEvent is a change event recorded in the same transaction as the change itself.
+// The ID is allocated when the event is written, so a lower ID can be committed after a higher
+// one. The Sequence is numbered once the event is committed and orders the change feed.
+//
+// An event that failed to be published is retried at NextAttemptAt; once it failed too many
+// times it is dead, DeadAt is set, and it is not published until it is requeued.
+type OutboxEvent struct {
+	ID            uint64     `gorm:"primaryKey;autoIncrement"`
+	Sequence      *uint64    `gorm:"uniqueIndex"`
+	Type          string     `gorm:"type:varchar(50);not null"`
+	AggregateID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Payload       string     `gorm:"type:text;not null"`
+	CreatedAt     time.Time  `gorm:"not null"`
+	PublishedAt   *time.Time `gorm:"index"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"type:varchar(500)"`
+	NextAttemptAt *time.Time
+	DeadAt        *time.Time `gorm:"index"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// IdempotencyKey records a request made with an Idempotency-Key header and, once it
+// completed, its response. A key with a zero Status is still being processed.
+type IdempotencyKey struct {
+	Scope       string            `gorm:"type:varchar(255);primaryKey"`
+	Key         string            `gorm:"type:varchar(255);primaryKey"`
+	RequestHash string            `gorm:"type:varchar(64);not null"`
+	Status      int               `gorm:"not null;default:0"`
+	Headers     map[string]string `gorm:"type:text;serializer:json"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import "slices"
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+var Roles = []Role{
+	RoleViewer,
+	RoleEditor,
+	RoleAdmin,
+}
+
+type Permission string
+
+const (
+	PermissionCompanyRead        Permission = "company:read"
+	PermissionCompanyCreate      Permission = "company:create"
+	PermissionCompanyUpdate      Permission = "company:update"
+	PermissionCompanyDelete      Permission = "company:delete"
+	PermissionCompanyReadDeleted Permission = "company:read_deleted"
+	PermissionCompanyRestore     Permission = "company:restore"
+	PermissionWebhookManage      Permission = "webhook:manage"
+)
+
+// RolePermissions lists the permissions granted to every role.
+var RolePermissions = map[Role][]Permission{
+	RoleViewer: {
+		PermissionCompanyRead,
+	},
+	RoleEditor: {
+		PermissionCompanyRead,
+		PermissionCompanyCreate,
+		PermissionCompanyUpdate,
+	},
+	RoleAdmin: {
+		PermissionCompanyRead,
+		PermissionCompanyCreate,
+		PermissionCompanyUpdate,
+		PermissionCompanyDelete,
+		PermissionCompanyReadDeleted,
+		PermissionCompanyRestore,
+		PermissionWebhookManage,
+	},
+}
+
+func (role Role) Valid() bool {
+	return slices.Contains(Roles, role)
+}
+
+func (role Role) Can(permission Permission) bool {
+	return slices.Contains(RolePermissions[role], permission)
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type User struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement"`
+	Username     string `gorm:"type:varchar(100);unique;not null"`
+	PasswordHash string `gorm:"type:varchar(255);not null"`
+	Role         Role   `gorm:"type:varchar(20);not null;default:viewer"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	// WebhookDeliveryDead marks the deliveries that failed every attempt, the dead-letter list.
+	WebhookDeliveryDead = "dead"
+)
+
+var WebhookDeliveryStatuses = []string{
+	WebhookDeliveryPending,
+	WebhookDeliverySucceeded,
+	WebhookDeliveryDead,
+}
+
+// EventTypes lists the types of the company change events.
+var EventTypes = []string{
+	EventCompanyCreated,
+	EventCompanyUpdated,
+	EventCompanyDeleted,
+	EventCompanyRestored,
+}
+
+// Webhook is a subscription of a partner endpoint to the company events. Empty Events and
+// CompanyIDs select every event type and every company.
+type Webhook struct {
+	ID         uuid.UUID   `gorm:"type:uuid;primaryKey" json:"ID"`
+	URL        string      `gorm:"type:varchar(2000);not null" json:"URL"`
+	Secret     string      `gorm:"type:varchar(100);not null" json:"-"`
+	Events     []string    `gorm:"type:text;serializer:json" json:"Events"`
+	CompanyIDs []uuid.UUID `gorm:"type:text;serializer:json" json:"CompanyIDs"`
+	// LastEventID is the sequence number of the last outbox event turned into deliveries.
+	LastEventID uint64    `gorm:"not null;default:0" json:"-"`
+	CreatedAt   time.Time `gorm:"not null" json:"CreatedAt"`
+	UpdatedAt   time.Time `gorm:"not null" json:"UpdatedAt"`
+}
+
+func (webhook *Webhook) BeforeCreate(tx *gorm.DB) (err error) {
+	webhook.ID = uuid.New()
+	return
+}
+
+// WebhookDelivery is the delivery of an event to a webhook, and the log of its attempts.
+type WebhookDelivery struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"ID"`
+	WebhookID uuid.UUID `gorm:"type:uuid;not null;index" json:"WebhookID"`
+	EventID   uint64    `gorm:"not null" json:"EventID"`
+	EventType string    `gorm:"type:varchar(50);not null" json:"EventType"`
+	// Payload is the request body, the same on every attempt.
+	Payload        string     `gorm:"type:text;not null" json:"-"`
+	Status         string     `gorm:"type:varchar(20);not null" json:"Status"`
+	Attempts       int        `gorm:"not null;default:0" json:"Attempts"`
+	NextAttemptAt  *time.Time `json:"NextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time `json:"LastAttemptAt,omitempty"`
+	ResponseStatus int        `json:"ResponseStatus,omitempty"`
+	LastError      string     `gorm:"type:varchar(500)" json:"LastError,omitempty"`
+	CreatedAt      time.Time  `gorm:"not null" json:"CreatedAt"`
+	UpdatedAt      time.Time  `gorm:"not null" json:"UpdatedAt"`
+}
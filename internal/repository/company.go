@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("company not found")
+	ErrDuplicateName = errors.New("company name already exists")
+	ErrUnsupported   = errors.New("unsupported database driver")
+	// ErrVersionConflict is returned when the company changed since the expected version was read.
+	ErrVersionConflict = errors.New("company version conflict")
+)
+
+// CompanyRepository stores companies, the outbox events and the audit trail of their changes.
+type CompanyRepository interface {
+	// WithContext returns a repository running its queries with the context.
+	WithContext(ctx context.Context) CompanyRepository
+	// Transaction runs fn with a repository bound to a single transaction.
+	Transaction(fn func(repository CompanyRepository) error) error
+	// IncludeDeleted returns a repository whose reads also return soft deleted companies.
+	IncludeDeleted() CompanyRepository
+	Create(company *model.Company) error
+	Get(id uuid.UUID) (*model.Company, error)
+	GetByName(name string) (*model.Company, error)
+	// Update saves the company when its stored version is company.Version, and increments the version.
+	Update(company *model.Company) error
+	// Delete soft deletes the company when its stored version is version, or whatever its version when version is 0.
+	// The name of a soft deleted company stays taken until it is purged.
+	Delete(id uuid.UUID, version int) error
+	// Restore undoes the soft deletion of a company and increments its version.
+	Restore(id uuid.UUID) error
+	// Purge permanently removes up to limit companies soft deleted before deletedBefore, and returns them.
+	Purge(deletedBefore time.Time, limit int) ([]model.Company, error)
+	// List returns up to limit companies matching the filter, in the given order,
+	// that follow the after company when it is set.
+	List(filter CompanyFilter, sort []CompanySort, after *model.Company, limit int) ([]model.Company, error)
+	// Search returns the companies matching all the search terms, most relevant first.
+	// Soft deleted companies are never found.
+	Search(search CompanySearch) ([]CompanySearchHit, error)
+	RecordEvent(event *model.OutboxEvent) error
+	// ListEvents returns up to limit numbered outbox events following the afterSequence one, in
+	// sequence order, and of the companies when companyIDs is not empty.
+	ListEvents(afterSequence uint64, companyIDs []uuid.UUID, limit int) ([]model.OutboxEvent, error)
+	// LastEventSequence returns the number of the latest numbered outbox event, 0 when there are none.
+	LastEventSequence() (uint64, error)
+	RecordAudit(audit *model.CompanyAudit) error
+	// ListAudit returns up to limit audit records of a company, newest first,
+	// older than the beforeID record when it is not zero.
+	ListAudit(companyID uuid.UUID, beforeID uint64, limit int) ([]model.CompanyAudit, error)
+}
+
+// CompanyFilter restricts the companies returned by a listing.
+type CompanyFilter struct {
+	Types        []model.CompanyType
+	Registered   *bool
+	MinEmployees *int
+	MaxEmployees *int
+	NamePrefix   string
+}
+
+// Markers of the matched words in the snippets of a search.
+const (
+	SnippetStart = "<mark>"
+	SnippetEnd   = "</mark>"
+)
+
+// CompanySearch is a full-text search of the names and descriptions of the companies.
+type CompanySearch struct {
+	// Terms are lower case letters and digits, matched as word prefixes.
+	Terms      []string
+	Types      []model.CompanyType
+	Registered *bool
+	Offset     int
+	Limit      int
+}
+
+// CompanySearchHit is a company found by a search.
+type CompanySearchHit struct {
+	Company model.Company
+	// Rank is the relevance of the company, only comparable within a search.
+	Rank float64
+	// NameSnippet and DescriptionSnippet are the matching text, with the matched
+	// words between SnippetStart and SnippetEnd. The text is not escaped.
+	NameSnippet        string
+	DescriptionSnippet string
+}
+
+// CompanySort is a single sort criterion of a company listing.
+type CompanySort struct {
+	Field string
+	Desc  bool
+}
+
+// NewCompanyRepository returns the repository implementation matching the database driver.
+func NewCompanyRepository(db *gorm.DB) (CompanyRepository, error) {
+	switch db.Name() {
+	case "sqlite":
+		return NewSqliteCompanyRepository(db), nil
+	case "postgres":
+		return NewPostgresCompanyRepository(db), nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/migration"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSqliteCompanyRepository(t *testing.T) {
+	suite.Run(t, &CompanyRepositoryFixture{open: db.InitTestSqlite})
+}
+
+// TestPostgresCompanyRepository runs against the database in XM_TEST_POSTGRES_DSN, when set.
+func TestPostgresCompanyRepository(t *testing.T) {
+	dsn := os.Getenv("XM_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("XM_TEST_POSTGRES_DSN is not set")
+	}
+
+	suite.Run(t, &CompanyRepositoryFixture{open: func() (*gorm.DB, error) {
+		postgres, err := db.InitPostgres(&config.Config{DbDriver: db.DriverPostgres, DbDsn: dsn}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		migrator, err := migration.NewMigrator(postgres, zerolog.Nop())
+		if err != nil {
+			return nil, err
+		}
+		_, err = migrator.Up(0)
+
+		return postgres, err
+	}})
+}
+
+type CompanyRepositoryFixture struct {
+	suite.Suite
+
+	open       func() (*gorm.DB, error)
+	db         *gorm.DB
+	repository CompanyRepository
+}
+
+func (rf *CompanyRepositoryFixture) SetupTest() {
+	var err error
+	rf.db, err = rf.open()
+	rf.Require().NoError(err)
+	rf.NoError(rf.db.Unscoped().Where("1 = 1").Delete(&model.Company{}).Error)
+	rf.NoError(rf.db.Where("1 = 1").Delete(&model.OutboxEvent{}).Error)
+
+	rf.repository, err = NewCompanyRepository(rf.db)
+	rf.Require().NoError(err)
+}
+
+func (rf *CompanyRepositoryFixture) TestCreate_DuplicateName() {
+	rf.NoError(rf.repository.Create(rf.testCompany("TestCompany")))
+
+	err := rf.repository.Create(rf.testCompany("TestCompany"))
+	rf.ErrorIs(err, ErrDuplicateName)
+
+	// Names are unique case-sensitively on every driver.
+	rf.NoError(rf.repository.Create(rf.testCompany("testcompany")))
+}
+
+func (rf *CompanyRepositoryFixture) TestGet_NotFound() {
+	company, err := rf.repository.Get(uuid.New())
+	rf.ErrorIs(err, ErrNotFound)
+	rf.Nil(company)
+
+	rf.ErrorIs(rf.repository.Delete(uuid.New(), 0), ErrNotFound)
+}
+
+func (rf *CompanyRepositoryFixture) TestUpdate_VersionConflict() {
+	company := rf.testCompany("TestCompany")
+	rf.NoError(rf.repository.Create(company))
+	rf.Equal(1, company.Version)
+
+	stale := *company
+	company.Description = "first"
+	rf.NoError(rf.repository.Update(company))
+	rf.Equal(2, company.Version)
+
+	stale.Description = "second"
+	rf.ErrorIs(rf.repository.Update(&stale), ErrVersionConflict)
+	rf.Equal(1, stale.Version)
+
+	stored, err := rf.repository.Get(company.ID)
+	rf.NoError(err)
+	rf.Equal("first", stored.Description)
+	rf.Equal(2, stored.Version)
+
+	missing := rf.testCompany("Missing")
+	missing.ID = uuid.New()
+	rf.ErrorIs(rf.repository.Update(missing), ErrNotFound)
+
+	rf.ErrorIs(rf.repository.Delete(company.ID, 1), ErrVersionConflict)
+	rf.NoError(rf.repository.Delete(company.ID, 2))
+}
+
+func (rf *CompanyRepositoryFixture) TestUpdate_Columns() {
+	company := rf.testCompany("TestCompany")
+	rf.NoError(rf.repository.Create(company))
+	stored, err := rf.repository.Get(company.ID)
+	rf.NoError(err)
+
+	// Only the attributes of the company are written, not its timestamps of creation and deletion.
+	company.Description = "updated"
+	company.CreatedAt = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	company.DeletedAt = gorm.DeletedAt{Time: company.CreatedAt, Valid: true}
+	rf.NoError(rf.repository.Update(company))
+
+	updated, err := rf.repository.Get(company.ID)
+	rf.NoError(err)
+	rf.Equal("updated", updated.Description)
+	rf.True(stored.CreatedAt.Equal(updated.CreatedAt))
+	rf.False(updated.DeletedAt.Valid)
+	rf.False(updated.UpdatedAt.Before(stored.UpdatedAt))
+}
+
+func (rf *CompanyRepositoryFixture) TestSoftDelete() {
+	company := rf.testCompany("TestCompany")
+	rf.NoError(rf.repository.Create(company))
+	rf.NoError(rf.repository.Delete(company.ID, 0))
+
+	_, err := rf.repository.Get(company.ID)
+	rf.ErrorIs(err, ErrNotFound)
+	companies, err := rf.repository.List(CompanyFilter{}, nil, nil, 10)
+	rf.NoError(err)
+	rf.Empty(companies)
+
+	deleted, err := rf.repository.IncludeDeleted().Get(company.ID)
+	rf.NoError(err)
+	rf.True(deleted.DeletedAt.Valid)
+	companies, err = rf.repository.IncludeDeleted().List(CompanyFilter{}, nil, nil, 10)
+	rf.NoError(err)
+	rf.Len(companies, 1)
+
+	// The name stays taken until the company is purged.
+	rf.ErrorIs(rf.repository.Create(rf.testCompany("TestCompany")), ErrDuplicateName)
+	rf.ErrorIs(rf.repository.Delete(company.ID, 0), ErrNotFound)
+
+	rf.NoError(rf.repository.Restore(company.ID))
+	rf.ErrorIs(rf.repository.Restore(company.ID), ErrNotFound)
+	restored, err := rf.repository.Get(company.ID)
+	rf.NoError(err)
+	rf.False(restored.DeletedAt.Valid)
+	rf.Equal(2, restored.Version)
+}
+
+func (rf *CompanyRepositoryFixture) TestPurge() {
+	expired := rf.testCompany("Expired")
+	recent := rf.testCompany("Recent")
+	active := rf.testCompany("Active")
+	for _, company := range []*model.Company{expired, recent, active} {
+		rf.NoError(rf.repository.Create(company))
+	}
+	rf.NoError(rf.repository.Delete(expired.ID, 0))
+	rf.NoError(rf.db.Unscoped().Model(expired).Update("deleted_at", time.Now().Add(-48*time.Hour)).Error)
+	rf.NoError(rf.repository.Delete(recent.ID, 0))
+
+	purged, err := rf.repository.Purge(time.Now().Add(-24*time.Hour), 10)
+	rf.NoError(err)
+	rf.Len(purged, 1)
+	rf.Equal(expired.ID, purged[0].ID)
+
+	_, err = rf.repository.IncludeDeleted().Get(expired.ID)
+	rf.ErrorIs(err, ErrNotFound)
+	_, err = rf.repository.IncludeDeleted().Get(recent.ID)
+	rf.NoError(err)
+	_, err = rf.repository.Get(active.ID)
+	rf.NoError(err)
+
+	// The name of a purged company is free again.
+	rf.NoError(rf.repository.Create(rf.testCompany("Expired")))
+}
+
+func (rf *CompanyRepositoryFixture) TestTransaction_Rollback() {
+	company := rf.testCompany("TestCompany")
+	err := rf.repository.Transaction(func(repository CompanyRepository) error {
+		if err := repository.Create(company); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	rf.Error(err)
+
+	_, err = rf.repository.Get(company.ID)
+	rf.ErrorIs(err, ErrNotFound)
+}
+
+func (rf *CompanyRepositoryFixture) TestList() {
+	for _, name := range []string{"Acme", "acme labs", "Beta", "Acme_1"} {
+		rf.NoError(rf.repository.Create(rf.testCompany(name)))
+	}
+
+	sort := []CompanySort{{Field: "Name"}}
+	companies, err := rf.repository.List(CompanyFilter{NamePrefix: "acme"}, sort, nil, 10)
+	rf.NoError(err)
+	rf.Len(companies, 3)
+
+	companies, err = rf.repository.List(CompanyFilter{NamePrefix: "Acme_"}, sort, nil, 10)
+	rf.NoError(err)
+	rf.Len(companies, 1)
+	rf.Equal("Acme_1", companies[0].Name)
+
+	companies, err = rf.repository.List(CompanyFilter{}, []CompanySort{{Field: "Name", Desc: true}}, nil, 2)
+	rf.NoError(err)
+	rf.Len(companies, 2)
+
+	next, err := rf.repository.List(CompanyFilter{}, []CompanySort{{Field: "Name", Desc: true}}, &companies[1], 10)
+	rf.NoError(err)
+	rf.Len(next, 2)
+}
+
+func (rf *CompanyRepositoryFixture) TestSearch() {
+	companies := []*model.Company{
+		rf.testCompany("Solar Panels Ltd"),
+		rf.testCompany("Green Energy"),
+		rf.testCompany("Wind Farms"),
+		rf.testCompany("Deleted Solar"),
+	}
+	companies[0].Description = "Installs rooftop solar panels."
+	companies[1].Description = "Sells solar and wind energy to households, mostly solar."
+	companies[1].Registered = false
+	companies[2].Description = "Offshore wind farms with the solarium nobody asked for."
+	companies[2].Type = model.CompanyTypeCooperative
+	for _, company := range companies {
+		rf.NoError(rf.repository.Create(company))
+	}
+	rf.NoError(rf.repository.Delete(companies[3].ID, 0))
+
+	hits, err := rf.repository.Search(CompanySearch{Terms: []string{"solar"}, Limit: 10})
+	rf.NoError(err)
+	rf.Len(hits, 3)
+	// A match in the name ranks first.
+	rf.Equal("Solar Panels Ltd", hits[0].Company.Name)
+	rf.Greater(hits[0].Rank, hits[1].Rank)
+	rf.Equal(SnippetStart+"Solar"+SnippetEnd+" Panels Ltd", hits[0].NameSnippet)
+	rf.Contains(hits[0].DescriptionSnippet, "rooftop "+SnippetStart+"solar"+SnippetEnd+" panels")
+
+	// Terms are prefixes and must all match.
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"sol", "wi"}, Limit: 10})
+	rf.NoError(err)
+	rf.Len(hits, 2)
+
+	registered := false
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"sol"}, Registered: &registered, Limit: 10})
+	rf.NoError(err)
+	rf.Len(hits, 1)
+	rf.Equal("Green Energy", hits[0].Company.Name)
+
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"sol"}, Types: []model.CompanyType{model.CompanyTypeCooperative}, Limit: 10})
+	rf.NoError(err)
+	rf.Len(hits, 1)
+	rf.Equal("Wind Farms", hits[0].Company.Name)
+
+	first, err := rf.repository.Search(CompanySearch{Terms: []string{"sol"}, Limit: 2})
+	rf.NoError(err)
+	rf.Len(first, 2)
+	next, err := rf.repository.Search(CompanySearch{Terms: []string{"sol"}, Offset: 2, Limit: 2})
+	rf.NoError(err)
+	rf.Len(next, 1)
+	rf.NotContains([]uuid.UUID{first[0].Company.ID, first[1].Company.ID}, next[0].Company.ID)
+
+	// The index follows the changes of the companies.
+	companies[2].Description = "Offshore wind farms."
+	rf.NoError(rf.repository.Update(companies[2]))
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"sol"}, Limit: 10})
+	rf.NoError(err)
+	rf.Len(hits, 2)
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"offshore"}, Limit: 10})
+	rf.NoError(err)
+	rf.Len(hits, 1)
+
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"nothing"}, Limit: 10})
+	rf.NoError(err)
+	rf.Empty(hits)
+}
+
+func (rf *CompanyRepositoryFixture) TestSearch_Vacuum() {
+	companies := []*model.Company{rf.testCompany("Alpha"), rf.testCompany("Beta"), rf.testCompany("Gamma")}
+	for _, company := range companies {
+		rf.NoError(rf.repository.Create(company))
+	}
+	// VACUUM may renumber the rows of companies once one is gone, the index must not depend on it.
+	rf.NoError(rf.db.Exec("DELETE FROM companies WHERE id = ?", companies[0].ID).Error)
+	rf.NoError(rf.db.Exec("VACUUM").Error)
+
+	companies[2].Name = "Delta"
+	rf.NoError(rf.repository.Update(companies[2]))
+	hits, err := rf.repository.Search(CompanySearch{Terms: []string{"delta"}, Limit: 10})
+	rf.NoError(err)
+	rf.Require().Len(hits, 1)
+	rf.Equal(companies[2].ID, hits[0].Company.ID)
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"beta"}, Limit: 10})
+	rf.NoError(err)
+	rf.Require().Len(hits, 1)
+	rf.Equal(companies[1].ID, hits[0].Company.ID)
+	hits, err = rf.repository.Search(CompanySearch{Terms: []string{"gamma"}, Limit: 10})
+	rf.NoError(err)
+	rf.Empty(hits)
+}
+
+func (rf *CompanyRepositoryFixture) testCompany(name string) *model.Company {
+	return &model.Company{
+		Name:              name,
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              model.CompanyTypeCorporation,
+	}
+}
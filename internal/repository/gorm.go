@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type companySortColumn struct {
+	column string
+	value  func(company *model.Company) any
+}
+
+// companySortColumns maps the public sort fields to their columns.
+var companySortColumns = map[string]companySortColumn{
+	"Name":              {column: "name", value: func(c *model.Company) any { return c.Name }},
+	"Type":              {column: "type", value: func(c *model.Company) any { return c.Type }},
+	"AmountOfEmployees": {column: "amount_of_employees", value: func(c *model.Company) any { return c.AmountOfEmployees }},
+	"Registered":        {column: "registered", value: func(c *model.Company) any { return c.Registered }},
+	"CreatedAt":         {column: "created_at", value: func(c *model.Company) any { return c.CreatedAt }},
+}
+
+// IsCompanySortField reports whether companies can be sorted by the field.
+func IsCompanySortField(field string) bool {
+	_, ok := companySortColumns[field]
+	return ok
+}
+
+// gormCompanyRepository holds the storage logic shared by the GORM backed drivers.
+// The drivers only differ in the SQL used for prefix matching and in full-text search.
+type gormCompanyRepository struct {
+	db             *gorm.DB
+	prefixOperator string
+	search         func(db *gorm.DB, search CompanySearch) ([]CompanySearchHit, error)
+}
+
+// with returns a copy of the repository using db.
+func (r *gormCompanyRepository) with(db *gorm.DB) *gormCompanyRepository {
+	clone := *r
+	clone.db = db
+
+	return &clone
+}
+
+func (r *gormCompanyRepository) WithContext(ctx context.Context) CompanyRepository {
+	return r.with(r.db.WithContext(ctx))
+}
+
+func (r *gormCompanyRepository) Transaction(fn func(repository CompanyRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(r.with(tx))
+	})
+}
+
+func (r *gormCompanyRepository) IncludeDeleted() CompanyRepository {
+	return r.with(r.db.Unscoped().Session(&gorm.Session{}))
+}
+
+func (r *gormCompanyRepository) Create(company *model.Company) error {
+	return translateError(r.db.Create(company).Error)
+}
+
+func (r *gormCompanyRepository) Get(id uuid.UUID) (*model.Company, error) {
+	var company model.Company
+	err := r.db.Where("id = ?", id).First(&company).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &company, nil
+}
+
+func (r *gormCompanyRepository) GetByName(name string) (*model.Company, error) {
+	var company model.Company
+	err := r.db.Where("name = ?", name).First(&company).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &company, nil
+}
+
+func (r *gormCompanyRepository) Update(company *model.Company) error {
+	expected := company.Version
+	company.Version = expected + 1
+
+	result := r.db.Model(company).Where("version = ?", expected).Select("Name", "Description", "AmountOfEmployees", "Registered", "Type", "Version", "UpdatedAt").Updates(company)
+	if result.Error != nil {
+		company.Version = expected
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		company.Version = expected
+		return r.missingOrConflict(company.ID)
+	}
+
+	return nil
+}
+
+func (r *gormCompanyRepository) Delete(id uuid.UUID, version int) error {
+	tx := r.db.Where("id = ?", id)
+	if version > 0 {
+		tx = tx.Where("version = ?", version)
+	}
+
+	result := tx.Delete(&model.Company{})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return r.missingOrConflict(id)
+	}
+
+	return nil
+}
+
+func (r *gormCompanyRepository) Restore(id uuid.UUID) error {
+	result := r.db.Unscoped().Model(&model.Company{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]any{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *gormCompanyRepository) Purge(deletedBefore time.Time, limit int) ([]model.Company, error) {
+	var companies []model.Company
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&companies).Error
+	if err != nil || len(companies) == 0 {
+		return nil, translateError(err)
+	}
+
+	ids := make([]uuid.UUID, 0, len(companies))
+	for _, company := range companies {
+		ids = append(ids, company.ID)
+	}
+	if err := r.db.Unscoped().Where("id IN ?", ids).Delete(&model.Company{}).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return companies, nil
+}
+
+// missingOrConflict tells apart why a conditional write matched no row.
+func (r *gormCompanyRepository) missingOrConflict(id uuid.UUID) error {
+	var count int64
+	if err := r.db.Model(&model.Company{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return translateError(err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return ErrVersionConflict
+}
+
+func (r *gormCompanyRepository) List(filter CompanyFilter, sort []CompanySort, after *model.Company, limit int) ([]model.Company, error) {
+	for _, criterion := range sort {
+		if !IsCompanySortField(criterion.Field) {
+			return nil, fmt.Errorf("unknown sort field %q", criterion.Field)
+		}
+	}
+
+	tx := r.db.Model(&model.Company{})
+	if len(filter.Types) > 0 {
+		tx = tx.Where("type IN ?", filter.Types)
+	}
+	if filter.Registered != nil {
+		tx = tx.Where("registered = ?", *filter.Registered)
+	}
+	if filter.MinEmployees != nil {
+		tx = tx.Where("amount_of_employees >= ?", *filter.MinEmployees)
+	}
+	if filter.MaxEmployees != nil {
+		tx = tx.Where("amount_of_employees <= ?", *filter.MaxEmployees)
+	}
+	if filter.NamePrefix != "" {
+		tx = tx.Where("name "+r.prefixOperator+" ? ESCAPE '\\'", escapeLike(filter.NamePrefix)+"%")
+	}
+
+	if after != nil {
+		where, args := companyKeyset(sort, after)
+		tx = tx.Where(where, args...)
+	}
+
+	for _, criterion := range sort {
+		direction := "ASC"
+		if criterion.Desc {
+			direction = "DESC"
+		}
+		tx = tx.Order(companySortColumns[criterion.Field].column + " " + direction)
+	}
+	tx = tx.Order("id ASC")
+
+	var companies []model.Company
+	if err := tx.Limit(limit).Find(&companies).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return companies, nil
+}
+
+func (r *gormCompanyRepository) Search(search CompanySearch) ([]CompanySearchHit, error) {
+	if len(search.Terms) == 0 {
+		return nil, nil
+	}
+
+	hits, err := r.search(r.db, search)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return hits, nil
+}
+
+// searchFilter restricts a search to the companies that are not deleted and match the filters.
+func searchFilter(search CompanySearch) (string, []any) {
+	conditions := []string{"companies.deleted_at IS NULL"}
+	var args []any
+	if len(search.Types) > 0 {
+		conditions = append(conditions, "companies.type IN ?")
+		args = append(args, search.Types)
+	}
+	if search.Registered != nil {
+		conditions = append(conditions, "companies.registered = ?")
+		args = append(args, *search.Registered)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// companySearchRow is a company read by a search query, with its rank and snippets.
+type companySearchRow struct {
+	model.Company
+	Rank               float64
+	NameSnippet        string
+	DescriptionSnippet string
+}
+
+func (row companySearchRow) hit() CompanySearchHit {
+	return CompanySearchHit{
+		Company:            row.Company,
+		Rank:               row.Rank,
+		NameSnippet:        row.NameSnippet,
+		DescriptionSnippet: row.DescriptionSnippet,
+	}
+}
+
+func (r *gormCompanyRepository) RecordEvent(event *model.OutboxEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *gormCompanyRepository) ListEvents(afterSequence uint64, companyIDs []uuid.UUID, limit int) ([]model.OutboxEvent, error) {
+	tx := r.db.Where("sequence > ?", afterSequence)
+	if len(companyIDs) > 0 {
+		tx = tx.Where("aggregate_id IN ?", companyIDs)
+	}
+
+	var events []model.OutboxEvent
+	err := tx.Order("sequence ASC").Limit(limit).Find(&events).Error
+
+	return events, err
+}
+
+func (r *gormCompanyRepository) LastEventSequence() (uint64, error) {
+	var sequence uint64
+	err := r.db.Model(&model.OutboxEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+
+	return sequence, err
+}
+
+func (r *gormCompanyRepository) RecordAudit(audit *model.CompanyAudit) error {
+	return r.db.Create(audit).Error
+}
+
+func (r *gormCompanyRepository) ListAudit(companyID uuid.UUID, beforeID uint64, limit int) ([]model.CompanyAudit, error) {
+	tx := r.db.Where("company_id = ?", companyID)
+	if beforeID > 0 {
+		tx = tx.Where("id < ?", beforeID)
+	}
+
+	var audits []model.CompanyAudit
+	err := tx.Order("id DESC").Limit(limit).Find(&audits).Error
+
+	return audits, err
+}
+
+// companyKeyset builds the condition selecting the rows that follow the last
+// company in the requested order, using the ID as the final tie-breaker.
+func companyKeyset(sort []CompanySort, last *model.Company) (string, []any) {
+	var alternatives []string
+	var args []any
+	var equal []string
+	var equalArgs []any
+	for _, criterion := range sort {
+		column := companySortColumns[criterion.Field]
+		operator := ">"
+		if criterion.Desc {
+			operator = "<"
+		}
+
+		condition := append(append([]string{}, equal...), fmt.Sprintf("%s %s ?", column.column, operator))
+		alternatives = append(alternatives, "("+strings.Join(condition, " AND ")+")")
+		args = append(append(args, equalArgs...), column.value(last))
+
+		equal = append(equal, column.column+" = ?")
+		equalArgs = append(equalArgs, column.value(last))
+	}
+
+	condition := append(equal, "id > ?")
+	alternatives = append(alternatives, "("+strings.Join(condition, " AND ")+")")
+	args = append(append(args, equalArgs...), last.ID)
+
+	return strings.Join(alternatives, " OR "), args
+}
+
+// translateError maps driver errors to the repository errors.
+// It relies on gorm.Config.TranslateError being enabled.
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %w", ErrDuplicateName, err)
+	default:
+		return err
+	}
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
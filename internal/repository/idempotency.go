@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyNotFound  = errors.New("idempotency key not found")
+	ErrDuplicateIdempotencyKey = errors.New("idempotency key already exists")
+)
+
+// IdempotencyRepository stores the idempotency keys of the API requests.
+type IdempotencyRepository interface {
+	WithContext(ctx context.Context) IdempotencyRepository
+	// Create reserves a key; it fails with ErrDuplicateIdempotencyKey when the key exists.
+	Create(key *model.IdempotencyKey) error
+	Get(scope string, key string) (*model.IdempotencyKey, error)
+	// Complete stores the response of a reserved key.
+	Complete(key *model.IdempotencyKey) error
+	Delete(scope string, key string) error
+	// DeleteExpired removes the keys that expired before the time and returns how many were removed.
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type gormIdempotencyRepository struct {
+	db *gorm.DB
+}
+
+// NewIdempotencyRepository returns an idempotency key repository; the queries are portable across the supported drivers.
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &gormIdempotencyRepository{db: db}
+}
+
+func (r *gormIdempotencyRepository) WithContext(ctx context.Context) IdempotencyRepository {
+	return &gormIdempotencyRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *gormIdempotencyRepository) Create(key *model.IdempotencyKey) error {
+	err := r.db.Create(key).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %w", ErrDuplicateIdempotencyKey, err)
+	}
+
+	return err
+}
+
+func (r *gormIdempotencyRepository) Get(scope string, key string) (*model.IdempotencyKey, error) {
+	var idempotencyKey model.IdempotencyKey
+	err := r.db.Where("scope = ? AND key = ?", scope, key).First(&idempotencyKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &idempotencyKey, nil
+}
+
+func (r *gormIdempotencyRepository) Complete(key *model.IdempotencyKey) error {
+	result := r.db.Model(key).Select("Status", "Headers", "Body").Updates(key)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *gormIdempotencyRepository) Delete(scope string, key string) error {
+	return r.db.Where("scope = ? AND key = ?", scope, key).Delete(&model.IdempotencyKey{}).Error
+}
+
+func (r *gormIdempotencyRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", before).Delete(&model.IdempotencyKey{})
+
+	return result.RowsAffected, result.Error
+}
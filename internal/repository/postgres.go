@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"strings"
+)
+
+// NewPostgresCompanyRepository returns a repository for PostgreSQL.
+// ILIKE keeps name prefix matching case-insensitive, as it is on SQLite.
+func NewPostgresCompanyRepository(db *gorm.DB) CompanyRepository {
+	return &gormCompanyRepository{db: db, prefixOperator: "ILIKE", search: searchPostgres}
+}
+
+// searchPostgres searches the tsvector column of companies, ranked with ts_rank.
+func searchPostgres(db *gorm.DB, search CompanySearch) ([]CompanySearchHit, error) {
+	terms := make([]string, 0, len(search.Terms))
+	for _, term := range search.Terms {
+		terms = append(terms, term+":*")
+	}
+	filter, args := searchFilter(search)
+	nameOptions := "StartSel=" + SnippetStart + ", StopSel=" + SnippetEnd + ", HighlightAll=true"
+	descriptionOptions := "StartSel=" + SnippetStart + ", StopSel=" + SnippetEnd + `, MaxWords=32, MinWords=8, MaxFragments=2, FragmentDelimiter="…"`
+
+	var rows []companySearchRow
+	err := db.Raw("SELECT companies.*, ts_rank(companies.search, query) AS rank, "+
+		"ts_headline('simple', companies.name, query, ?) AS name_snippet, "+
+		"ts_headline('simple', coalesce(companies.description, ''), query, ?) AS description_snippet "+
+		"FROM companies, to_tsquery('simple', ?) AS query "+
+		"WHERE companies.search @@ query AND "+filter+" "+
+		"ORDER BY rank DESC, companies.id ASC LIMIT ? OFFSET ?",
+		append(append([]any{nameOptions, descriptionOptions, strings.Join(terms, " & ")}, args...), search.Limit, search.Offset)...).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]CompanySearchHit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, row.hit())
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"strings"
+)
+
+// sqliteSearchWeights are the BM25 weights of the name and description columns of companies_fts,
+// in the ratio of the A and B weights of the Postgres ranking.
+var sqliteSearchWeights = []float64{2.5, 1}
+
+// NewSqliteCompanyRepository returns a repository for SQLite.
+// SQLite's LIKE is case-insensitive for ASCII, which is the prefix matching behaviour of the API.
+func NewSqliteCompanyRepository(db *gorm.DB) CompanyRepository {
+	return &gormCompanyRepository{db: db, prefixOperator: "LIKE", search: searchSqlite}
+}
+
+// searchSqlite searches the FTS5 index, ranked with its bm25 function, negated so that the better
+// matches rank higher as with Postgres. The page is ranked before the snippets of its rows are made.
+func searchSqlite(db *gorm.DB, search CompanySearch) ([]CompanySearchHit, error) {
+	terms := make([]string, 0, len(search.Terms))
+	for _, term := range search.Terms {
+		terms = append(terms, term+"*")
+	}
+	match := strings.Join(terms, " ")
+	filter, filterArgs := searchFilter(search)
+
+	args := []any{SnippetStart, SnippetEnd, SnippetStart, SnippetEnd, sqliteSearchWeights[0], sqliteSearchWeights[1], match}
+	args = append(append(args, filterArgs...), search.Limit, search.Offset, match)
+	var rows []companySearchRow
+	err := db.Raw("SELECT companies.*, ranked.rank, "+
+		"highlight(companies_fts, 0, ?, ?) AS name_snippet, "+
+		"snippet(companies_fts, 1, ?, ?, '…', 32) AS description_snippet "+
+		"FROM ("+
+		"SELECT companies_fts.rowid AS key, companies.id, -bm25(companies_fts, ?, ?) AS rank "+
+		"FROM companies_fts "+
+		"JOIN companies_fts_keys ON companies_fts_keys.key = companies_fts.rowid "+
+		"JOIN companies ON companies.id = companies_fts_keys.company_id "+
+		"WHERE companies_fts MATCH ? AND "+filter+" "+
+		"ORDER BY rank DESC, companies.id ASC LIMIT ? OFFSET ?"+
+		") AS ranked "+
+		"JOIN companies ON companies.id = ranked.id "+
+		"JOIN companies_fts ON companies_fts.rowid = ranked.key "+
+		"WHERE companies_fts MATCH ? "+
+		"ORDER BY ranked.rank DESC, companies.id ASC", args...).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]CompanySearchHit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, row.hit())
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrDuplicateUser = errors.New("username already exists")
+)
+
+// UserRepository stores the API accounts.
+type UserRepository interface {
+	Create(user *model.User) error
+	GetByUsername(username string) (*model.User, error)
+	UpdatePasswordHash(username string, passwordHash string) error
+	UpdateRole(username string, role model.Role) error
+	Delete(username string) error
+	List() ([]model.User, error)
+	Count() (int64, error)
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository returns a user repository; the queries are portable across the supported drivers.
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) Create(user *model.User) error {
+	err := r.db.Create(user).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %w", ErrDuplicateUser, err)
+	}
+
+	return err
+}
+
+func (r *gormUserRepository) GetByUsername(username string) (*model.User, error) {
+	var user model.User
+	err := r.db.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *gormUserRepository) UpdatePasswordHash(username string, passwordHash string) error {
+	result := r.db.Model(&model.User{}).Where("username = ?", username).Update("password_hash", passwordHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *gormUserRepository) UpdateRole(username string, role model.Role) error {
+	result := r.db.Model(&model.User{}).Where("username = ?", username).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *gormUserRepository) Delete(username string) error {
+	result := r.db.Where("username = ?", username).Delete(&model.User{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *gormUserRepository) List() ([]model.User, error) {
+	var users []model.User
+	err := r.db.Order("username ASC").Find(&users).Error
+
+	return users, err
+}
+
+func (r *gormUserRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).Count(&count).Error
+
+	return count, err
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// WebhookRepository stores the webhook subscriptions and their deliveries.
+type WebhookRepository interface {
+	WithContext(ctx context.Context) WebhookRepository
+	Create(webhook *model.Webhook) error
+	Get(id uuid.UUID) (*model.Webhook, error)
+	List() ([]model.Webhook, error)
+	// Delete removes the webhook with its deliveries.
+	Delete(id uuid.UUID) error
+	// Enqueue adds the deliveries of the events up to lastEventID and moves the webhook past them.
+	Enqueue(webhookID uuid.UUID, lastEventID uint64, deliveries []model.WebhookDelivery) error
+	// ListDeliveries returns the deliveries of a webhook, newest first, optionally with a status
+	// and before a delivery ID when beforeID is not 0.
+	ListDeliveries(webhookID uuid.UUID, status string, beforeID uint64, limit int) ([]model.WebhookDelivery, error)
+	GetDelivery(webhookID uuid.UUID, id uint64) (*model.WebhookDelivery, error)
+	// DueDeliveries returns the pending deliveries whose next attempt is due at the time, oldest first.
+	DueDeliveries(at time.Time, limit int) ([]model.WebhookDelivery, error)
+	// ClaimDelivery moves the next attempt of a delivery still due at the time to until, so that the
+	// other dispatchers leave it alone meanwhile, and reports whether the delivery was claimed.
+	ClaimDelivery(id uint64, at time.Time, until time.Time) (bool, error)
+	// UpdateDelivery saves the state of a delivery after an attempt or a redelivery.
+	UpdateDelivery(delivery *model.WebhookDelivery) error
+}
+
+type gormWebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository returns a webhook repository; the queries are portable across the supported drivers.
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &gormWebhookRepository{db: db}
+}
+
+func (r *gormWebhookRepository) WithContext(ctx context.Context) WebhookRepository {
+	return &gormWebhookRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *gormWebhookRepository) Create(webhook *model.Webhook) error {
+	return r.db.Create(webhook).Error
+}
+
+func (r *gormWebhookRepository) Get(id uuid.UUID) (*model.Webhook, error) {
+	var webhook model.Webhook
+	err := r.db.Where("id = ?", id).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (r *gormWebhookRepository) List() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	err := r.db.Order("created_at ASC, id ASC").Find(&webhooks).Error
+
+	return webhooks, err
+}
+
+func (r *gormWebhookRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&model.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+
+		return tx.Where("webhook_id = ?", id).Delete(&model.WebhookDelivery{}).Error
+	})
+}
+
+func (r *gormWebhookRepository) Enqueue(webhookID uuid.UUID, lastEventID uint64, deliveries []model.WebhookDelivery) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Webhook{}).
+			Where("id = ? AND last_event_id < ?", webhookID, lastEventID).
+			Update("last_event_id", lastEventID)
+		if result.Error != nil {
+			return result.Error
+		}
+		// The webhook was removed, or another dispatcher already enqueued the events.
+		if result.RowsAffected == 0 || len(deliveries) == 0 {
+			return nil
+		}
+
+		return tx.Create(&deliveries).Error
+	})
+}
+
+func (r *gormWebhookRepository) ListDeliveries(webhookID uuid.UUID, status string, beforeID uint64, limit int) ([]model.WebhookDelivery, error) {
+	query := r.db.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var deliveries []model.WebhookDelivery
+	err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+func (r *gormWebhookRepository) GetDelivery(webhookID uuid.UUID, id uint64) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := r.db.Where("webhook_id = ? AND id = ?", webhookID, id).First(&delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (r *gormWebhookRepository) DueDeliveries(at time.Time, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.db.Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, at).
+		Order("id ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+func (r *gormWebhookRepository) ClaimDelivery(id uint64, at time.Time, until time.Time) (bool, error) {
+	result := r.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, model.WebhookDeliveryPending, at).
+		Update("next_attempt_at", until)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormWebhookRepository) UpdateDelivery(delivery *model.WebhookDelivery) error {
+	result := r.db.Model(delivery).
+		Select("Status", "Attempts", "NextAttemptAt", "LastAttemptAt", "ResponseStatus", "LastError", "UpdatedAt").
+		Updates(delivery)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/tracing"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultHistoryLimit = 20
+	MaxHistoryLimit     = 100
+)
+
+// CompanyHistory is a page of audit records and the cursor of the next page, if any.
+type CompanyHistory struct {
+	Items      []model.CompanyAudit
+	NextCursor string
+}
+
+// History returns the audit records of a company, newest first.
+func (s *Company) History(ctx context.Context, id uuid.UUID, limit int, cursor string) (*CompanyHistory, error) {
+	tracing.SetCompanyID(ctx, id)
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	var beforeID uint64
+	if cursor != "" {
+		var err error
+		beforeID, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil || beforeID == 0 {
+			return nil, fmt.Errorf("%w: history: %w: malformed cursor", ErrCompanyService, ErrInvalidListQuery)
+		}
+	}
+
+	audits, err := s.repository.WithContext(ctx).ListAudit(id, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: history: %w", ErrCompanyService, err)
+	}
+
+	result := &CompanyHistory{Items: audits}
+	if len(audits) > limit {
+		result.Items = audits[:limit]
+		result.NextCursor = strconv.FormatUint(result.Items[limit-1].ID, 10)
+	}
+
+	return result, nil
+}
+
+// recordAudit appends the audit record of a change, inside the transaction of the change.
+// Before is nil on create and after is nil on delete.
+func recordAudit(ctx context.Context, repo repository.CompanyRepository, action string, before *model.Company, after *model.Company) error {
+	audit := &model.CompanyAudit{
+		Action:    action,
+		RequestID: RequestIDFromContext(ctx),
+		Changes:   companyChanges(before, after),
+	}
+	if after != nil {
+		audit.CompanyID = after.ID
+	} else {
+		audit.CompanyID = before.ID
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		audit.ActorID = actor.ID
+		audit.ActorUsername = actor.Username
+	}
+
+	return repo.RecordAudit(audit)
+}
+
+// companyChanges compares the serialized fields of two versions of a company,
+// keyed by their JSON names. The ID, the fields hidden from JSON and the fields
+// tagged audit:"-" are ignored.
+func companyChanges(before *model.Company, after *model.Company) map[string]model.FieldChange {
+	changes := map[string]model.FieldChange{}
+	companyType := reflect.TypeOf(model.Company{})
+	for i := range companyType.NumField() {
+		field := companyType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || name == "ID" || field.Tag.Get("audit") == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var change model.FieldChange
+		if before != nil {
+			change.Before = reflect.ValueOf(before).Elem().Field(i).Interface()
+		}
+		if after != nil {
+			change.After = reflect.ValueOf(after).Elem().Field(i).Interface()
+		}
+		if before != nil && after != nil && reflect.DeepEqual(change.Before, change.After) {
+			continue
+		}
+
+		changes[name] = change
+	}
+
+	return changes
+}
@@ -1,71 +1,206 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/dto"
 	"github.com/vcsfrl/xm/internal/model"
-	"gorm.io/gorm"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/tracing"
 )
 
 var ErrCompanyService = errors.New("company service error")
 
+// ErrVersionConflict is returned when a company changed since the version the caller read.
+var ErrVersionConflict = repository.ErrVersionConflict
+
+// ErrDuplicateName is returned when another company, possibly soft deleted, has the same name.
+var ErrDuplicateName = repository.ErrDuplicateName
+
 type Company struct {
-	db        *gorm.DB
-	validator *validator.Validate
+	repository repository.CompanyRepository
+	validator  *validator.Validate
 }
 
-func NewCompanyService(db *gorm.DB, validator *validator.Validate) *Company {
-	return &Company{db: db, validator: validator}
+func NewCompanyService(repository repository.CompanyRepository, validator *validator.Validate) *Company {
+	return &Company{repository: repository, validator: validator}
 }
 
-func (s *Company) Create(company *model.Company) error {
+func (s *Company) Create(ctx context.Context, company *model.Company) error {
 
 	// Validate the company struct
 	err := s.validator.Struct(company)
 	if err != nil {
-		return fmt.Errorf("%w: validation: %w", ErrCompanyService, err)
+		return fmt.Errorf("%w: validation: %w", ErrCompanyService, newValidationError(err))
 	}
 
-	err = s.db.Create(company).Error
+	err = s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+		return create(ctx, repo, company)
+	})
 	if err != nil {
-		return fmt.Errorf("%w: create: %w", ErrCompanyService, err)
+		return fmt.Errorf("%w: create: %w", ErrCompanyService, classify(err))
 	}
+	tracing.SetCompanyID(ctx, company.ID)
 
 	return nil
 }
 
-func (s *Company) Get(id uuid.UUID) (*model.Company, error) {
-	var company model.Company
-	err := s.db.Where("id = ?", id).First(&company).Error
+func (s *Company) Get(ctx context.Context, id uuid.UUID) (*model.Company, error) {
+	tracing.SetCompanyID(ctx, id)
+	company, err := s.repository.WithContext(ctx).Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: get: %w", ErrCompanyService, classify(err))
+	}
+
+	return company, nil
+}
+
+// GetIncludingDeleted returns the company even when it is soft deleted.
+func (s *Company) GetIncludingDeleted(ctx context.Context, id uuid.UUID) (*model.Company, error) {
+	tracing.SetCompanyID(ctx, id)
+	company, err := s.repository.WithContext(ctx).IncludeDeleted().Get(id)
 	if err != nil {
-		return nil, fmt.Errorf("%w: get: %w", ErrCompanyService, err)
+		return nil, fmt.Errorf("%w: get: %w", ErrCompanyService, classify(err))
 	}
 
-	return &company, nil
+	return company, nil
 }
 
-func (s *Company) Update(company *model.Company) error {
+// Update saves the company, provided its version is still company.Version.
+func (s *Company) Update(ctx context.Context, company *model.Company) error {
+	tracing.SetCompanyID(ctx, company.ID)
 	// Validate the company struct
 	err := s.validator.Struct(company)
 	if err != nil {
-		return fmt.Errorf("%w: validation: %s", ErrCompanyService, err.Error())
+		return fmt.Errorf("%w: validation: %w", ErrCompanyService, newValidationError(err))
 	}
 
-	err = s.db.Save(company).Error
+	err = s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+		return update(ctx, repo, company)
+	})
 	if err != nil {
-		return fmt.Errorf("%w: update: %w", ErrCompanyService, err)
+		return fmt.Errorf("%w: update: %w", ErrCompanyService, classify(err))
 	}
 
 	return nil
 }
 
-func (s *Company) Delete(id uuid.UUID) error {
-	err := s.db.Where("id = ?", id).Delete(&model.Company{}).Error
+// Delete soft deletes the company, provided its version is still version when version is not 0.
+func (s *Company) Delete(ctx context.Context, id uuid.UUID, version int) error {
+	tracing.SetCompanyID(ctx, id)
+	err := s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+		return remove(ctx, repo, id, version)
+	})
 	if err != nil {
-		return fmt.Errorf("%w: delete: %w", ErrCompanyService, err)
+		return fmt.Errorf("%w: delete: %w", ErrCompanyService, classify(err))
 	}
 
 	return nil
 }
+
+// Restore undoes the soft deletion of a company and returns it.
+// Restoring a company that is not deleted leaves it unchanged.
+func (s *Company) Restore(ctx context.Context, id uuid.UUID) (*model.Company, error) {
+	tracing.SetCompanyID(ctx, id)
+	var company *model.Company
+	err := s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+		before, err := repo.IncludeDeleted().Get(id)
+		if err != nil {
+			return err
+		}
+		if !before.DeletedAt.Valid {
+			company = before
+			return nil
+		}
+
+		if err := repo.Restore(id); err != nil {
+			return err
+		}
+		company, err = repo.Get(id)
+		if err != nil {
+			return err
+		}
+
+		if err := recordAudit(ctx, repo, model.AuditActionRestore, before, company); err != nil {
+			return err
+		}
+
+		return recordEvent(repo, model.EventCompanyRestored, company)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: restore: %w", ErrCompanyService, classify(err))
+	}
+
+	return company, nil
+}
+
+// create stores a new company with its audit record and change event, inside a transaction.
+func create(ctx context.Context, repo repository.CompanyRepository, company *model.Company) error {
+	if err := repo.Create(company); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, repo, model.AuditActionCreate, nil, company); err != nil {
+		return err
+	}
+
+	return recordEvent(repo, model.EventCompanyCreated, company)
+}
+
+// update saves a company with its audit record and change event, inside a transaction.
+func update(ctx context.Context, repo repository.CompanyRepository, company *model.Company) error {
+	before, err := repo.Get(company.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Update(company); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, repo, model.AuditActionUpdate, before, company); err != nil {
+		return err
+	}
+
+	return recordEvent(repo, model.EventCompanyUpdated, company)
+}
+
+// remove soft deletes a company with its audit record and change event, inside a transaction.
+// Removing a missing company does nothing.
+func remove(ctx context.Context, repo repository.CompanyRepository, id uuid.UUID, version int) error {
+	company, err := repo.Get(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Delete(id, version); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, repo, model.AuditActionDelete, company, nil); err != nil {
+		return err
+	}
+
+	return recordEvent(repo, model.EventCompanyDeleted, company)
+}
+
+// recordEvent writes a change event to the outbox, inside the transaction of the change.
+func recordEvent(repo repository.CompanyRepository, eventType string, company *model.Company) error {
+	payload, err := json.Marshal(dto.NewCompany(company))
+	if err != nil {
+		return err
+	}
+
+	return repo.RecordEvent(&model.OutboxEvent{
+		Type:        eventType,
+		AggregateID: company.ID,
+		Payload:     string(payload),
+	})
+}
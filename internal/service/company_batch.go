@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+)
+
+const MaxCompanyBatchSize = 1000
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+	// ErrBatchAborted is the error of the operations of an atomic batch that were not
+	// applied because another operation of the batch failed.
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+// CompanyBatchOperation is a single change of a batch.
+type CompanyBatchOperation struct {
+	Op string
+	// Company is the company to create.
+	Company *model.Company
+	// ID is the company to update or delete.
+	ID uuid.UUID
+	// Version is the expected version of the company to update or delete, or 0 for any.
+	Version int
+	// Patch changes the stored company of an update.
+	Patch func(company *model.Company) error
+}
+
+// CompanyBatchResult is the outcome of an operation: the created or updated company, or the error.
+type CompanyBatchResult struct {
+	Company *model.Company
+	Err     error
+}
+
+// Batch applies the operations in order and returns their results, in the same order.
+//
+// An atomic batch runs in a single transaction: when an operation fails, none are applied,
+// the failed operation gets its error, the others get ErrBatchAborted, and the error of the
+// failed operation is also returned. Otherwise every operation is applied on its own and
+// only the failed ones are not.
+func (s *Company) Batch(ctx context.Context, operations []CompanyBatchOperation, atomic bool) ([]CompanyBatchResult, error) {
+	if len(operations) == 0 || len(operations) > MaxCompanyBatchSize {
+		return nil, fmt.Errorf("%w: batch: %w: between 1 and %d operations are allowed", ErrCompanyService, ErrInvalidBatch, MaxCompanyBatchSize)
+	}
+	for i, operation := range operations {
+		if err := validateBatchOperation(operation); err != nil {
+			return nil, fmt.Errorf("%w: batch: %w: operation %d: %w", ErrCompanyService, ErrInvalidBatch, i, err)
+		}
+	}
+
+	results := make([]CompanyBatchResult, len(operations))
+	if !atomic {
+		for i, operation := range operations {
+			err := s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+				var err error
+				results[i].Company, err = s.applyBatchOperation(ctx, repo, operation)
+				return err
+			})
+			if err != nil {
+				results[i] = CompanyBatchResult{Err: fmt.Errorf("%w: batch: %w", ErrCompanyService, classify(err))}
+			}
+		}
+
+		return results, nil
+	}
+
+	failed := -1
+	err := s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+		for i, operation := range operations {
+			company, err := s.applyBatchOperation(ctx, repo, operation)
+			if err != nil {
+				failed = i
+				return err
+			}
+			results[i].Company = company
+		}
+
+		return nil
+	})
+	if err == nil {
+		return results, nil
+	}
+
+	err = fmt.Errorf("%w: batch: %w", ErrCompanyService, classify(err))
+	for i := range results {
+		results[i] = CompanyBatchResult{Err: ErrBatchAborted}
+	}
+	if failed >= 0 {
+		results[failed].Err = err
+	}
+
+	return results, err
+}
+
+func validateBatchOperation(operation CompanyBatchOperation) error {
+	switch operation.Op {
+	case BatchCreate:
+		if operation.Company == nil {
+			return errors.New("create needs a company")
+		}
+	case BatchUpdate:
+		if operation.ID == uuid.Nil || operation.Patch == nil {
+			return errors.New("update needs an ID and a patch")
+		}
+	case BatchDelete:
+		if operation.ID == uuid.Nil {
+			return errors.New("delete needs an ID")
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", operation.Op)
+	}
+
+	return nil
+}
+
+func (s *Company) applyBatchOperation(ctx context.Context, repo repository.CompanyRepository, operation CompanyBatchOperation) (*model.Company, error) {
+	switch operation.Op {
+	case BatchCreate:
+		if err := s.validator.Struct(operation.Company); err != nil {
+			return nil, newValidationError(err)
+		}
+
+		return operation.Company, create(ctx, repo, operation.Company)
+	case BatchUpdate:
+		company, err := repo.Get(operation.ID)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Version != 0 {
+			company.Version = operation.Version
+		}
+		if err := operation.Patch(company); err != nil {
+			return nil, err
+		}
+		company.ID = operation.ID
+		if err := s.validator.Struct(company); err != nil {
+			return nil, newValidationError(err)
+		}
+
+		return company, update(ctx, repo, company)
+	default:
+		return nil, remove(ctx, repo, operation.ID, operation.Version)
+	}
+}
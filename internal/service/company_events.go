@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"slices"
+)
+
+const DefaultCompanyEventLimit = 100
+
+// CompanyEventQuery selects the change events following an event, for a change feed.
+type CompanyEventQuery struct {
+	// AfterSequence is the sequence number of the last event already received, 0 to start with the
+	// first event.
+	AfterSequence uint64
+	CompanyIDs    []uuid.UUID
+	Types         []model.CompanyType
+	Limit         int
+}
+
+// Events returns the change events following query.AfterSequence, in sequence order, and the
+// sequence number to resume from, which is past the events left out by the filters.
+//
+// The events are in the feed once the event dispatcher numbered them, in the order they were
+// committed rather than in the order of their IDs, so that an event committed late still follows
+// the events already read.
+func (s *Company) Events(ctx context.Context, query CompanyEventQuery) ([]model.OutboxEvent, uint64, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultCompanyEventLimit
+	}
+
+	events, err := s.repository.WithContext(ctx).ListEvents(query.AfterSequence, query.CompanyIDs, query.Limit)
+	if err != nil {
+		return nil, query.AfterSequence, fmt.Errorf("%w: events: %w", ErrCompanyService, err)
+	}
+	if len(events) == 0 {
+		return nil, query.AfterSequence, nil
+	}
+
+	next := *events[len(events)-1].Sequence
+	if len(query.Types) == 0 {
+		return events, next, nil
+	}
+
+	matching := events[:0]
+	for _, event := range events {
+		var company struct{ Type model.CompanyType }
+		if err := json.Unmarshal([]byte(event.Payload), &company); err != nil {
+			return nil, query.AfterSequence, fmt.Errorf("%w: events: decode %d: %w", ErrCompanyService, event.ID, err)
+		}
+		if slices.Contains(query.Types, company.Type) {
+			matching = append(matching, event)
+		}
+	}
+
+	return matching, next, nil
+}
+
+// LastEventSequence returns the sequence number of the latest change event, for a change feed
+// starting now.
+func (s *Company) LastEventSequence(ctx context.Context) (uint64, error) {
+	sequence, err := s.repository.WithContext(ctx).LastEventSequence()
+	if err != nil {
+		return 0, fmt.Errorf("%w: last event: %w", ErrCompanyService, err)
+	}
+
+	return sequence, nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/model"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CompanyFormat is a file format of company exports and imports.
+type CompanyFormat string
+
+const (
+	CompanyFormatCSV    CompanyFormat = "csv"
+	CompanyFormatNDJSON CompanyFormat = "ndjson"
+	CompanyFormatJSON   CompanyFormat = "json"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// companyColumns are the CSV columns of an export, in order. Imports accept them in any order.
+var companyColumns = []string{"ID", "Name", "Description", "AmountOfEmployees", "Registered", "Type"}
+
+// ParseCompanyFormat returns the format with the given name.
+func ParseCompanyFormat(name string) (CompanyFormat, error) {
+	switch format := CompanyFormat(name); format {
+	case CompanyFormatCSV, CompanyFormatNDJSON, CompanyFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w %q, expected csv, ndjson or json", ErrUnknownFormat, name)
+	}
+}
+
+// ContentType is the media type of the format.
+func (f CompanyFormat) ContentType() string {
+	switch f {
+	case CompanyFormatCSV:
+		return "text/csv"
+	case CompanyFormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+// flusher is implemented by writers that can push the written data to their client, e.g. HTTP responses.
+type flusher interface {
+	Flush()
+}
+
+// Export writes the companies matching the query to w, one page at a time, and returns how many it wrote.
+// The limit and cursor of the query are ignored.
+func (s *Company) Export(ctx context.Context, w io.Writer, format CompanyFormat, query CompanyListQuery) (int, error) {
+	if _, err := ParseCompanyFormat(string(format)); err != nil {
+		return 0, fmt.Errorf("%w: export: %w", ErrCompanyService, err)
+	}
+
+	buffer := bufio.NewWriter(w)
+	encoder := newCompanyEncoder(buffer, format)
+	query.Limit = MaxCompanyListLimit
+	query.Cursor = ""
+
+	count := 0
+	for {
+		page, err := s.List(ctx, query)
+		if err != nil {
+			return count, err
+		}
+
+		for i := range page.Items {
+			if err := encoder.Encode(&page.Items[i]); err != nil {
+				return count, fmt.Errorf("%w: export: %w", ErrCompanyService, err)
+			}
+			count++
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		if err := flush(buffer, encoder, w); err != nil {
+			return count, fmt.Errorf("%w: export: %w", ErrCompanyService, err)
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if err := encoder.Close(); err != nil {
+		return count, fmt.Errorf("%w: export: %w", ErrCompanyService, err)
+	}
+	if err := flush(buffer, encoder, w); err != nil {
+		return count, fmt.Errorf("%w: export: %w", ErrCompanyService, err)
+	}
+
+	return count, nil
+}
+
+func flush(buffer *bufio.Writer, encoder companyEncoder, w io.Writer) error {
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	if err := buffer.Flush(); err != nil {
+		return err
+	}
+	if f, ok := w.(flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// companyEncoder writes companies in one of the export formats.
+type companyEncoder interface {
+	Encode(company *model.Company) error
+	// Flush writes the buffered companies.
+	Flush() error
+	// Close ends the document.
+	Close() error
+}
+
+func newCompanyEncoder(w io.Writer, format CompanyFormat) companyEncoder {
+	switch format {
+	case CompanyFormatCSV:
+		return &csvCompanyEncoder{writer: csv.NewWriter(w)}
+	case CompanyFormatNDJSON:
+		return &jsonCompanyEncoder{w: w, encoder: json.NewEncoder(w)}
+	default:
+		return &jsonCompanyEncoder{w: w, encoder: json.NewEncoder(w), array: true}
+	}
+}
+
+// csvFormulaPrefixes are the first characters that make spreadsheets evaluate a cell as a formula.
+// The quote itself is escaped too, so that the decoder can tell an escaped cell from a quoted one.
+const csvFormulaPrefixes = "=+-@\t\r'"
+
+// csvEscape prefixes the text cells starting like a formula with a quote, which spreadsheets show
+// as text and hide, so that an exported name such as =HYPERLINK(...) is not run when opened.
+// csvUnescape removes the prefix on import.
+func csvEscape(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func csvUnescape(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+
+	return value
+}
+
+type csvCompanyEncoder struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (e *csvCompanyEncoder) Encode(company *model.Company) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	return e.writer.Write([]string{
+		company.ID.String(),
+		csvEscape(company.Name),
+		csvEscape(company.Description),
+		strconv.Itoa(company.AmountOfEmployees),
+		strconv.FormatBool(company.Registered),
+		csvEscape(string(company.Type)),
+	})
+}
+
+func (e *csvCompanyEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+
+	return e.writer.Write(companyColumns)
+}
+
+func (e *csvCompanyEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvCompanyEncoder) Close() error {
+	// An empty export still has the header.
+	return e.writeHeader()
+}
+
+// jsonCompanyEncoder writes a company per line, inside a JSON array when array is set.
+type jsonCompanyEncoder struct {
+	w       io.Writer
+	encoder *json.Encoder
+	array   bool
+	count   int
+}
+
+func (e *jsonCompanyEncoder) Encode(company *model.Company) error {
+	if e.array {
+		separator := ",\n"
+		if e.count == 0 {
+			separator = "[\n"
+		}
+		if _, err := io.WriteString(e.w, separator); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	return e.encoder.Encode(dto.NewCompany(company))
+}
+
+func (e *jsonCompanyEncoder) Flush() error {
+	return nil
+}
+
+func (e *jsonCompanyEncoder) Close() error {
+	if !e.array {
+		return nil
+	}
+
+	end := "]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+
+	return err
+}
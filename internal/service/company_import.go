@@ -0,0 +1,401 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidImport is the error of a line that could not be read. It ends the import.
+	ErrInvalidImport = errors.New("invalid import")
+	// ErrInvalidLine is the error of a line that is not a company. The import goes on with the next line.
+	ErrInvalidLine = errors.New("invalid line")
+	// ErrDeletedName is the error of a line with the name of a soft deleted company. The import neither
+	// restores nor overwrites it: the company has to be restored, or purged, first.
+	ErrDeletedName = errors.New("name of a deleted company")
+)
+
+// errDryRun rolls back the transaction of an imported line in a dry run.
+var errDryRun = errors.New("dry run")
+
+// CompanyImportOptions change how the companies are imported.
+type CompanyImportOptions struct {
+	// DryRun checks every line against the stored companies but saves nothing.
+	DryRun bool
+	// Upsert updates the stored company with the same name instead of failing with ErrDuplicateName.
+	Upsert bool
+}
+
+// CompanyImportResult sums up an import.
+type CompanyImportResult struct {
+	Created int
+	Updated int
+	// Errors holds the failed lines, in order.
+	Errors []CompanyImportError
+}
+
+// CompanyImportError is the error of a line of an import. Line numbers start at 1.
+type CompanyImportError struct {
+	Line int
+	Err  error
+}
+
+func (e CompanyImportError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e CompanyImportError) Unwrap() error {
+	return e.Err
+}
+
+// Import reads companies from r and creates them, each line in its own transaction: the lines
+// that fail are reported in the result and do not stop the import, except lines that cannot
+// be read at all. The returned error is only set when r fails.
+//
+// Every company is validated like those created through the API. Lines of a dry run are
+// rolled back, so a dry run does not catch duplicate names within the imported file.
+func (s *Company) Import(ctx context.Context, r io.Reader, format CompanyFormat, options CompanyImportOptions) (*CompanyImportResult, error) {
+	decoder, err := newCompanyDecoder(r, format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: import: %w", ErrCompanyService, err)
+	}
+
+	result := &CompanyImportResult{}
+	for {
+		line, company, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+
+		var readErr *readError
+		if errors.As(err, &readErr) {
+			return result, fmt.Errorf("%w: import: %w", ErrCompanyService, readErr.err)
+		}
+		if errors.Is(err, ErrInvalidImport) {
+			result.Errors = append(result.Errors, CompanyImportError{Line: line, Err: fmt.Errorf("%w: import: %w", ErrCompanyService, err)})
+			return result, nil
+		}
+		if err == nil {
+			err = s.importCompany(ctx, company, options, result)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, CompanyImportError{Line: line, Err: fmt.Errorf("%w: import: %w", ErrCompanyService, classify(err))})
+		}
+	}
+}
+
+func (s *Company) importCompany(ctx context.Context, company *model.Company, options CompanyImportOptions, result *CompanyImportResult) error {
+	if err := s.validator.Struct(company); err != nil {
+		return newValidationError(err)
+	}
+
+	updated := false
+	err := s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+		stored, err := repo.IncludeDeleted().GetByName(company.Name)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if stored != nil && stored.DeletedAt.Valid {
+			return fmt.Errorf("%w: %s, restore it first", ErrDeletedName, stored.ID)
+		}
+
+		if stored != nil && options.Upsert {
+			updated = true
+			stored.Description = company.Description
+			stored.AmountOfEmployees = company.AmountOfEmployees
+			stored.Registered = company.Registered
+			stored.Type = company.Type
+			err = update(ctx, repo, stored)
+		} else {
+			err = create(ctx, repo, company)
+		}
+		if err == nil && options.DryRun {
+			return errDryRun
+		}
+
+		return err
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return err
+	}
+
+	if updated {
+		result.Updated++
+	} else {
+		result.Created++
+	}
+
+	return nil
+}
+
+// readError is a failure of the reader of an import, as opposed to invalid content.
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string {
+	return e.err.Error()
+}
+
+// companyDecoder reads the companies of an import one at a time.
+type companyDecoder interface {
+	// Decode returns the next company and the number of its line. It returns io.EOF at the end,
+	// a readError when the reader fails, ErrInvalidImport when the rest cannot be read, and
+	// ErrInvalidLine or a ValidationError for a line that can be skipped.
+	Decode() (int, *model.Company, error)
+}
+
+func newCompanyDecoder(r io.Reader, format CompanyFormat) (companyDecoder, error) {
+	switch format {
+	case CompanyFormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		return &csvCompanyDecoder{reader: reader}, nil
+	case CompanyFormatNDJSON:
+		return &ndjsonCompanyDecoder{reader: bufio.NewReader(r)}, nil
+	case CompanyFormatJSON:
+		lines := &lineCounter{r: r}
+		return &jsonCompanyDecoder{decoder: json.NewDecoder(lines), lines: lines}, nil
+	default:
+		_, err := ParseCompanyFormat(string(format))
+		return nil, err
+	}
+}
+
+// decodeCompany decodes a JSON object, rejecting unknown fields. The ID and the deletion
+// time of exported companies are accepted and ignored.
+func decodeCompany(data []byte) (*model.Company, error) {
+	company := &dto.Company{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(company); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLine, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: more than one company on the line", ErrInvalidLine)
+	}
+
+	return &model.Company{
+		Name:              company.Name,
+		Description:       company.Description,
+		AmountOfEmployees: company.AmountOfEmployees,
+		Registered:        company.Registered,
+		Type:              company.Type,
+	}, nil
+}
+
+type csvCompanyDecoder struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func (d *csvCompanyDecoder) Decode() (int, *model.Company, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return 1, nil, err
+		}
+	}
+
+	record, err := d.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	if errors.Is(err, io.EOF) {
+		return 0, nil, err
+	}
+	if err != nil {
+		return 0, nil, &readError{err: err}
+	}
+	line, _ := d.reader.FieldPos(0)
+	if len(record) != len(d.columns) {
+		return line, nil, fmt.Errorf("%w: expected %d fields, got %d", ErrInvalidLine, len(d.columns), len(record))
+	}
+
+	company := &model.Company{}
+	invalid := &ValidationError{}
+	for i, column := range d.columns {
+		value := record[i]
+		switch column {
+		case "Name":
+			company.Name = csvUnescape(value)
+		case "Description":
+			company.Description = csvUnescape(value)
+		case "AmountOfEmployees":
+			if value == "" {
+				break
+			}
+			company.AmountOfEmployees, err = strconv.Atoi(value)
+			if err != nil {
+				invalid.Fields = append(invalid.Fields, FieldError{Field: column, Code: "number", Message: "must be a whole number"})
+			}
+		case "Registered":
+			if value == "" {
+				break
+			}
+			company.Registered, err = strconv.ParseBool(value)
+			if err != nil {
+				invalid.Fields = append(invalid.Fields, FieldError{Field: column, Code: "boolean", Message: "must be true or false"})
+			}
+		case "Type":
+			company.Type = model.CompanyType(csvUnescape(value))
+		}
+	}
+	if len(invalid.Fields) > 0 {
+		return line, nil, invalid
+	}
+
+	return line, company, nil
+}
+
+// readHeader reads the column names. They match the exported columns regardless of case.
+func (d *csvCompanyDecoder) readHeader() error {
+	header, err := d.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return err
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	if err != nil {
+		return &readError{err: err}
+	}
+
+	for _, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		index := slices.IndexFunc(companyColumns, func(column string) bool { return strings.EqualFold(column, name) })
+		if index < 0 {
+			return fmt.Errorf("%w: unknown column %q", ErrInvalidImport, name)
+		}
+		if slices.Contains(d.columns, companyColumns[index]) {
+			return fmt.Errorf("%w: duplicate column %q", ErrInvalidImport, name)
+		}
+		d.columns = append(d.columns, companyColumns[index])
+	}
+	if !slices.Contains(d.columns, "Name") {
+		return fmt.Errorf("%w: missing column %q", ErrInvalidImport, "Name")
+	}
+
+	return nil
+}
+
+type ndjsonCompanyDecoder struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (d *ndjsonCompanyDecoder) Decode() (int, *model.Company, error) {
+	for {
+		data, err := d.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return d.line + 1, nil, &readError{err: err}
+		}
+		if len(data) == 0 && errors.Is(err, io.EOF) {
+			return d.line, nil, io.EOF
+		}
+
+		d.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		company, err := decodeCompany(data)
+		return d.line, company, err
+	}
+}
+
+// jsonCompanyDecoder reads the companies of a JSON array.
+type jsonCompanyDecoder struct {
+	decoder *json.Decoder
+	lines   *lineCounter
+	started bool
+}
+
+func (d *jsonCompanyDecoder) Decode() (int, *model.Company, error) {
+	if !d.started {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return d.line(), nil, d.syntaxError(err)
+		}
+		if token != json.Delim('[') {
+			return d.line(), nil, fmt.Errorf("%w: expected an array of companies", ErrInvalidImport)
+		}
+		d.started = true
+	}
+
+	if !d.decoder.More() {
+		if _, err := d.decoder.Token(); err != nil {
+			return d.line(), nil, d.syntaxError(err)
+		}
+
+		return d.line(), nil, io.EOF
+	}
+
+	var data json.RawMessage
+	if err := d.decoder.Decode(&data); err != nil {
+		return d.line(), nil, d.syntaxError(err)
+	}
+	// The line of the company is the line where its object starts.
+	line := d.lines.Line(d.decoder.InputOffset() - int64(len(data)))
+	company, err := decodeCompany(data)
+
+	return line, company, err
+}
+
+func (d *jsonCompanyDecoder) line() int {
+	return d.lines.Line(d.decoder.InputOffset())
+}
+
+func (d *jsonCompanyDecoder) syntaxError(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if d.lines.err != nil {
+		return &readError{err: d.lines.err}
+	}
+
+	return fmt.Errorf("%w: %w", ErrInvalidImport, err)
+}
+
+// lineCounter remembers the offsets of the line breaks read from r.
+type lineCounter struct {
+	r      io.Reader
+	offset int64
+	breaks []int64
+	err    error
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.breaks = append(c.breaks, c.offset+int64(i))
+		}
+	}
+	c.offset += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.err = err
+	}
+
+	return n, err
+}
+
+// Line returns the line of the byte at offset.
+func (c *lineCounter) Line(offset int64) int {
+	return sort.Search(len(c.breaks), func(i int) bool { return c.breaks[i] >= offset }) + 1
+}
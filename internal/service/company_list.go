@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCompanyListLimit = 20
+	MaxCompanyListLimit     = 100
+)
+
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+// CompanySort is a single sort criterion of a company listing.
+type CompanySort = repository.CompanySort
+
+// CompanyListQuery describes a page of companies to fetch.
+type CompanyListQuery struct {
+	Types        []model.CompanyType
+	Registered   *bool
+	MinEmployees *int
+	MaxEmployees *int
+	NamePrefix   string
+	Sort         []CompanySort
+	Limit        int
+	Cursor       string
+	// IncludeDeleted also lists the soft deleted companies.
+	IncludeDeleted bool
+}
+
+// CompanyList is a page of companies and the cursor of the next page, if any.
+type CompanyList struct {
+	Items      []model.Company
+	NextCursor string
+}
+
+// companyCursor holds the sort keys of the last company of a page.
+type companyCursor struct {
+	Sort              string            `json:"s"`
+	ID                uuid.UUID         `json:"id"`
+	Name              string            `json:"n"`
+	Type              model.CompanyType `json:"t"`
+	AmountOfEmployees int               `json:"a"`
+	Registered        bool              `json:"r"`
+	CreatedAt         time.Time         `json:"c"`
+}
+
+func (s *Company) List(ctx context.Context, query CompanyListQuery) (*CompanyList, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultCompanyListLimit
+	}
+	if query.Limit > MaxCompanyListLimit {
+		query.Limit = MaxCompanyListLimit
+	}
+
+	for _, sort := range query.Sort {
+		if !repository.IsCompanySortField(sort.Field) {
+			return nil, fmt.Errorf("%w: list: %w: unknown sort field %q", ErrCompanyService, ErrInvalidListQuery, sort.Field)
+		}
+	}
+	if query.MinEmployees != nil && query.MaxEmployees != nil && *query.MinEmployees > *query.MaxEmployees {
+		return nil, fmt.Errorf("%w: list: %w: employees range is empty", ErrCompanyService, ErrInvalidListQuery)
+	}
+
+	var after *model.Company
+	sortKey := encodeCompanySort(query.Sort)
+	if query.Cursor != "" {
+		cursor, err := decodeCompanyCursor(query.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: list: %w: %w", ErrCompanyService, ErrInvalidListQuery, err)
+		}
+		if cursor.Sort != sortKey {
+			return nil, fmt.Errorf("%w: list: %w: cursor does not match sort", ErrCompanyService, ErrInvalidListQuery)
+		}
+
+		after = &model.Company{
+			ID:                cursor.ID,
+			Name:              cursor.Name,
+			Type:              cursor.Type,
+			AmountOfEmployees: cursor.AmountOfEmployees,
+			Registered:        cursor.Registered,
+			CreatedAt:         cursor.CreatedAt,
+		}
+	}
+
+	filter := repository.CompanyFilter{
+		Types:        query.Types,
+		Registered:   query.Registered,
+		MinEmployees: query.MinEmployees,
+		MaxEmployees: query.MaxEmployees,
+		NamePrefix:   query.NamePrefix,
+	}
+	repo := s.repository.WithContext(ctx)
+	if query.IncludeDeleted {
+		repo = repo.IncludeDeleted()
+	}
+	companies, err := repo.List(filter, query.Sort, after, query.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: list: %w", ErrCompanyService, err)
+	}
+
+	result := &CompanyList{Items: companies}
+	if len(companies) > query.Limit {
+		result.Items = companies[:query.Limit]
+		result.NextCursor, err = encodeCompanyCursor(sortKey, &result.Items[query.Limit-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: list: %w", ErrCompanyService, err)
+		}
+	}
+
+	return result, nil
+}
+
+func encodeCompanySort(sorts []CompanySort) string {
+	fields := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		if sort.Desc {
+			fields = append(fields, "-"+sort.Field)
+			continue
+		}
+		fields = append(fields, sort.Field)
+	}
+
+	return strings.Join(fields, ",")
+}
+
+func encodeCompanyCursor(sortKey string, company *model.Company) (string, error) {
+	data, err := json.Marshal(companyCursor{
+		Sort:              sortKey,
+		ID:                company.ID,
+		Name:              company.Name,
+		Type:              company.Type,
+		AmountOfEmployees: company.AmountOfEmployees,
+		Registered:        company.Registered,
+		CreatedAt:         company.CreatedAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCompanyCursor(value string) (*companyCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	var cursor companyCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxCompanySearchTerms is the number of words of a search query that are used, the rest are ignored.
+const MaxCompanySearchTerms = 16
+
+// CompanySearchHit is a company found by a search.
+type CompanySearchHit = repository.CompanySearchHit
+
+// CompanySearchQuery describes a page of a full-text search of the companies.
+type CompanySearchQuery struct {
+	// Query is the searched text. Its words are matched as prefixes of the words of
+	// the name or description, and a company must match all of them.
+	Query      string
+	Types      []model.CompanyType
+	Registered *bool
+	Limit      int
+	Cursor     string
+}
+
+// CompanySearchResult is a page of search hits, most relevant first, and the cursor of the next page, if any.
+type CompanySearchResult struct {
+	Items      []CompanySearchHit
+	NextCursor string
+}
+
+func (s *Company) Search(ctx context.Context, query CompanySearchQuery) (*CompanySearchResult, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultCompanyListLimit
+	}
+	if query.Limit > MaxCompanyListLimit {
+		query.Limit = MaxCompanyListLimit
+	}
+
+	terms := searchTerms(query.Query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: search: %w: the query has no words", ErrCompanyService, ErrInvalidListQuery)
+	}
+
+	offset := 0
+	if query.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(query.Cursor)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("%w: search: %w: malformed cursor", ErrCompanyService, ErrInvalidListQuery)
+		}
+	}
+
+	// One more hit than asked tells whether there is a next page.
+	hits, err := s.repository.WithContext(ctx).Search(repository.CompanySearch{
+		Terms:      terms,
+		Types:      query.Types,
+		Registered: query.Registered,
+		Offset:     offset,
+		Limit:      query.Limit + 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: search: %w", ErrCompanyService, err)
+	}
+
+	result := &CompanySearchResult{Items: hits}
+	if len(hits) > query.Limit {
+		result.Items = hits[:query.Limit]
+		result.NextCursor = strconv.Itoa(offset + query.Limit)
+	}
+
+	return result, nil
+}
+
+// searchTerms splits the query in lower case words of letters and digits.
+func searchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return words[:min(len(words), MaxCompanySearchTerms)]
+}
@@ -1,13 +1,24 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
 	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/dto"
+	"github.com/vcsfrl/xm/internal/event"
 	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
 	"github.com/vcsfrl/xm/internal/validator"
 	"gorm.io/gorm"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompany(t *testing.T) {
@@ -29,7 +40,7 @@ func (cf *CompanyFixture) SetupTest() {
 }
 
 func (cf *CompanyFixture) TestCreate() {
-	service := NewCompanyService(cf.db, validator.CompanyValidator(cf.logger))
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
 
 	company := &model.Company{
 		Name:              "TestCompany",
@@ -39,13 +50,13 @@ func (cf *CompanyFixture) TestCreate() {
 		Type:              "Corporations",
 	}
 
-	err := service.Create(company)
+	err := service.Create(context.Background(), company)
 	cf.NoError(err)
 	cf.NotNil(company.ID)
 }
 
 func (cf *CompanyFixture) TestGet() {
-	service := NewCompanyService(cf.db, validator.CompanyValidator(cf.logger))
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
 
 	company := &model.Company{
 		Name:              "TestCompany",
@@ -56,13 +67,43 @@ func (cf *CompanyFixture) TestGet() {
 	}
 	cf.db.Create(company)
 
-	result, err := service.Get(company.ID)
+	result, err := service.Get(context.Background(), company.ID)
 	cf.NoError(err)
 	cf.Equal(company.Name, result.Name)
 }
 
+func (cf *CompanyFixture) TestErrors() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+
+	_, err := service.Get(context.Background(), uuid.New())
+	cf.ErrorIs(err, ErrNotFound)
+
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	cf.NoError(service.Create(context.Background(), company))
+
+	err = service.Create(context.Background(), &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation})
+	cf.ErrorIs(err, ErrConflict)
+	cf.ErrorIs(err, ErrDuplicateName)
+
+	stale := *company
+	company.Description = "first"
+	cf.NoError(service.Update(context.Background(), company))
+	err = service.Update(context.Background(), &stale)
+	cf.ErrorIs(err, ErrConflict)
+	cf.ErrorIs(err, ErrVersionConflict)
+
+	err = service.Create(context.Background(), &model.Company{Name: "Invalid", AmountOfEmployees: -1, Type: "Unknown"})
+	cf.ErrorIs(err, ErrValidation)
+	var validationError *ValidationError
+	cf.Require().ErrorAs(err, &validationError)
+	cf.Equal([]FieldError{
+		{Field: "AmountOfEmployees", Code: "min", Message: "must be at least 0"},
+		{Field: "Type", Code: "company_type", Message: "is not a known company type"},
+	}, validationError.Fields)
+}
+
 func (cf *CompanyFixture) TestUpdate() {
-	service := NewCompanyService(cf.db, validator.CompanyValidator(cf.logger))
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
 
 	company := &model.Company{
 		Name:              "TestCompany",
@@ -78,10 +119,10 @@ func (cf *CompanyFixture) TestUpdate() {
 	company.AmountOfEmployees = 20
 	company.Registered = false
 	company.Type = model.CompanyTypeSoleProprietorship
-	err := service.Update(company)
+	err := service.Update(context.Background(), company)
 	cf.NoError(err)
 
-	result, _ := service.Get(company.ID)
+	result, _ := service.Get(context.Background(), company.ID)
 	cf.Equal("UpdatedCompany", result.Name)
 	cf.Equal("An updated test company", result.Description)
 	cf.Equal(20, result.AmountOfEmployees)
@@ -90,7 +131,7 @@ func (cf *CompanyFixture) TestUpdate() {
 }
 
 func (cf *CompanyFixture) TestDelete() {
-	service := NewCompanyService(cf.db, validator.CompanyValidator(cf.logger))
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
 
 	company := &model.Company{
 		Name:              "TestCompany",
@@ -101,10 +142,606 @@ func (cf *CompanyFixture) TestDelete() {
 	}
 	cf.db.Create(company)
 
-	err := service.Delete(company.ID)
+	err := service.Delete(context.Background(), company.ID, 0)
 	cf.NoError(err)
 
-	result, err := service.Get(company.ID)
+	result, err := service.Get(context.Background(), company.ID)
 	cf.Error(err)
 	cf.Nil(result)
 }
+
+func (cf *CompanyFixture) TestRestore() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+
+	company := &model.Company{
+		Name:              "TestCompany",
+		AmountOfEmployees: 10,
+		Type:              model.CompanyTypeCorporation,
+	}
+	cf.NoError(service.Create(context.Background(), company))
+	cf.NoError(service.Delete(context.Background(), company.ID, 0))
+
+	deleted, err := service.GetIncludingDeleted(context.Background(), company.ID)
+	cf.NoError(err)
+	cf.True(deleted.DeletedAt.Valid)
+
+	restored, err := service.Restore(context.Background(), company.ID)
+	cf.NoError(err)
+	cf.False(restored.DeletedAt.Valid)
+	cf.Equal(2, restored.Version)
+
+	// Restoring a company that is not deleted changes nothing.
+	restored, err = service.Restore(context.Background(), company.ID)
+	cf.NoError(err)
+	cf.Equal(2, restored.Version)
+
+	_, err = service.Restore(context.Background(), uuid.New())
+	cf.ErrorIs(err, ErrNotFound)
+
+	var events []model.OutboxEvent
+	cf.NoError(cf.db.Order("id ASC").Find(&events).Error)
+	cf.Len(events, 3)
+	cf.Equal(model.EventCompanyRestored, events[2].Type)
+
+	history, err := service.History(context.Background(), company.ID, 10, "")
+	cf.NoError(err)
+	cf.Len(history.Items, 3)
+	cf.Equal(model.AuditActionRestore, history.Items[0].Action)
+}
+
+func (cf *CompanyFixture) TestPurge() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	result, err := service.List(context.Background(), CompanyListQuery{})
+	cf.NoError(err)
+	deleted := result.Items[0].ID
+	cf.NoError(service.Delete(context.Background(), deleted, 0))
+	cf.NoError(service.Delete(context.Background(), result.Items[1].ID, 0))
+
+	count, err := service.Purge(context.Background(), time.Now().Add(-time.Hour))
+	cf.NoError(err)
+	cf.Equal(0, count)
+
+	result, err = service.List(context.Background(), CompanyListQuery{IncludeDeleted: true})
+	cf.NoError(err)
+	cf.Len(result.Items, 5)
+
+	count, err = service.Purge(context.Background(), time.Now().Add(time.Second))
+	cf.NoError(err)
+	cf.Equal(2, count)
+
+	result, err = service.List(context.Background(), CompanyListQuery{IncludeDeleted: true})
+	cf.NoError(err)
+	cf.Len(result.Items, 3)
+
+	history, err := service.History(context.Background(), deleted, 10, "")
+	cf.NoError(err)
+	cf.Len(history.Items, 3)
+	cf.Equal(model.AuditActionPurge, history.Items[0].Action)
+}
+
+func (cf *CompanyFixture) TestEvents() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+
+	company := &model.Company{
+		Name:              "TestCompany",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              model.CompanyTypeCorporation,
+	}
+	cf.NoError(service.Create(context.Background(), company))
+
+	// A failed change must not leave an event behind.
+	duplicate := &model.Company{
+		Name:              "TestCompany",
+		AmountOfEmployees: 10,
+		Type:              model.CompanyTypeCorporation,
+	}
+	cf.Error(service.Create(context.Background(), duplicate))
+
+	company.AmountOfEmployees = 20
+	cf.NoError(service.Update(context.Background(), company))
+	cf.NoError(service.Delete(context.Background(), company.ID, 0))
+
+	var events []model.OutboxEvent
+	cf.NoError(cf.db.Order("id ASC").Find(&events).Error)
+	cf.Len(events, 3)
+	cf.Equal(model.EventCompanyCreated, events[0].Type)
+	cf.Equal(model.EventCompanyUpdated, events[1].Type)
+	cf.Equal(model.EventCompanyDeleted, events[2].Type)
+	for _, event := range events {
+		cf.Equal(company.ID, event.AggregateID)
+		cf.Nil(event.PublishedAt)
+	}
+	cf.Contains(events[1].Payload, `"AmountOfEmployees":20`)
+}
+
+func (cf *CompanyFixture) TestEventFeed() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+
+	corporation := &model.Company{Name: "Corporation", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	cf.NoError(service.Create(context.Background(), corporation))
+	nonProfit := &model.Company{Name: "NonProfit", AmountOfEmployees: 5, Type: model.CompanyTypeNonProfit}
+	cf.NoError(service.Create(context.Background(), nonProfit))
+	corporation.AmountOfEmployees = 20
+	cf.NoError(service.Update(context.Background(), corporation))
+
+	// The events are in the feed once numbered.
+	lastSequence, err := service.LastEventSequence(context.Background())
+	cf.NoError(err)
+	cf.Zero(lastSequence)
+	cf.sequenceEvents()
+	lastSequence, err = service.LastEventSequence(context.Background())
+	cf.NoError(err)
+	cf.Equal(uint64(3), lastSequence)
+
+	events, next, err := service.Events(context.Background(), CompanyEventQuery{})
+	cf.NoError(err)
+	cf.Len(events, 3)
+	cf.Equal(uint64(3), next)
+
+	events, next, err = service.Events(context.Background(), CompanyEventQuery{AfterSequence: 1, Limit: 1})
+	cf.NoError(err)
+	cf.Len(events, 1)
+	cf.Equal(nonProfit.ID, events[0].AggregateID)
+	cf.Equal(uint64(2), next)
+
+	events, next, err = service.Events(context.Background(), CompanyEventQuery{CompanyIDs: []uuid.UUID{corporation.ID}})
+	cf.NoError(err)
+	cf.Len(events, 2)
+	cf.Equal(model.EventCompanyUpdated, events[1].Type)
+	cf.Equal(uint64(3), next)
+
+	// The events left out by the type filter are skipped all the same.
+	events, next, err = service.Events(context.Background(), CompanyEventQuery{Types: []model.CompanyType{model.CompanyTypeNonProfit}})
+	cf.NoError(err)
+	cf.Len(events, 1)
+	cf.Equal(nonProfit.ID, events[0].AggregateID)
+	cf.Equal(uint64(3), next)
+
+	events, next, err = service.Events(context.Background(), CompanyEventQuery{AfterSequence: 3})
+	cf.NoError(err)
+	cf.Empty(events)
+	cf.Equal(uint64(3), next)
+}
+
+func (cf *CompanyFixture) TestEventFeed_LateCommit() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	companyID := uuid.New()
+
+	// The event with the higher ID is committed and read first.
+	cf.NoError(cf.db.Create(&model.OutboxEvent{ID: 2, Type: model.EventCompanyCreated, AggregateID: companyID, Payload: "{}"}).Error)
+	cf.sequenceEvents()
+	events, next, err := service.Events(context.Background(), CompanyEventQuery{})
+	cf.NoError(err)
+	cf.Require().Len(events, 1)
+	cf.Equal(uint64(2), events[0].ID)
+	cf.Equal(uint64(1), next)
+
+	// The event with the lower ID, committed later, follows it in the feed.
+	cf.NoError(cf.db.Create(&model.OutboxEvent{ID: 1, Type: model.EventCompanyUpdated, AggregateID: companyID, Payload: "{}"}).Error)
+	cf.sequenceEvents()
+	events, next, err = service.Events(context.Background(), CompanyEventQuery{AfterSequence: next})
+	cf.NoError(err)
+	cf.Require().Len(events, 1)
+	cf.Equal(uint64(1), events[0].ID)
+	cf.Equal(uint64(2), *events[0].Sequence)
+	cf.Equal(uint64(2), next)
+
+	lastSequence, err := service.LastEventSequence(context.Background())
+	cf.NoError(err)
+	cf.Equal(uint64(2), lastSequence)
+}
+
+func (cf *CompanyFixture) TestHistory() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	ctx := WithRequestID(WithActor(context.Background(), dto.AuthUser{ID: 7, Username: "alice"}), "request-1")
+
+	company := &model.Company{
+		Name:              "TestCompany",
+		Description:       "A test company",
+		AmountOfEmployees: 10,
+		Registered:        false,
+		Type:              model.CompanyTypeCorporation,
+	}
+	cf.NoError(service.Create(ctx, company))
+
+	company.Registered = true
+	cf.NoError(service.Update(context.Background(), company))
+	cf.NoError(service.Delete(ctx, company.ID, 0))
+
+	history, err := service.History(context.Background(), company.ID, 2, "")
+	cf.NoError(err)
+	cf.Len(history.Items, 2)
+	cf.NotEmpty(history.NextCursor)
+
+	deleted := history.Items[0]
+	cf.Equal(model.AuditActionDelete, deleted.Action)
+	cf.Equal("alice", deleted.ActorUsername)
+	cf.Equal("request-1", deleted.RequestID)
+	cf.Equal("TestCompany", deleted.Changes["Name"].Before)
+	cf.Nil(deleted.Changes["Name"].After)
+
+	updated := history.Items[1]
+	cf.Equal(model.AuditActionUpdate, updated.Action)
+	cf.Empty(updated.ActorUsername)
+	cf.Equal(map[string]model.FieldChange{"Registered": {Before: false, After: true}}, updated.Changes)
+
+	history, err = service.History(context.Background(), company.ID, 2, history.NextCursor)
+	cf.NoError(err)
+	cf.Len(history.Items, 1)
+	cf.Empty(history.NextCursor)
+
+	created := history.Items[0]
+	cf.Equal(model.AuditActionCreate, created.Action)
+	cf.Equal(uint(7), created.ActorID)
+	cf.Equal(company.ID, created.CompanyID)
+	cf.Nil(created.Changes["AmountOfEmployees"].Before)
+	cf.EqualValues(10, created.Changes["AmountOfEmployees"].After)
+
+	_, err = service.History(context.Background(), company.ID, 2, "not a cursor")
+	cf.ErrorIs(err, ErrInvalidListQuery)
+}
+
+func (cf *CompanyFixture) TestList() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	registered := true
+	minEmployees := 20
+	result, err := service.List(context.Background(), CompanyListQuery{
+		Types:        []model.CompanyType{model.CompanyTypeCorporation},
+		Registered:   &registered,
+		MinEmployees: &minEmployees,
+		Sort:         []CompanySort{{Field: "AmountOfEmployees", Desc: true}},
+	})
+	cf.NoError(err)
+	cf.Empty(result.NextCursor)
+	cf.Len(result.Items, 2)
+	cf.Equal("Company 4", result.Items[0].Name)
+	cf.Equal("Company 2", result.Items[1].Name)
+
+	result, err = service.List(context.Background(), CompanyListQuery{NamePrefix: "Company 1"})
+	cf.NoError(err)
+	cf.Len(result.Items, 1)
+	cf.Equal("Company 1", result.Items[0].Name)
+}
+
+func (cf *CompanyFixture) TestList_Pagination() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	sort := []CompanySort{{Field: "Registered"}, {Field: "Name", Desc: true}}
+	var names []string
+	cursor := ""
+	for {
+		result, err := service.List(context.Background(), CompanyListQuery{Sort: sort, Limit: 2, Cursor: cursor})
+		cf.NoError(err)
+		cf.LessOrEqual(len(result.Items), 2)
+		for _, company := range result.Items {
+			names = append(names, company.Name)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	cf.Equal([]string{"Company 5", "Company 3", "Company 4", "Company 2", "Company 1"}, names)
+
+	_, err := service.List(context.Background(), CompanyListQuery{Sort: []CompanySort{{Field: "Name"}}, Limit: 2, Cursor: cursor})
+	cf.ErrorIs(err, ErrInvalidListQuery)
+}
+
+func (cf *CompanyFixture) TestList_InvalidQuery() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+
+	_, err := service.List(context.Background(), CompanyListQuery{Sort: []CompanySort{{Field: "Unknown"}}})
+	cf.ErrorIs(err, ErrInvalidListQuery)
+
+	_, err = service.List(context.Background(), CompanyListQuery{Cursor: "not a cursor"})
+	cf.ErrorIs(err, ErrInvalidListQuery)
+}
+
+func (cf *CompanyFixture) createCompanies(service *Company) {
+	companies := []model.Company{
+		{Name: "Company 1", AmountOfEmployees: 10, Registered: true, Type: model.CompanyTypeCorporation},
+		{Name: "Company 2", AmountOfEmployees: 20, Registered: true, Type: model.CompanyTypeCorporation},
+		{Name: "Company 3", AmountOfEmployees: 30, Registered: false, Type: model.CompanyTypeCorporation},
+		{Name: "Company 4", AmountOfEmployees: 40, Registered: true, Type: model.CompanyTypeCorporation},
+		{Name: "Company 5", AmountOfEmployees: 50, Registered: false, Type: model.CompanyTypeNonProfit},
+	}
+	for i := range companies {
+		cf.NoError(service.Create(context.Background(), &companies[i]))
+	}
+}
+
+func (cf *CompanyFixture) TestBatch() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+	existing, err := service.List(context.Background(), CompanyListQuery{})
+	cf.NoError(err)
+
+	rename := func(name string) func(*model.Company) error {
+		return func(company *model.Company) error {
+			company.Name = name
+			return nil
+		}
+	}
+	operations := []CompanyBatchOperation{
+		{Op: BatchCreate, Company: &model.Company{Name: "Company 6", AmountOfEmployees: 60, Type: model.CompanyTypeCorporation}},
+		{Op: BatchUpdate, ID: existing.Items[0].ID, Patch: rename("Renamed 1")},
+		{Op: BatchUpdate, ID: existing.Items[1].ID, Patch: rename(existing.Items[3].Name)},
+		{Op: BatchDelete, ID: existing.Items[2].ID},
+	}
+
+	// Atomic: the duplicate name rolls back every operation.
+	results, err := service.Batch(context.Background(), operations, true)
+	cf.ErrorIs(err, ErrDuplicateName)
+	cf.Len(results, 4)
+	cf.ErrorIs(results[0].Err, ErrBatchAborted)
+	cf.ErrorIs(results[1].Err, ErrBatchAborted)
+	cf.ErrorIs(results[2].Err, ErrDuplicateName)
+	cf.ErrorIs(results[3].Err, ErrBatchAborted)
+
+	list, err := service.List(context.Background(), CompanyListQuery{})
+	cf.NoError(err)
+	cf.Len(list.Items, 5)
+	unchanged, err := service.Get(context.Background(), existing.Items[0].ID)
+	cf.NoError(err)
+	cf.Equal(existing.Items[0].Name, unchanged.Name)
+
+	// Best effort: only the failed operation is not applied.
+	operations[0].Company = &model.Company{Name: "Company 6", AmountOfEmployees: 60, Type: model.CompanyTypeCorporation}
+	results, err = service.Batch(context.Background(), operations, false)
+	cf.NoError(err)
+	cf.NoError(results[0].Err)
+	cf.NotEqual(uuid.Nil, results[0].Company.ID)
+	cf.NoError(results[1].Err)
+	cf.Equal("Renamed 1", results[1].Company.Name)
+	cf.Equal(2, results[1].Company.Version)
+	cf.ErrorIs(results[2].Err, ErrDuplicateName)
+	cf.NoError(results[3].Err)
+
+	list, err = service.List(context.Background(), CompanyListQuery{})
+	cf.NoError(err)
+	cf.Len(list.Items, 5)
+
+	_, err = service.Batch(context.Background(), nil, false)
+	cf.ErrorIs(err, ErrInvalidBatch)
+	_, err = service.Batch(context.Background(), []CompanyBatchOperation{{Op: "merge"}}, false)
+	cf.ErrorIs(err, ErrInvalidBatch)
+
+	results, err = service.Batch(context.Background(), []CompanyBatchOperation{
+		{Op: BatchUpdate, ID: existing.Items[0].ID, Version: 1, Patch: rename("Stale")},
+		{Op: BatchCreate, Company: &model.Company{Name: "Invalid"}},
+	}, false)
+	cf.NoError(err)
+	cf.ErrorIs(results[0].Err, ErrVersionConflict)
+	cf.ErrorIs(results[1].Err, ErrValidation)
+}
+
+func (cf *CompanyFixture) TestExport() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	var output bytes.Buffer
+	count, err := service.Export(context.Background(), &output, CompanyFormatCSV, CompanyListQuery{Sort: []CompanySort{{Field: "Name"}}})
+	cf.NoError(err)
+	cf.Equal(5, count)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	cf.Len(lines, 6)
+	cf.Equal("ID,Name,Description,AmountOfEmployees,Registered,Type", lines[0])
+	cf.Contains(lines[1], ",Company 1,,10,true,Corporations")
+
+	output.Reset()
+	registered := true
+	count, err = service.Export(context.Background(), &output, CompanyFormatJSON, CompanyListQuery{Registered: &registered})
+	cf.NoError(err)
+	cf.Equal(3, count)
+	var companies []model.Company
+	cf.NoError(json.Unmarshal(output.Bytes(), &companies))
+	cf.Len(companies, 3)
+
+	output.Reset()
+	count, err = service.Export(context.Background(), &output, CompanyFormatNDJSON, CompanyListQuery{NamePrefix: "None"})
+	cf.NoError(err)
+	cf.Equal(0, count)
+	cf.Empty(output.String())
+
+	// Exports are not limited to a page.
+	for i := range MaxCompanyListLimit {
+		cf.NoError(service.Create(context.Background(), &model.Company{Name: fmt.Sprintf("Paged %d", i), AmountOfEmployees: 1, Type: model.CompanyTypeNonProfit}))
+	}
+	count, err = service.Export(context.Background(), &output, CompanyFormatNDJSON, CompanyListQuery{})
+	cf.NoError(err)
+	cf.Equal(MaxCompanyListLimit+5, count)
+	cf.Equal(MaxCompanyListLimit+5, strings.Count(output.String(), "\n"))
+
+	_, err = service.Export(context.Background(), &output, "xlsx", CompanyListQuery{})
+	cf.ErrorIs(err, ErrUnknownFormat)
+}
+
+func (cf *CompanyFixture) TestImport() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	csvInput := "name,AmountOfEmployees,Registered,Type,Description\n" +
+		"Imported 1,10,true,Corporations,\"Multi\nline\"\n" +
+		"Imported 2,many,true,Corporations,\n" +
+		"Company 1,99,false,Cooperative,Updated\n" +
+		"Imported 3,5,false,Unknown,\n"
+
+	// Dry run: nothing is saved.
+	result, err := service.Import(context.Background(), strings.NewReader(csvInput), CompanyFormatCSV, CompanyImportOptions{DryRun: true})
+	cf.NoError(err)
+	cf.Equal(1, result.Created)
+	cf.Len(result.Errors, 3)
+	list, err := service.List(context.Background(), CompanyListQuery{})
+	cf.NoError(err)
+	cf.Len(list.Items, 5)
+
+	result, err = service.Import(context.Background(), strings.NewReader(csvInput), CompanyFormatCSV, CompanyImportOptions{Upsert: true})
+	cf.NoError(err)
+	cf.Equal(1, result.Created)
+	cf.Equal(1, result.Updated)
+	cf.Len(result.Errors, 2)
+	cf.Equal(4, result.Errors[0].Line)
+	cf.ErrorIs(result.Errors[0].Err, ErrValidation)
+	cf.Equal(6, result.Errors[1].Line)
+	cf.ErrorIs(result.Errors[1].Err, ErrValidation)
+
+	updated, err := service.List(context.Background(), CompanyListQuery{NamePrefix: "Company 1"})
+	cf.NoError(err)
+	cf.Equal(99, updated.Items[0].AmountOfEmployees)
+	cf.Equal("Updated", updated.Items[0].Description)
+
+	// Without upsert a known name is a duplicate.
+	ndjsonInput := `{"Name":"Company 2","AmountOfEmployees":1,"Type":"Corporations"}
+
+{"Name":"Imported 4","AmountOfEmployees":1,"Type":"Corporations","Extra":true}
+not json
+{"ID":"` + uuid.NewString() + `","Name":"Imported 5","AmountOfEmployees":1,"Type":"Corporations"}
+`
+	result, err = service.Import(context.Background(), strings.NewReader(ndjsonInput), CompanyFormatNDJSON, CompanyImportOptions{})
+	cf.NoError(err)
+	cf.Equal(1, result.Created)
+	cf.Len(result.Errors, 3)
+	cf.Equal(1, result.Errors[0].Line)
+	cf.ErrorIs(result.Errors[0].Err, ErrDuplicateName)
+	cf.Equal(3, result.Errors[1].Line)
+	cf.ErrorIs(result.Errors[1].Err, ErrInvalidLine)
+	cf.Equal(4, result.Errors[2].Line)
+	cf.ErrorIs(result.Errors[2].Err, ErrInvalidLine)
+
+	jsonInput := `[
+  {"Name": "Imported 6", "AmountOfEmployees": 1, "Type": "Corporations"},
+  {
+    "Name": "Imported 7", "AmountOfEmployees": "one", "Type": "Corporations"
+  },
+  {"Name": "Imported 8", "AmountOfEmployees": 1, "Type": "Corporations"}
+  {"Name": "Imported 9"}
+]`
+	result, err = service.Import(context.Background(), strings.NewReader(jsonInput), CompanyFormatJSON, CompanyImportOptions{})
+	cf.NoError(err)
+	cf.Equal(2, result.Created)
+	cf.Len(result.Errors, 2)
+	cf.Equal(3, result.Errors[0].Line)
+	cf.ErrorIs(result.Errors[0].Err, ErrInvalidLine)
+	cf.Equal(7, result.Errors[1].Line)
+	cf.ErrorIs(result.Errors[1].Err, ErrInvalidImport)
+
+	result, err = service.Import(context.Background(), strings.NewReader("Name,Employees\n"), CompanyFormatCSV, CompanyImportOptions{})
+	cf.NoError(err)
+	cf.Len(result.Errors, 1)
+	cf.Equal(1, result.Errors[0].Line)
+	cf.ErrorIs(result.Errors[0].Err, ErrInvalidImport)
+
+	list, err = service.List(context.Background(), CompanyListQuery{})
+	cf.NoError(err)
+	cf.Len(list.Items, 9)
+}
+
+func (cf *CompanyFixture) TestExportImport() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	for _, format := range []CompanyFormat{CompanyFormatCSV, CompanyFormatNDJSON, CompanyFormatJSON} {
+		var output bytes.Buffer
+		_, err := service.Export(context.Background(), &output, format, CompanyListQuery{})
+		cf.NoError(err)
+
+		result, err := service.Import(context.Background(), &output, format, CompanyImportOptions{Upsert: true})
+		cf.NoError(err)
+		cf.Empty(result.Errors, format)
+		cf.Equal(5, result.Updated, format)
+	}
+}
+
+func (cf *CompanyFixture) TestExportImport_Formulas() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	company := &model.Company{
+		Name:              `=HYPERLINK("http://example.com")`,
+		Description:       "'quoted",
+		AmountOfEmployees: 1,
+		Type:              model.CompanyTypeCorporation,
+	}
+	cf.NoError(service.Create(context.Background(), company))
+	for _, name := range []string{"+1", "-1", "@SUM(A1)", "\tTab", "\rReturn", "'=1", "Plain - name"} {
+		cf.NoError(service.Create(context.Background(), &model.Company{Name: name, AmountOfEmployees: 1, Type: model.CompanyTypeCorporation}))
+	}
+
+	var output bytes.Buffer
+	_, err := service.Export(context.Background(), &output, CompanyFormatCSV, CompanyListQuery{})
+	cf.NoError(err)
+	records, err := csv.NewReader(bytes.NewReader(output.Bytes())).ReadAll()
+	cf.NoError(err)
+	var names []string
+	for _, record := range records[1:] {
+		names = append(names, record[1])
+		if record[0] == company.ID.String() {
+			cf.Equal("''quoted", record[2])
+		}
+	}
+	cf.ElementsMatch([]string{`'=HYPERLINK("http://example.com")`, "'+1", "'-1", "'@SUM(A1)", "'\tTab", "'\rReturn", "''=1", "Plain - name"}, names)
+
+	// The import restores the exported values.
+	result, err := service.Import(context.Background(), &output, CompanyFormatCSV, CompanyImportOptions{Upsert: true, DryRun: true})
+	cf.NoError(err)
+	cf.Empty(result.Errors)
+	cf.Equal(8, result.Updated)
+}
+
+func (cf *CompanyFixture) TestImport_DeletedName() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	company := &model.Company{Name: "Deleted", AmountOfEmployees: 1, Type: model.CompanyTypeCorporation}
+	cf.NoError(service.Create(context.Background(), company))
+	cf.NoError(service.Delete(context.Background(), company.ID, 0))
+
+	for _, options := range []CompanyImportOptions{{}, {Upsert: true}} {
+		result, err := service.Import(context.Background(), strings.NewReader("Name,AmountOfEmployees,Type\nDeleted,5,Cooperative\n"), CompanyFormatCSV, options)
+		cf.NoError(err)
+		cf.Zero(result.Created + result.Updated)
+		cf.Require().Len(result.Errors, 1)
+		cf.ErrorIs(result.Errors[0].Err, ErrDeletedName)
+		cf.ErrorIs(result.Errors[0].Err, ErrConflict)
+	}
+
+	// The deleted company is left as it was.
+	deleted, err := service.GetIncludingDeleted(context.Background(), company.ID)
+	cf.NoError(err)
+	cf.True(deleted.DeletedAt.Valid)
+	cf.Equal(1, deleted.AmountOfEmployees)
+}
+
+func (cf *CompanyFixture) TestSearch() {
+	service := NewCompanyService(repository.NewSqliteCompanyRepository(cf.db), validator.CompanyValidator(cf.logger))
+	cf.createCompanies(service)
+
+	result, err := service.Search(context.Background(), CompanySearchQuery{Query: "company", Limit: 3})
+	cf.NoError(err)
+	cf.Len(result.Items, 3)
+	cf.Equal("3", result.NextCursor)
+
+	result, err = service.Search(context.Background(), CompanySearchQuery{Query: "company", Limit: 3, Cursor: result.NextCursor})
+	cf.NoError(err)
+	cf.Len(result.Items, 2)
+	cf.Empty(result.NextCursor)
+
+	// Words are split on punctuation and matched as prefixes.
+	result, err = service.Search(context.Background(), CompanySearchQuery{Query: "  COMP-5 ", Types: []model.CompanyType{model.CompanyTypeNonProfit}})
+	cf.NoError(err)
+	cf.Len(result.Items, 1)
+	cf.Equal("Company 5", result.Items[0].Company.Name)
+
+	_, err = service.Search(context.Background(), CompanySearchQuery{Query: " -- "})
+	cf.ErrorIs(err, ErrInvalidListQuery)
+	_, err = service.Search(context.Background(), CompanySearchQuery{Query: "company", Cursor: "-1"})
+	cf.ErrorIs(err, ErrInvalidListQuery)
+}
+
+// sequenceEvents numbers the events for the change feed, as the event dispatcher does.
+func (cf *CompanyFixture) sequenceEvents() {
+	cf.NoError(event.NewDispatcher(cf.db, nil, cf.logger, time.Second, 0).Sequence(context.Background()))
+}
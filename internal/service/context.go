@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"github.com/vcsfrl/xm/internal/dto"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+)
+
+// WithActor returns a context carrying the user performing the request.
+func WithActor(ctx context.Context, actor dto.AuthUser) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext returns the user performing the request, if known.
+func ActorFromContext(ctx context.Context) (dto.AuthUser, bool) {
+	actor, ok := ctx.Value(actorKey).(dto.AuthUser)
+	return actor, ok
+}
+
+// WithRequestID returns a context carrying the ID of the request.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the ID of the request, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/vcsfrl/xm/internal/repository"
+	"strings"
+)
+
+// Error categories of the service layer. The errors returned by the services match
+// at most one of them with errors.Is, next to the more specific errors they wrap.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+)
+
+// FieldError describes why the value of a single field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError is a validation failure with the details of every invalid field.
+// It matches ErrValidation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrValidation, strings.Join(messages, ", "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// newValidationError converts the errors of the validator to a ValidationError.
+func newValidationError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	result := &ValidationError{}
+	for _, fieldError := range validationErrors {
+		result.Fields = append(result.Fields, FieldError{
+			Field:   fieldError.Field(),
+			Code:    fieldError.Tag(),
+			Message: validationMessage(fieldError),
+		})
+	}
+
+	return result
+}
+
+func validationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fieldError.Param()
+	case "max":
+		return "must be at most " + fieldError.Param() + " characters long"
+	case "company_type":
+		return "is not a known company type"
+	default:
+		return "is invalid"
+	}
+}
+
+// classify adds the error category matching a repository error.
+func classify(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, repository.ErrWebhookNotFound),
+		errors.Is(err, repository.ErrWebhookDeliveryNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, repository.ErrDuplicateName), errors.Is(err, repository.ErrVersionConflict), errors.Is(err, ErrDeletedName):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	default:
+		return err
+	}
+}
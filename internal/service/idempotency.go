@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"time"
+)
+
+const (
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+	// IdempotencyLockTimeout is how long a key stays reserved by a request that never completed,
+	// e.g. because the process stopped while handling it.
+	IdempotencyLockTimeout = time.Minute
+)
+
+var (
+	ErrIdempotencyService = errors.New("idempotency service error")
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyKeyInUse is returned when a request with the same key is still being processed.
+	ErrIdempotencyKeyInUse = fmt.Errorf("%w: idempotency key in use", ErrConflict)
+)
+
+// Idempotency remembers the responses of the requests made with an idempotency key,
+// so that retries get the original response instead of repeating the change.
+type Idempotency struct {
+	repository repository.IdempotencyRepository
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+func NewIdempotencyService(repository repository.IdempotencyRepository, ttl time.Duration) *Idempotency {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyKeyTTL
+	}
+
+	return &Idempotency{repository: repository, ttl: ttl, now: time.Now}
+}
+
+// Begin reserves the key for a request identified by the hash of its body. It returns the
+// stored response when a request with the key already completed, and nil when the caller
+// reserved the key and must Complete or Release it.
+func (s *Idempotency) Begin(ctx context.Context, scope string, key string, requestHash string) (*model.IdempotencyKey, error) {
+	repo := s.repository.WithContext(ctx)
+	now := s.now()
+	record := &model.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	err := repo.Create(record)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, repository.ErrDuplicateIdempotencyKey) {
+		return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, err)
+	}
+
+	existing, err := repo.Get(scope, key)
+	if errors.Is(err, repository.ErrIdempotencyKeyNotFound) {
+		// Released in the meantime.
+		return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, ErrIdempotencyKeyInUse)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, err)
+	}
+
+	abandoned := existing.Status == 0 && existing.CreatedAt.Before(now.Add(-IdempotencyLockTimeout))
+	if existing.ExpiresAt.Before(now) || abandoned {
+		if err := repo.Delete(scope, key); err != nil {
+			return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, err)
+		}
+		if err := repo.Create(record); err != nil {
+			return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, ErrIdempotencyKeyInUse)
+		}
+
+		return nil, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, ErrIdempotencyKeyReused)
+	}
+	if existing.Status == 0 {
+		return nil, fmt.Errorf("%w: begin: %w", ErrIdempotencyService, ErrIdempotencyKeyInUse)
+	}
+
+	return existing, nil
+}
+
+// Complete stores the response of a request that reserved the key.
+func (s *Idempotency) Complete(ctx context.Context, scope string, key string, status int, headers map[string]string, body []byte) error {
+	err := s.repository.WithContext(ctx).Complete(&model.IdempotencyKey{
+		Scope:   scope,
+		Key:     key,
+		Status:  status,
+		Headers: headers,
+		Body:    body,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: complete: %w", ErrIdempotencyService, err)
+	}
+
+	return nil
+}
+
+// Release frees a reserved key without storing a response, so that the request can be retried.
+func (s *Idempotency) Release(ctx context.Context, scope string, key string) error {
+	if err := s.repository.WithContext(ctx).Delete(scope, key); err != nil {
+		return fmt.Errorf("%w: release: %w", ErrIdempotencyService, err)
+	}
+
+	return nil
+}
+
+// Purge removes the expired keys and returns how many were removed.
+func (s *Idempotency) Purge(ctx context.Context) (int64, error) {
+	count, err := s.repository.WithContext(ctx).DeleteExpired(s.now())
+	if err != nil {
+		return 0, fmt.Errorf("%w: purge: %w", ErrIdempotencyService, err)
+	}
+
+	return count, nil
+}
+
+// Run purges the expired keys every interval until the context is cancelled.
+func (s *Idempotency) Run(ctx context.Context, logger zerolog.Logger, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		count, err := s.Purge(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("Purge idempotency keys.")
+		}
+		if count > 0 {
+			logger.Info().Int64("count", count).Msg("Expired idempotency keys purged.")
+		}
+	}
+}
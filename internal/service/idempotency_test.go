@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	suite.Run(t, new(IdempotencyFixture))
+}
+
+type IdempotencyFixture struct {
+	suite.Suite
+
+	service *Idempotency
+	now     time.Time
+}
+
+func (idf *IdempotencyFixture) SetupTest() {
+	database, err := db.InitTestSqlite()
+	idf.NoError(err)
+
+	idf.now = time.Now()
+	idf.service = NewIdempotencyService(repository.NewIdempotencyRepository(database), time.Hour)
+	idf.service.now = func() time.Time { return idf.now }
+}
+
+func (idf *IdempotencyFixture) TestBegin() {
+	ctx := context.Background()
+
+	stored, err := idf.service.Begin(ctx, "alice", "key-1", "hash-1")
+	idf.NoError(err)
+	idf.Nil(stored)
+
+	_, err = idf.service.Begin(ctx, "alice", "key-1", "hash-1")
+	idf.ErrorIs(err, ErrIdempotencyKeyInUse)
+	idf.ErrorIs(err, ErrConflict)
+
+	idf.NoError(idf.service.Complete(ctx, "alice", "key-1", 200, map[string]string{"ETag": `"1"`}, []byte(`{"ok":true}`)))
+
+	stored, err = idf.service.Begin(ctx, "alice", "key-1", "hash-1")
+	idf.NoError(err)
+	idf.Equal(200, stored.Status)
+	idf.Equal(`"1"`, stored.Headers["ETag"])
+	idf.Equal(`{"ok":true}`, string(stored.Body))
+
+	_, err = idf.service.Begin(ctx, "alice", "key-1", "hash-2")
+	idf.ErrorIs(err, ErrIdempotencyKeyReused)
+
+	// Keys are scoped.
+	stored, err = idf.service.Begin(ctx, "bob", "key-1", "hash-2")
+	idf.NoError(err)
+	idf.Nil(stored)
+}
+
+func (idf *IdempotencyFixture) TestRelease() {
+	ctx := context.Background()
+
+	_, err := idf.service.Begin(ctx, "alice", "key-1", "hash-1")
+	idf.NoError(err)
+	idf.NoError(idf.service.Release(ctx, "alice", "key-1"))
+
+	stored, err := idf.service.Begin(ctx, "alice", "key-1", "hash-2")
+	idf.NoError(err)
+	idf.Nil(stored)
+}
+
+func (idf *IdempotencyFixture) TestExpiry() {
+	ctx := context.Background()
+
+	_, err := idf.service.Begin(ctx, "alice", "abandoned", "hash-1")
+	idf.NoError(err)
+	_, err = idf.service.Begin(ctx, "alice", "completed", "hash-1")
+	idf.NoError(err)
+	idf.NoError(idf.service.Complete(ctx, "alice", "completed", 200, nil, []byte(`{}`)))
+
+	// An abandoned reservation is taken over after the lock timeout.
+	idf.now = idf.now.Add(2 * IdempotencyLockTimeout)
+	stored, err := idf.service.Begin(ctx, "alice", "abandoned", "hash-2")
+	idf.NoError(err)
+	idf.Nil(stored)
+
+	stored, err = idf.service.Begin(ctx, "alice", "completed", "hash-1")
+	idf.NoError(err)
+	idf.NotNil(stored)
+
+	// Expired keys are forgotten.
+	idf.now = idf.now.Add(2 * time.Hour)
+	count, err := idf.service.Purge(ctx)
+	idf.NoError(err)
+	idf.EqualValues(2, count)
+
+	stored, err = idf.service.Begin(ctx, "alice", "completed", "hash-2")
+	idf.NoError(err)
+	idf.Nil(stored)
+}
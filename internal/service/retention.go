@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"time"
+)
+
+const (
+	DefaultPurgeInterval  = time.Hour
+	DefaultPurgeBatchSize = 100
+)
+
+// Purge permanently removes the companies soft deleted before deletedBefore,
+// and returns how many were removed. Every removal is recorded in the audit trail.
+func (s *Company) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	total := 0
+	for {
+		count := 0
+		err := s.repository.WithContext(ctx).Transaction(func(repo repository.CompanyRepository) error {
+			companies, err := repo.Purge(deletedBefore, DefaultPurgeBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for i := range companies {
+				if err := recordAudit(ctx, repo, model.AuditActionPurge, &companies[i], nil); err != nil {
+					return err
+				}
+			}
+			count = len(companies)
+
+			return nil
+		})
+		if err != nil {
+			return total, fmt.Errorf("%w: purge: %w", ErrCompanyService, err)
+		}
+
+		total += count
+		if count < DefaultPurgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// RetentionJob periodically purges the companies soft deleted for longer than the retention period.
+type RetentionJob struct {
+	company   *Company
+	logger    zerolog.Logger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewRetentionJob(company *Company, logger zerolog.Logger, retention time.Duration, interval time.Duration) *RetentionJob {
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+
+	return &RetentionJob{company: company, logger: logger, retention: retention, interval: interval}
+}
+
+// Run purges expired companies until the context is cancelled.
+func (j *RetentionJob) Run(ctx context.Context) {
+	j.logger.Info().Dur("retention", j.retention).Dur("interval", j.interval).Msg("Retention job started.")
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := j.company.Purge(ctx, time.Now().Add(-j.retention))
+		if err != nil {
+			j.logger.Error().Err(err).Msg("Purge deleted companies.")
+		}
+		if count > 0 {
+			j.logger.Info().Int("count", count).Msg("Deleted companies purged.")
+		}
+
+		select {
+		case <-ctx.Done():
+			j.logger.Info().Msg("Retention job stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const MinPasswordLength = 8
+
+var (
+	ErrUserService        = errors.New("user service error")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidUser        = errors.New("invalid user")
+)
+
+// dummyHash is compared against when the user does not exist, so that a login
+// takes the same time whether or not the username is known.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+type User struct {
+	repository repository.UserRepository
+	cost       int
+}
+
+func NewUserService(repository repository.UserRepository) *User {
+	return &User{repository: repository, cost: bcrypt.DefaultCost}
+}
+
+// Add creates a user with a bcrypt hash of the password.
+func (s *User) Add(username string, password string, role model.Role) (*model.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, fmt.Errorf("%w: add: %w: username is required", ErrUserService, ErrInvalidUser)
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("%w: add: %w: unknown role %q", ErrUserService, ErrInvalidUser, role)
+	}
+
+	hash, err := s.hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("%w: add: %w", ErrUserService, err)
+	}
+
+	user := &model.User{Username: username, PasswordHash: hash, Role: role}
+	if err := s.repository.Create(user); err != nil {
+		return nil, fmt.Errorf("%w: add: %w", ErrUserService, err)
+	}
+
+	return user, nil
+}
+
+func (s *User) Remove(username string) error {
+	if err := s.repository.Delete(username); err != nil {
+		return fmt.Errorf("%w: remove: %w", ErrUserService, err)
+	}
+
+	return nil
+}
+
+func (s *User) ChangePassword(username string, password string) error {
+	hash, err := s.hash(password)
+	if err != nil {
+		return fmt.Errorf("%w: passwd: %w", ErrUserService, err)
+	}
+
+	if err := s.repository.UpdatePasswordHash(username, hash); err != nil {
+		return fmt.Errorf("%w: passwd: %w", ErrUserService, err)
+	}
+
+	return nil
+}
+
+func (s *User) SetRole(username string, role model.Role) error {
+	if !role.Valid() {
+		return fmt.Errorf("%w: role: %w: unknown role %q", ErrUserService, ErrInvalidUser, role)
+	}
+
+	if err := s.repository.UpdateRole(username, role); err != nil {
+		return fmt.Errorf("%w: role: %w", ErrUserService, err)
+	}
+
+	return nil
+}
+
+func (s *User) List() ([]model.User, error) {
+	users, err := s.repository.List()
+	if err != nil {
+		return nil, fmt.Errorf("%w: list: %w", ErrUserService, err)
+	}
+
+	return users, nil
+}
+
+func (s *User) Get(username string) (*model.User, error) {
+	user, err := s.repository.GetByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("%w: get: %w", ErrUserService, err)
+	}
+
+	return user, nil
+}
+
+// Authenticate returns the user when the password matches its hash.
+func (s *User) Authenticate(username string, password string) (*model.User, error) {
+	user, err := s.repository.GetByUsername(username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: authenticate: %w", ErrUserService, err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// Bootstrap creates the initial admin user when there are no users yet.
+// It reports whether the user was created.
+func (s *User) Bootstrap(username string, password string) (bool, error) {
+	count, err := s.repository.Count()
+	if err != nil {
+		return false, fmt.Errorf("%w: bootstrap: %w", ErrUserService, err)
+	}
+	if count > 0 || username == "" || password == "" {
+		return false, nil
+	}
+
+	if _, err := s.Add(username, password, model.RoleAdmin); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *User) hash(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("%w: password must have at least %d characters", ErrInvalidUser, MinPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	suite.Run(t, new(UserFixture))
+}
+
+type UserFixture struct {
+	suite.Suite
+
+	service *User
+}
+
+func (uf *UserFixture) SetupTest() {
+	database, err := db.InitTestSqlite()
+	uf.NoError(err)
+
+	uf.service = NewUserService(repository.NewUserRepository(database))
+	uf.service.cost = bcrypt.MinCost
+}
+
+func (uf *UserFixture) TestAdd() {
+	user, err := uf.service.Add("alice", "alice-password", model.RoleEditor)
+	uf.NoError(err)
+	uf.NotZero(user.ID)
+	uf.NotEqual("alice-password", user.PasswordHash)
+
+	_, err = uf.service.Add("alice", "another-password", model.RoleEditor)
+	uf.ErrorIs(err, repository.ErrDuplicateUser)
+
+	_, err = uf.service.Add("bob", "short", model.RoleEditor)
+	uf.ErrorIs(err, ErrInvalidUser)
+
+	_, err = uf.service.Add(" ", "bob-password", model.RoleEditor)
+	uf.ErrorIs(err, ErrInvalidUser)
+
+	_, err = uf.service.Add("bob", "bob-password", "owner")
+	uf.ErrorIs(err, ErrInvalidUser)
+}
+
+func (uf *UserFixture) TestSetRole() {
+	user, err := uf.service.Add("alice", "alice-password", model.RoleViewer)
+	uf.NoError(err)
+	uf.Equal(model.RoleViewer, user.Role)
+
+	uf.NoError(uf.service.SetRole("alice", model.RoleAdmin))
+	user, err = uf.service.Get("alice")
+	uf.NoError(err)
+	uf.Equal(model.RoleAdmin, user.Role)
+
+	uf.ErrorIs(uf.service.SetRole("alice", "owner"), ErrInvalidUser)
+	uf.ErrorIs(uf.service.SetRole("unknown", model.RoleEditor), repository.ErrUserNotFound)
+}
+
+func (uf *UserFixture) TestAuthenticate() {
+	_, err := uf.service.Add("alice", "alice-password", model.RoleEditor)
+	uf.NoError(err)
+
+	user, err := uf.service.Authenticate("alice", "alice-password")
+	uf.NoError(err)
+	uf.Equal("alice", user.Username)
+
+	_, err = uf.service.Authenticate("alice", "wrong-password")
+	uf.ErrorIs(err, ErrInvalidCredentials)
+
+	_, err = uf.service.Authenticate("unknown", "alice-password")
+	uf.ErrorIs(err, ErrInvalidCredentials)
+}
+
+func (uf *UserFixture) TestChangePasswordAndRemove() {
+	_, err := uf.service.Add("alice", "alice-password", model.RoleEditor)
+	uf.NoError(err)
+
+	uf.NoError(uf.service.ChangePassword("alice", "new-alice-password"))
+	_, err = uf.service.Authenticate("alice", "alice-password")
+	uf.ErrorIs(err, ErrInvalidCredentials)
+	_, err = uf.service.Authenticate("alice", "new-alice-password")
+	uf.NoError(err)
+
+	uf.ErrorIs(uf.service.ChangePassword("unknown", "new-password"), repository.ErrUserNotFound)
+
+	uf.NoError(uf.service.Remove("alice"))
+	uf.ErrorIs(uf.service.Remove("alice"), repository.ErrUserNotFound)
+
+	users, err := uf.service.List()
+	uf.NoError(err)
+	uf.Empty(users)
+}
+
+func (uf *UserFixture) TestBootstrap() {
+	created, err := uf.service.Bootstrap("", "")
+	uf.NoError(err)
+	uf.False(created)
+
+	created, err = uf.service.Bootstrap("admin", "admin")
+	uf.ErrorIs(err, ErrInvalidUser)
+	uf.False(created)
+
+	created, err = uf.service.Bootstrap("admin", "admin-password")
+	uf.NoError(err)
+	uf.True(created)
+
+	created, err = uf.service.Bootstrap("other", "other-password")
+	uf.NoError(err)
+	uf.False(created)
+
+	users, err := uf.service.List()
+	uf.NoError(err)
+	uf.Len(users, 1)
+	uf.Equal(model.RoleAdmin, users[0].Role)
+}
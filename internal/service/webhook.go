@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultWebhookDeliveryLimit = 20
+	MaxWebhookDeliveryLimit     = 100
+	webhookSecretBytes          = 32
+	maxWebhookURLLength         = 2000
+	minWebhookSecretLength      = 16
+	maxWebhookSecretLength      = 100
+)
+
+var ErrWebhookService = errors.New("webhook service error")
+
+// ErrWebhookNotFound is returned when the webhook does not exist.
+var ErrWebhookNotFound = repository.ErrWebhookNotFound
+
+// ErrWebhookDeliveryNotFound is returned when the webhook has no such delivery.
+var ErrWebhookDeliveryNotFound = repository.ErrWebhookDeliveryNotFound
+
+// Webhook manages the webhook subscriptions and the log of their deliveries. The deliveries
+// themselves are made by webhook.Dispatcher.
+type Webhook struct {
+	repository repository.WebhookRepository
+	company    *Company
+	now        func() time.Time
+}
+
+func NewWebhookService(repository repository.WebhookRepository, company *Company) *Webhook {
+	return &Webhook{repository: repository, company: company, now: time.Now}
+}
+
+// WebhookDeliveries is a page of deliveries, newest first, and the cursor of the next page, if any.
+type WebhookDeliveries struct {
+	Items      []model.WebhookDelivery
+	NextCursor string
+}
+
+// Create registers a webhook for the events following its creation. A secret is generated
+// when the webhook has none; it is only disclosed to the caller of Create.
+func (s *Webhook) Create(ctx context.Context, webhook *model.Webhook) error {
+	if err := validateWebhook(webhook); err != nil {
+		return fmt.Errorf("%w: validation: %w", ErrWebhookService, err)
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("%w: create: secret: %w", ErrWebhookService, err)
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	lastEventSequence, err := s.company.LastEventSequence(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: create: %w", ErrWebhookService, err)
+	}
+	webhook.LastEventID = lastEventSequence
+
+	if err := s.repository.WithContext(ctx).Create(webhook); err != nil {
+		return fmt.Errorf("%w: create: %w", ErrWebhookService, err)
+	}
+
+	return nil
+}
+
+func (s *Webhook) Get(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	webhook, err := s.repository.WithContext(ctx).Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: get: %w", ErrWebhookService, classify(err))
+	}
+
+	return webhook, nil
+}
+
+func (s *Webhook) List(ctx context.Context) ([]model.Webhook, error) {
+	webhooks, err := s.repository.WithContext(ctx).List()
+	if err != nil {
+		return nil, fmt.Errorf("%w: list: %w", ErrWebhookService, err)
+	}
+
+	return webhooks, nil
+}
+
+func (s *Webhook) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := s.repository.WithContext(ctx).Delete(id); err != nil {
+		return fmt.Errorf("%w: delete: %w", ErrWebhookService, classify(err))
+	}
+
+	return nil
+}
+
+// Deliveries returns the delivery log of a webhook, newest first. The dead deliveries, which
+// failed every attempt, are listed with the model.WebhookDeliveryDead status.
+func (s *Webhook) Deliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int, cursor string) (*WebhookDeliveries, error) {
+	if limit <= 0 {
+		limit = DefaultWebhookDeliveryLimit
+	}
+	if limit > MaxWebhookDeliveryLimit {
+		limit = MaxWebhookDeliveryLimit
+	}
+	if status != "" && !slices.Contains(model.WebhookDeliveryStatuses, status) {
+		return nil, fmt.Errorf("%w: deliveries: %w: unknown status %q", ErrWebhookService, ErrInvalidListQuery, status)
+	}
+
+	var beforeID uint64
+	if cursor != "" {
+		var err error
+		beforeID, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil || beforeID == 0 {
+			return nil, fmt.Errorf("%w: deliveries: %w: malformed cursor", ErrWebhookService, ErrInvalidListQuery)
+		}
+	}
+
+	repo := s.repository.WithContext(ctx)
+	if _, err := repo.Get(webhookID); err != nil {
+		return nil, fmt.Errorf("%w: deliveries: %w", ErrWebhookService, classify(err))
+	}
+
+	deliveries, err := repo.ListDeliveries(webhookID, status, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: deliveries: %w", ErrWebhookService, err)
+	}
+
+	result := &WebhookDeliveries{Items: deliveries}
+	if len(deliveries) > limit {
+		result.Items = deliveries[:limit]
+		result.NextCursor = strconv.FormatUint(result.Items[limit-1].ID, 10)
+	}
+
+	return result, nil
+}
+
+// Redeliver schedules a delivery again, with a new series of attempts, whatever its status.
+func (s *Webhook) Redeliver(ctx context.Context, webhookID uuid.UUID, id uint64) (*model.WebhookDelivery, error) {
+	repo := s.repository.WithContext(ctx)
+	delivery, err := repo.GetDelivery(webhookID, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: redeliver: %w", ErrWebhookService, classify(err))
+	}
+
+	now := s.now()
+	delivery.Status = model.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.LastError = ""
+	delivery.ResponseStatus = 0
+	if err := repo.UpdateDelivery(delivery); err != nil {
+		return nil, fmt.Errorf("%w: redeliver: %w", ErrWebhookService, classify(err))
+	}
+
+	return delivery, nil
+}
+
+// Enqueue records the deliveries of the events a webhook gets, up to lastEventID.
+func (s *Webhook) Enqueue(ctx context.Context, webhookID uuid.UUID, lastEventID uint64, deliveries []model.WebhookDelivery) error {
+	if err := s.repository.WithContext(ctx).Enqueue(webhookID, lastEventID, deliveries); err != nil {
+		return fmt.Errorf("%w: enqueue: %w", ErrWebhookService, err)
+	}
+
+	return nil
+}
+
+// DueDeliveries returns the pending deliveries due at the time, oldest first.
+func (s *Webhook) DueDeliveries(ctx context.Context, at time.Time, limit int) ([]model.WebhookDelivery, error) {
+	deliveries, err := s.repository.WithContext(ctx).DueDeliveries(at, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: due deliveries: %w", ErrWebhookService, err)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDelivery reserves a due delivery until the time, before an attempt, and reports whether it
+// was still due; when it was not, another dispatcher claimed it.
+func (s *Webhook) ClaimDelivery(ctx context.Context, delivery *model.WebhookDelivery, at time.Time, until time.Time) (bool, error) {
+	claimed, err := s.repository.WithContext(ctx).ClaimDelivery(delivery.ID, at, until)
+	if err != nil {
+		return false, fmt.Errorf("%w: claim delivery %d: %w", ErrWebhookService, delivery.ID, err)
+	}
+	if claimed {
+		delivery.NextAttemptAt = &until
+	}
+
+	return claimed, nil
+}
+
+// RecordAttempt saves the outcome of a delivery attempt.
+func (s *Webhook) RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery) error {
+	if err := s.repository.WithContext(ctx).UpdateDelivery(delivery); err != nil {
+		return fmt.Errorf("%w: record attempt %d: %w", ErrWebhookService, delivery.ID, classify(err))
+	}
+
+	return nil
+}
+
+func validateWebhook(webhook *model.Webhook) error {
+	result := &ValidationError{}
+	target, err := url.Parse(webhook.URL)
+	switch {
+	case webhook.URL == "":
+		result.Fields = append(result.Fields, FieldError{Field: "URL", Code: "required", Message: "is required"})
+	case len(webhook.URL) > maxWebhookURLLength:
+		result.Fields = append(result.Fields, FieldError{Field: "URL", Code: "max", Message: "must be at most " + strconv.Itoa(maxWebhookURLLength) + " characters long"})
+	case err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "":
+		result.Fields = append(result.Fields, FieldError{Field: "URL", Code: "url", Message: "must be an absolute http or https URL"})
+	}
+	if webhook.Secret != "" && (len(webhook.Secret) < minWebhookSecretLength || len(webhook.Secret) > maxWebhookSecretLength) {
+		result.Fields = append(result.Fields, FieldError{Field: "Secret", Code: "len", Message: fmt.Sprintf("must be %d to %d characters long", minWebhookSecretLength, maxWebhookSecretLength)})
+	}
+	for _, eventType := range webhook.Events {
+		if !slices.Contains(model.EventTypes, eventType) {
+			result.Fields = append(result.Fields, FieldError{Field: "Events", Code: "event_type", Message: "is not a known event type: " + eventType})
+			break
+		}
+	}
+
+	if len(result.Fields) > 0 {
+		return result
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/validator"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	suite.Run(t, new(WebhookFixture))
+}
+
+type WebhookFixture struct {
+	suite.Suite
+
+	db         *gorm.DB
+	company    *Company
+	service    *Webhook
+	repository repository.WebhookRepository
+}
+
+func (wf *WebhookFixture) SetupTest() {
+	var err error
+	wf.db, err = db.InitTestSqlite()
+	wf.NoError(err)
+
+	wf.company = NewCompanyService(repository.NewSqliteCompanyRepository(wf.db), validator.CompanyValidator(zerolog.Nop()))
+	wf.repository = repository.NewWebhookRepository(wf.db)
+	wf.service = NewWebhookService(wf.repository, wf.company)
+}
+
+func (wf *WebhookFixture) TestCreate() {
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	wf.NoError(wf.company.Create(context.Background(), company))
+	wf.NoError(event.NewDispatcher(wf.db, nil, zerolog.Nop(), time.Second, 0).Sequence(context.Background()))
+
+	webhook := &model.Webhook{URL: "https://partner.example/xm", Events: []string{model.EventCompanyUpdated}}
+	wf.NoError(wf.service.Create(context.Background(), webhook))
+	wf.NotEqual(uuid.Nil, webhook.ID)
+	wf.Len(webhook.Secret, 2*webhookSecretBytes)
+	// Only the events following the creation are delivered.
+	wf.Equal(uint64(1), webhook.LastEventID)
+
+	stored, err := wf.service.Get(context.Background(), webhook.ID)
+	wf.NoError(err)
+	wf.Equal(webhook.Secret, stored.Secret)
+	wf.Equal([]string{model.EventCompanyUpdated}, stored.Events)
+
+	withSecret := &model.Webhook{URL: "http://partner.example/xm", Secret: "a-secret-of-the-partner"}
+	wf.NoError(wf.service.Create(context.Background(), withSecret))
+	wf.Equal("a-secret-of-the-partner", withSecret.Secret)
+
+	webhooks, err := wf.service.List(context.Background())
+	wf.NoError(err)
+	wf.Len(webhooks, 2)
+}
+
+func (wf *WebhookFixture) TestCreate_Invalid() {
+	for _, webhook := range []model.Webhook{
+		{},
+		{URL: "partner.example/xm"},
+		{URL: "ftp://partner.example/xm"},
+		{URL: "https://partner.example/xm", Secret: "short"},
+		{URL: "https://partner.example/xm", Events: []string{"CompanyRenamed"}},
+	} {
+		err := wf.service.Create(context.Background(), &webhook)
+		wf.ErrorIs(err, ErrValidation, webhook.URL)
+		wf.ErrorIs(err, ErrWebhookService)
+		var validationError *ValidationError
+		wf.True(errors.As(err, &validationError))
+		wf.Len(validationError.Fields, 1)
+	}
+}
+
+func (wf *WebhookFixture) TestDelete() {
+	webhook := &model.Webhook{URL: "https://partner.example/xm"}
+	wf.NoError(wf.service.Create(context.Background(), webhook))
+	wf.NoError(wf.service.Enqueue(context.Background(), webhook.ID, 1, []model.WebhookDelivery{wf.delivery(webhook.ID, 1)}))
+
+	wf.NoError(wf.service.Delete(context.Background(), webhook.ID))
+	_, err := wf.service.Get(context.Background(), webhook.ID)
+	wf.ErrorIs(err, ErrWebhookNotFound)
+	wf.ErrorIs(err, ErrNotFound)
+	wf.ErrorIs(wf.service.Delete(context.Background(), webhook.ID), ErrNotFound)
+
+	var count int64
+	wf.NoError(wf.db.Model(&model.WebhookDelivery{}).Count(&count).Error)
+	wf.Zero(count)
+}
+
+func (wf *WebhookFixture) TestDeliveries() {
+	webhook := &model.Webhook{URL: "https://partner.example/xm"}
+	wf.NoError(wf.service.Create(context.Background(), webhook))
+	var deliveries []model.WebhookDelivery
+	for id := uint64(1); id <= 5; id++ {
+		deliveries = append(deliveries, wf.delivery(webhook.ID, id))
+	}
+	deliveries[1].Status = model.WebhookDeliveryDead
+	wf.NoError(wf.service.Enqueue(context.Background(), webhook.ID, 5, deliveries))
+
+	// The events already enqueued are not enqueued again.
+	wf.NoError(wf.service.Enqueue(context.Background(), webhook.ID, 5, []model.WebhookDelivery{wf.delivery(webhook.ID, 5)}))
+
+	page, err := wf.service.Deliveries(context.Background(), webhook.ID, "", 3, "")
+	wf.NoError(err)
+	wf.Len(page.Items, 3)
+	wf.Equal(uint64(5), page.Items[0].EventID)
+	wf.NotEmpty(page.NextCursor)
+
+	page, err = wf.service.Deliveries(context.Background(), webhook.ID, "", 3, page.NextCursor)
+	wf.NoError(err)
+	wf.Len(page.Items, 2)
+	wf.Empty(page.NextCursor)
+
+	dead, err := wf.service.Deliveries(context.Background(), webhook.ID, model.WebhookDeliveryDead, 0, "")
+	wf.NoError(err)
+	wf.Len(dead.Items, 1)
+	wf.Equal(uint64(2), dead.Items[0].EventID)
+
+	_, err = wf.service.Deliveries(context.Background(), webhook.ID, "lost", 0, "")
+	wf.ErrorIs(err, ErrInvalidListQuery)
+	_, err = wf.service.Deliveries(context.Background(), webhook.ID, "", 0, "x")
+	wf.ErrorIs(err, ErrInvalidListQuery)
+	_, err = wf.service.Deliveries(context.Background(), uuid.New(), "", 0, "")
+	wf.ErrorIs(err, ErrNotFound)
+}
+
+func (wf *WebhookFixture) TestRedeliver() {
+	webhook := &model.Webhook{URL: "https://partner.example/xm"}
+	wf.NoError(wf.service.Create(context.Background(), webhook))
+	delivery := wf.delivery(webhook.ID, 1)
+	delivery.Status = model.WebhookDeliveryDead
+	delivery.Attempts = 8
+	delivery.NextAttemptAt = nil
+	delivery.LastError = "unexpected status 500"
+	wf.NoError(wf.service.Enqueue(context.Background(), webhook.ID, 1, []model.WebhookDelivery{delivery}))
+
+	now := time.Now()
+	wf.service.now = func() time.Time { return now }
+	dead, err := wf.service.Deliveries(context.Background(), webhook.ID, model.WebhookDeliveryDead, 0, "")
+	wf.NoError(err)
+	redelivered, err := wf.service.Redeliver(context.Background(), webhook.ID, dead.Items[0].ID)
+	wf.NoError(err)
+	wf.Equal(model.WebhookDeliveryPending, redelivered.Status)
+	wf.Zero(redelivered.Attempts)
+	wf.Empty(redelivered.LastError)
+
+	due, err := wf.service.DueDeliveries(context.Background(), now, 10)
+	wf.NoError(err)
+	wf.Len(due, 1)
+	wf.Equal(redelivered.ID, due[0].ID)
+
+	_, err = wf.service.Redeliver(context.Background(), webhook.ID, redelivered.ID+1)
+	wf.ErrorIs(err, ErrWebhookDeliveryNotFound)
+	_, err = wf.service.Redeliver(context.Background(), uuid.New(), redelivered.ID)
+	wf.ErrorIs(err, ErrNotFound)
+}
+
+func (wf *WebhookFixture) delivery(webhookID uuid.UUID, eventID uint64) model.WebhookDelivery {
+	now := time.Now()
+
+	return model.WebhookDelivery{
+		WebhookID:     webhookID,
+		EventID:       eventID,
+		EventType:     model.EventCompanyCreated,
+		Payload:       "{}",
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+	}
+}
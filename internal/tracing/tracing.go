@@ -0,0 +1,74 @@
+// Package tracing exports OpenTelemetry traces of the requests and database queries over OTLP.
+package tracing
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/vcsfrl/xm/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "xm"
+	tracerName  = "github.com/vcsfrl/xm"
+)
+
+// Propagator reads and writes the W3C traceparent, tracestate and baggage headers.
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Attributes of the spans.
+const (
+	AttributeUsername  = attribute.Key("enduser.id")
+	AttributeCompanyID = attribute.Key("xm.company.id")
+)
+
+// Init installs the W3C trace context propagator and, when an endpoint is configured, a tracer
+// provider exporting the spans to it over OTLP/HTTP. The returned function flushes the spans
+// and stops the export.
+func Init(ctx context.Context, config *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(Propagator)
+	if config.TracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(config.TracingEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithSampler(
+		sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio)),
+	))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider returns a tracer provider describing the service, e.g. for tests with an in-memory exporter.
+func NewTracerProvider(options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	options = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	}, options...)
+
+	return sdktrace.NewTracerProvider(options...)
+}
+
+// SetCompanyID records the company a request is about on its current span.
+func SetCompanyID(ctx context.Context, id uuid.UUID) {
+	trace.SpanFromContext(ctx).SetAttributes(AttributeCompanyID.String(id.String()))
+}
+
+// SetUsername records the authenticated user of a request on its current span.
+func SetUsername(ctx context.Context, username string) {
+	trace.SpanFromContext(ctx).SetAttributes(AttributeUsername.String(username))
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/config"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	suite.Run(t, new(TracingFixture))
+}
+
+type TracingFixture struct {
+	suite.Suite
+	exporter *tracetest.InMemoryExporter
+	previous trace.TracerProvider
+}
+
+func (tf *TracingFixture) SetupTest() {
+	tf.exporter = tracetest.NewInMemoryExporter()
+	tf.previous = otel.GetTracerProvider()
+	otel.SetTracerProvider(NewTracerProvider(sdktrace.WithSyncer(tf.exporter)))
+}
+
+func (tf *TracingFixture) TearDownTest() {
+	otel.SetTracerProvider(tf.previous)
+}
+
+func (tf *TracingFixture) TestRegisterDB() {
+	database, err := db.InitTestSqlite()
+	tf.NoError(err)
+	tf.NoError(RegisterDB(database))
+
+	ctx, parent := tracer().Start(context.Background(), "parent")
+	tf.NoError(database.WithContext(ctx).Create(&model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}).Error)
+	var company model.Company
+	err = database.WithContext(ctx).First(&company, "name = ?", "Unknown").Error
+	tf.Error(err)
+	err = database.WithContext(ctx).Exec("SELECT * FROM unknown").Error
+	tf.Error(err)
+	parent.End()
+
+	spans := tf.exporter.GetSpans()
+	tf.Require().Len(spans, 4)
+	for _, span := range spans[:3] {
+		tf.Equal(parent.SpanContext().SpanID(), span.Parent.SpanID(), span.Name)
+		tf.Equal(trace.SpanKindClient, span.SpanKind, span.Name)
+		tf.Equal("sqlite", attributes(span)["db.system"].AsString(), span.Name)
+	}
+
+	tf.Equal("gorm.create", spans[0].Name)
+	tf.Equal("companies", attributes(spans[0])["db.collection.name"].AsString())
+	tf.Equal(int64(1), attributes(spans[0])["db.rows_affected"].AsInt64())
+	// The values of the query are not recorded.
+	tf.Contains(attributes(spans[0])["db.query.text"].AsString(), "INSERT INTO `companies`")
+	tf.NotContains(attributes(spans[0])["db.query.text"].AsString(), "TestCompany")
+	tf.Equal(codes.Unset, spans[0].Status.Code)
+
+	// A missing record is an answer, not a failure.
+	tf.Equal("gorm.query", spans[1].Name)
+	tf.Equal(codes.Unset, spans[1].Status.Code)
+
+	tf.Equal("gorm.raw", spans[2].Name)
+	tf.Equal(codes.Error, spans[2].Status.Code)
+	tf.NotEmpty(spans[2].Events)
+}
+
+func (tf *TracingFixture) TestSetAttributes() {
+	id := uuid.New()
+	ctx, span := tracer().Start(context.Background(), "request")
+	SetCompanyID(ctx, id)
+	SetUsername(ctx, "admin")
+	span.End()
+
+	spans := tf.exporter.GetSpans()
+	tf.Require().Len(spans, 1)
+	tf.Equal(id.String(), attributes(spans[0])[AttributeCompanyID].AsString())
+	tf.Equal("admin", attributes(spans[0])[AttributeUsername].AsString())
+	serviceName, _ := spans[0].Resource.Set().Value(semconv.ServiceNameKey)
+	tf.Equal(ServiceName, serviceName.AsString())
+}
+
+func (tf *TracingFixture) TestInit_Disabled() {
+	provider := otel.GetTracerProvider()
+	shutdown, err := Init(context.Background(), &config.Config{TracingSampleRatio: 1})
+	tf.NoError(err)
+	tf.NoError(shutdown(context.Background()))
+
+	tf.Equal(provider, otel.GetTracerProvider())
+	tf.Contains(otel.GetTextMapPropagator().Fields(), "traceparent")
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		values[kv.Key] = kv.Value
+	}
+
+	return values
+}
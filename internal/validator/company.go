@@ -4,12 +4,24 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog"
 	"github.com/vcsfrl/xm/internal/model"
+	"reflect"
 	"slices"
+	"strings"
 )
 
 func CompanyValidator(logger zerolog.Logger) *validator.Validate {
 	var validate = validator.New()
 
+	// report the invalid fields by their JSON names
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
 	// register a custom validation for company type
 	err := validate.RegisterValidation("company_type", func(fl validator.FieldLevel) bool {
 		value := fl.Field().Interface().(model.CompanyType)
@@ -0,0 +1,320 @@
+// Package webhook delivers the company events to the registered webhooks.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/service"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDispatchInterval = time.Second
+	DefaultMaxAttempts      = 8
+	DefaultTimeout          = 10 * time.Second
+	DefaultBatchSize        = 100
+	DefaultWorkers          = 8
+	minBackoff              = 10 * time.Second
+	maxBackoff              = time.Hour
+	maxLastErrorLength      = 500
+	maxResponseBodyLength   = 64 << 10
+	userAgent               = "xm-webhooks/1"
+)
+
+// claimLease is the time a claimed delivery is left to its dispatcher, past the timeout of an
+// attempt; a delivery claimed by a dispatcher that stopped is attempted again after it.
+const claimLease = 2 * DefaultTimeout
+
+var ErrDispatcher = errors.New("webhook dispatcher error")
+
+// Dispatcher turns the company events into deliveries of the webhooks that select them,
+// and makes the due deliveries.
+//
+// The deliveries of a webhook are made one after the other, the webhooks concurrently, up to
+// workers at a time, so that a slow webhook does not hold the others back. Every delivery is
+// claimed before it is attempted, so that the replicas do not make it twice. A failed delivery is
+// retried with exponential backoff and, after maxAttempts attempts, is left dead until it is
+// redelivered. Delivery is at-least-once: receivers must tolerate
+// duplicates by the X-XM-Delivery header, and events may arrive out of order after retries.
+type Dispatcher struct {
+	webhooks    *service.Webhook
+	company     *service.Company
+	client      *http.Client
+	logger      zerolog.Logger
+	interval    time.Duration
+	maxAttempts int
+	workers     int
+	batchSize   int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+}
+
+// NewDispatcher returns a dispatcher delivering to the public addresses, and to the internal ones
+// of allowedNetworks.
+func NewDispatcher(webhooks *service.Webhook, company *service.Company, logger zerolog.Logger, interval time.Duration, maxAttempts int, workers int, allowedNetworks []netip.Prefix) *Dispatcher {
+	if interval <= 0 {
+		interval = DefaultDispatchInterval
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	return &Dispatcher{
+		webhooks:    webhooks,
+		company:     company,
+		client:      newClient(DefaultTimeout, allowedNetworks),
+		logger:      logger,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		workers:     workers,
+		batchSize:   DefaultBatchSize,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		now:         time.Now,
+	}
+}
+
+// Run dispatches the events until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.logger.Info().Dur("interval", d.interval).Int("max_attempts", d.maxAttempts).Int("workers", d.workers).Msg("Webhook dispatcher started.")
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Enqueue(ctx); err != nil {
+			d.logger.Error().Err(err).Msg("Enqueue webhook deliveries.")
+		}
+		for {
+			count, err := d.Deliver(ctx)
+			if err != nil {
+				d.logger.Error().Err(err).Msg("Deliver webhooks.")
+			}
+			if err != nil || count < d.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			d.logger.Info().Msg("Webhook dispatcher stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Enqueue creates the deliveries of the new events for every webhook.
+func (d *Dispatcher) Enqueue(ctx context.Context) error {
+	webhooks, err := d.webhooks.List(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDispatcher, err)
+	}
+
+	var errs []error
+	for _, webhook := range webhooks {
+		if err := d.enqueue(ctx, webhook); err != nil {
+			errs = append(errs, fmt.Errorf("%w: webhook %s: %w", ErrDispatcher, webhook.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, webhook model.Webhook) error {
+	query := service.CompanyEventQuery{AfterSequence: webhook.LastEventID, CompanyIDs: webhook.CompanyIDs, Limit: d.batchSize}
+	for {
+		events, next, err := d.company.Events(ctx, query)
+		if err != nil {
+			return err
+		}
+		if next == query.AfterSequence {
+			return nil
+		}
+
+		now := d.now()
+		deliveries := make([]model.WebhookDelivery, 0, len(events))
+		for _, outboxEvent := range events {
+			if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, outboxEvent.Type) {
+				continue
+			}
+			payload, err := json.Marshal(event.NewMessage(outboxEvent))
+			if err != nil {
+				return fmt.Errorf("encode event %d: %w", outboxEvent.ID, err)
+			}
+			deliveries = append(deliveries, model.WebhookDelivery{
+				WebhookID:     webhook.ID,
+				EventID:       outboxEvent.ID,
+				EventType:     outboxEvent.Type,
+				Payload:       string(payload),
+				Status:        model.WebhookDeliveryPending,
+				NextAttemptAt: &now,
+			})
+		}
+		if err := d.webhooks.Enqueue(ctx, webhook.ID, next, deliveries); err != nil {
+			return err
+		}
+		query.AfterSequence = next
+	}
+}
+
+// Deliver makes one batch of due deliveries and returns how many were attempted, leaving the ones
+// another dispatcher claimed. A failed attempt does not stop the batch; it is recorded on the delivery.
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := d.webhooks.DueDeliveries(ctx, d.now(), d.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDispatcher, err)
+	}
+
+	// The deliveries of a webhook, in order.
+	var webhookIDs []uuid.UUID
+	batches := map[uuid.UUID][]*model.WebhookDelivery{}
+	for i := range deliveries {
+		webhookID := deliveries[i].WebhookID
+		if _, found := batches[webhookID]; !found {
+			webhookIDs = append(webhookIDs, webhookID)
+		}
+		batches[webhookID] = append(batches[webhookID], &deliveries[i])
+	}
+
+	jobs := make(chan []*model.WebhookDelivery)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	attempted := 0
+	for range min(d.workers, len(webhookIDs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range jobs {
+				count, err := d.deliver(ctx, batch)
+				mutex.Lock()
+				attempted += count
+				if err != nil {
+					errs = append(errs, err)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, webhookID := range webhookIDs {
+		jobs <- batches[webhookID]
+	}
+	close(jobs)
+	wg.Wait()
+
+	return attempted, errors.Join(errs...)
+}
+
+// deliver makes the deliveries of a webhook, one after the other, and returns how many were attempted.
+func (d *Dispatcher) deliver(ctx context.Context, deliveries []*model.WebhookDelivery) (int, error) {
+	webhook, err := d.webhooks.Get(ctx, deliveries[0].WebhookID)
+	if err != nil {
+		return 0, fmt.Errorf("%w: delivery %d: %w", ErrDispatcher, deliveries[0].ID, err)
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		now := d.now()
+		claimed, err := d.webhooks.ClaimDelivery(ctx, delivery, now, now.Add(claimLease))
+		if err != nil {
+			return attempted, fmt.Errorf("%w: %w", ErrDispatcher, err)
+		}
+		if !claimed {
+			continue
+		}
+
+		d.attempt(ctx, webhook, delivery)
+		attempted++
+		if err := d.webhooks.RecordAttempt(ctx, delivery); err != nil {
+			return attempted, fmt.Errorf("%w: %w", ErrDispatcher, err)
+		}
+	}
+
+	return attempted, nil
+}
+
+// attempt sends a delivery and updates its state with the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) {
+	now := d.now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+
+	statusCode, err := d.send(ctx, webhook, delivery, now)
+	delivery.ResponseStatus = statusCode
+	if err == nil {
+		delivery.Status = model.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxLastErrorLength {
+		delivery.LastError = delivery.LastError[:maxLastErrorLength]
+	}
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = model.WebhookDeliveryDead
+		delivery.NextAttemptAt = nil
+		d.logger.Warn().Str("webhook", webhook.ID.String()).Uint64("delivery", delivery.ID).Int("attempts", delivery.Attempts).Msg("Webhook delivery dead.")
+		return
+	}
+
+	next := now.Add(d.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.ID, 10))
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	request.Header.Set(HeaderSignature, Sign(webhook.Secret, now, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	// Draining the body lets the connection be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBodyLength))
+	_ = response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt, doubled after every failed attempt.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.maxBackoff)
+}
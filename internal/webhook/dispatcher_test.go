@@ -0,0 +1,358 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"github.com/vcsfrl/xm/internal/db"
+	"github.com/vcsfrl/xm/internal/event"
+	"github.com/vcsfrl/xm/internal/model"
+	"github.com/vcsfrl/xm/internal/repository"
+	"github.com/vcsfrl/xm/internal/service"
+	"github.com/vcsfrl/xm/internal/validator"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	suite.Run(t, new(DispatcherFixture))
+}
+
+type DispatcherFixture struct {
+	suite.Suite
+
+	db             *gorm.DB
+	companyService *service.Company
+	webhookService *service.Webhook
+	dispatcher     *Dispatcher
+	events         *event.Dispatcher
+	now            time.Time
+
+	receiver *httptest.Server
+	mutex    sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func (df *DispatcherFixture) SetupTest() {
+	var err error
+	df.db, err = db.InitTestSqlite()
+	df.NoError(err)
+	df.companyService = service.NewCompanyService(repository.NewSqliteCompanyRepository(df.db), validator.CompanyValidator(zerolog.Nop()))
+	df.webhookService = service.NewWebhookService(repository.NewWebhookRepository(df.db), df.companyService)
+
+	df.now = time.Now()
+	// The receivers listen on the loopback.
+	df.dispatcher = NewDispatcher(df.webhookService, df.companyService, zerolog.Nop(), time.Second, 3, 2, df.loopback())
+	df.dispatcher.now = func() time.Time { return df.now }
+	df.events = event.NewDispatcher(df.db, nil, zerolog.Nop(), time.Second, 0)
+
+	df.status = http.StatusNoContent
+	df.requests = nil
+	df.receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		df.mutex.Lock()
+		defer df.mutex.Unlock()
+		df.requests = append(df.requests, receivedRequest{path: r.URL.Path, header: r.Header.Clone(), body: body})
+		w.WriteHeader(df.status)
+	}))
+}
+
+func (df *DispatcherFixture) TearDownTest() {
+	df.receiver.Close()
+}
+
+func (df *DispatcherFixture) TestDispatch() {
+	all := &model.Webhook{URL: df.receiver.URL + "/all"}
+	df.NoError(df.webhookService.Create(context.Background(), all))
+
+	followed := &model.Company{Name: "Followed", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), followed))
+	df.NoError(df.events.Sequence(context.Background()))
+	deletions := &model.Webhook{
+		URL:        df.receiver.URL + "/deletions",
+		Events:     []string{model.EventCompanyDeleted},
+		CompanyIDs: []uuid.UUID{followed.ID},
+	}
+	df.NoError(df.webhookService.Create(context.Background(), deletions))
+
+	other := &model.Company{Name: "Other", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), other))
+	df.NoError(df.companyService.Delete(context.Background(), other.ID, 0))
+	df.NoError(df.companyService.Delete(context.Background(), followed.ID, 0))
+
+	df.NoError(df.enqueue())
+	count, err := df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(5, count)
+
+	secrets := map[string]string{"/all": all.Secret, "/deletions": deletions.Secret}
+	// The webhooks are delivered concurrently, the deliveries of a webhook in order.
+	messages := map[string][]event.Message{}
+	for _, request := range df.requests {
+		df.Equal("application/json", request.header.Get("Content-Type"))
+		df.Equal(strconv.FormatInt(df.now.Unix(), 10), request.header.Get(HeaderTimestamp))
+		df.NotEmpty(request.header.Get(HeaderDelivery))
+		err := Verify(secrets[request.path], request.header.Get(HeaderTimestamp), request.header.Get(HeaderSignature), request.body, time.Minute, df.now)
+		df.NoError(err, request.path)
+
+		var message event.Message
+		df.NoError(json.Unmarshal(request.body, &message))
+		df.Equal(message.Type, request.header.Get(HeaderEvent))
+		messages[request.path] = append(messages[request.path], message)
+	}
+	// The webhook created after the first event does not get it.
+	df.Require().Len(messages["/all"], 4)
+	df.Require().Len(messages["/deletions"], 1)
+	df.Equal(model.EventCompanyCreated, messages["/all"][0].Type)
+	df.Equal(followed.ID, messages["/all"][0].CompanyID)
+	df.Equal(model.EventCompanyDeleted, messages["/all"][3].Type)
+	df.Equal(model.EventCompanyDeleted, messages["/deletions"][0].Type)
+	df.Equal(followed.ID, messages["/deletions"][0].CompanyID)
+	for i := 1; i < len(messages["/all"]); i++ {
+		df.Less(messages["/all"][i-1].Sequence, messages["/all"][i].Sequence)
+	}
+
+	deliveries, err := df.webhookService.Deliveries(context.Background(), all.ID, model.WebhookDeliverySucceeded, 0, "")
+	df.NoError(err)
+	df.Len(deliveries.Items, 4)
+	df.Equal(1, deliveries.Items[0].Attempts)
+	df.Equal(http.StatusNoContent, deliveries.Items[0].ResponseStatus)
+	df.Nil(deliveries.Items[0].NextAttemptAt)
+
+	// Nothing is delivered twice.
+	df.NoError(df.enqueue())
+	count, err = df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Zero(count)
+}
+
+func (df *DispatcherFixture) TestDispatch_Retries() {
+	webhook := &model.Webhook{URL: df.receiver.URL}
+	df.NoError(df.webhookService.Create(context.Background(), webhook))
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), company))
+	df.NoError(df.enqueue())
+
+	df.status = http.StatusInternalServerError
+	for attempt, backoff := range []time.Duration{minBackoff, 2 * minBackoff} {
+		count, err := df.dispatcher.Deliver(context.Background())
+		df.NoError(err)
+		df.Equal(1, count)
+
+		delivery := df.delivery(webhook)
+		df.Equal(model.WebhookDeliveryPending, delivery.Status)
+		df.Equal(attempt+1, delivery.Attempts)
+		df.Equal(http.StatusInternalServerError, delivery.ResponseStatus)
+		df.Equal("unexpected status 500", delivery.LastError)
+		df.WithinDuration(df.now.Add(backoff), *delivery.NextAttemptAt, time.Millisecond)
+
+		// Not due before the backoff.
+		count, err = df.dispatcher.Deliver(context.Background())
+		df.NoError(err)
+		df.Zero(count)
+		df.now = df.now.Add(backoff)
+	}
+
+	count, err := df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	delivery := df.delivery(webhook)
+	df.Equal(model.WebhookDeliveryDead, delivery.Status)
+	df.Equal(3, delivery.Attempts)
+	df.Nil(delivery.NextAttemptAt)
+	df.Len(df.requests, 3)
+	// The retries are the same delivery.
+	df.Equal(df.requests[0].header.Get(HeaderDelivery), df.requests[2].header.Get(HeaderDelivery))
+	df.Equal(df.requests[0].body, df.requests[2].body)
+
+	df.status = http.StatusOK
+	_, err = df.webhookService.Redeliver(context.Background(), webhook.ID, delivery.ID)
+	df.NoError(err)
+	count, err = df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	delivery = df.delivery(webhook)
+	df.Equal(model.WebhookDeliverySucceeded, delivery.Status)
+	df.Equal(1, delivery.Attempts)
+	df.Empty(delivery.LastError)
+}
+
+func (df *DispatcherFixture) TestDispatch_Unreachable() {
+	webhook := &model.Webhook{URL: df.receiver.URL}
+	df.NoError(df.webhookService.Create(context.Background(), webhook))
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), company))
+	df.NoError(df.enqueue())
+	df.receiver.Close()
+
+	count, err := df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	delivery := df.delivery(webhook)
+	df.Equal(model.WebhookDeliveryPending, delivery.Status)
+	df.Zero(delivery.ResponseStatus)
+	df.Contains(delivery.LastError, "connect")
+}
+
+func (df *DispatcherFixture) TestDispatch_Claimed() {
+	webhook := &model.Webhook{URL: df.receiver.URL}
+	df.NoError(df.webhookService.Create(context.Background(), webhook))
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), company))
+	df.NoError(df.enqueue())
+
+	// Another replica read the due delivery too, and claims it first.
+	due, err := df.webhookService.DueDeliveries(context.Background(), df.now, 10)
+	df.NoError(err)
+	df.Require().Len(due, 1)
+	claimed, err := df.webhookService.ClaimDelivery(context.Background(), &due[0], df.now, df.now.Add(claimLease))
+	df.NoError(err)
+	df.True(claimed)
+	claimed, err = df.webhookService.ClaimDelivery(context.Background(), &due[0], df.now, df.now.Add(claimLease))
+	df.NoError(err)
+	df.False(claimed)
+
+	count, err := df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Zero(count)
+	df.Empty(df.requests)
+
+	// The delivery is attempted again once the lease of the replica expired.
+	df.now = df.now.Add(claimLease)
+	count, err = df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	df.Equal(model.WebhookDeliverySucceeded, df.delivery(webhook).Status)
+	df.Len(df.requests, 1)
+}
+
+func (df *DispatcherFixture) TestDispatch_Concurrent() {
+	// Each webhook answers once both are being delivered to.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	both := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(both)
+	}()
+	barrier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		select {
+		case <-both:
+			w.WriteHeader(http.StatusNoContent)
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}
+	}))
+	defer barrier.Close()
+
+	first := &model.Webhook{URL: barrier.URL + "/first"}
+	df.NoError(df.webhookService.Create(context.Background(), first))
+	second := &model.Webhook{URL: barrier.URL + "/second"}
+	df.NoError(df.webhookService.Create(context.Background(), second))
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), company))
+	df.NoError(df.enqueue())
+
+	count, err := df.dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(2, count)
+	df.Equal(model.WebhookDeliverySucceeded, df.delivery(first).Status)
+	df.Equal(model.WebhookDeliverySucceeded, df.delivery(second).Status)
+}
+
+func (df *DispatcherFixture) TestDispatch_ForbiddenAddress() {
+	webhook := &model.Webhook{URL: df.receiver.URL}
+	df.NoError(df.webhookService.Create(context.Background(), webhook))
+	company := &model.Company{Name: "TestCompany", AmountOfEmployees: 10, Type: model.CompanyTypeCorporation}
+	df.NoError(df.companyService.Create(context.Background(), company))
+	df.NoError(df.enqueue())
+
+	dispatcher := NewDispatcher(df.webhookService, df.companyService, zerolog.Nop(), time.Second, 3, 2, nil)
+	dispatcher.now = df.dispatcher.now
+	count, err := dispatcher.Deliver(context.Background())
+	df.NoError(err)
+	df.Equal(1, count)
+	delivery := df.delivery(webhook)
+	df.Equal(model.WebhookDeliveryPending, delivery.Status)
+	df.Contains(delivery.LastError, ErrForbiddenAddress.Error())
+	df.Empty(df.requests)
+}
+
+func (df *DispatcherFixture) TestCheckAddress() {
+	allowed, err := ParseNetworks(" 10.1.0.0/16, fd00::/8")
+	df.NoError(err)
+
+	df.NoError(checkAddress("93.184.215.14:443", nil))
+	df.NoError(checkAddress("[2606:2800:21f:cb07::1]:443", nil))
+	for _, address := range []string{"127.0.0.1:80", "[::1]:80", "10.1.2.3:80", "192.168.1.1:80", "172.16.0.1:80",
+		"169.254.169.254:80", "[fe80::1]:80", "0.0.0.0:80", "[::ffff:127.0.0.1]:80"} {
+		df.ErrorIs(checkAddress(address, nil), ErrForbiddenAddress, address)
+	}
+	df.NoError(checkAddress("10.1.2.3:80", allowed))
+	df.NoError(checkAddress("[fd00::1]:80", allowed))
+	df.ErrorIs(checkAddress("10.2.0.1:80", allowed), ErrForbiddenAddress)
+
+	_, err = ParseNetworks("10.1.0.0")
+	df.ErrorIs(err, ErrInvalidNetwork)
+}
+
+func (df *DispatcherFixture) TestBackoff() {
+	df.Equal(minBackoff, df.dispatcher.backoff(1))
+	df.Equal(2*minBackoff, df.dispatcher.backoff(2))
+	df.Equal(4*minBackoff, df.dispatcher.backoff(3))
+	df.Equal(maxBackoff, df.dispatcher.backoff(100))
+}
+
+func (df *DispatcherFixture) TestVerify() {
+	body := []byte(`{"id":1}`)
+	timestamp := strconv.FormatInt(df.now.Unix(), 10)
+	signature := Sign("secret", df.now, body)
+
+	df.NoError(Verify("secret", timestamp, signature, body, time.Minute, df.now))
+	df.ErrorIs(Verify("other", timestamp, signature, body, time.Minute, df.now), ErrInvalidSignature)
+	df.ErrorIs(Verify("secret", timestamp, signature, []byte(`{"id":2}`), time.Minute, df.now), ErrInvalidSignature)
+	df.ErrorIs(Verify("secret", timestamp, signature, body, time.Minute, df.now.Add(2*time.Minute)), ErrInvalidSignature)
+	df.ErrorIs(Verify("secret", "yesterday", signature, body, time.Minute, df.now), ErrInvalidSignature)
+	df.ErrorIs(Verify("secret", timestamp, signature[len(signaturePrefix):], body, time.Minute, df.now), ErrInvalidSignature)
+}
+
+// enqueue numbers the events, as the event dispatcher does, and enqueues their deliveries.
+func (df *DispatcherFixture) enqueue() error {
+	if err := df.events.Sequence(context.Background()); err != nil {
+		return err
+	}
+
+	return df.dispatcher.Enqueue(context.Background())
+}
+
+func (df *DispatcherFixture) loopback() []netip.Prefix {
+	allowed, err := ParseNetworks("127.0.0.0/8,::1/128")
+	df.Require().NoError(err)
+
+	return allowed
+}
+
+func (df *DispatcherFixture) delivery(webhook *model.Webhook) model.WebhookDelivery {
+	deliveries, err := df.webhookService.Deliveries(context.Background(), webhook.ID, "", 0, "")
+	df.Require().NoError(err)
+	df.Require().Len(deliveries.Items, 1)
+
+	return deliveries.Items[0]
+}
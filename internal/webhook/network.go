@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrForbiddenAddress = errors.New("forbidden webhook address")
+	ErrInvalidNetwork   = errors.New("invalid webhook network")
+)
+
+// ParseNetworks parses the comma separated CIDRs of XM_WEBHOOK_ALLOWED_NETWORKS, e.g. "10.1.0.0/16,::1/128".
+func ParseNetworks(networks string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, network := range strings.Split(networks, ",") {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidNetwork, network)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// newClient returns the HTTP client of the deliveries. It refuses to connect to the loopback, private,
+// link-local and unspecified addresses, unless they are in allowedNetworks, so that a webhook cannot
+// reach the internal services. The address is checked once resolved, when it is dialed, which covers
+// the redirects and the host names resolving to an internal address.
+func newClient(timeout time.Duration, allowedNetworks []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			return checkAddress(address, allowedNetworks)
+		},
+	}
+	// No proxy: it would dial the webhooks, past the check.
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: timeout,
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func checkAddress(address string, allowedNetworks []netip.Prefix) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	ip := addrPort.Addr().Unmap()
+	if !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified() {
+		return nil
+	}
+	for _, prefix := range allowedNetworks {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of the delivery requests.
+const (
+	HeaderEvent     = "X-XM-Event"
+	HeaderDelivery  = "X-XM-Delivery"
+	HeaderTimestamp = "X-XM-Timestamp"
+	HeaderSignature = "X-XM-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256, keyed with the secret
+// of the webhook, of the Unix timestamp, a dot and the body, prefixed with "sha256=".
+// Signing the timestamp lets the receivers reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the X-XM-Timestamp and X-XM-Signature headers of a delivery the way the
+// receivers should: the signature must match and the timestamp be within tolerance of now.
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if now.Sub(signedAt).Abs() > tolerance {
+		return fmt.Errorf("%w: timestamp out of tolerance", ErrInvalidSignature)
+	}
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("%w: unknown scheme", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, signedAt, body))) {
+		return fmt.Errorf("%w: mismatch", ErrInvalidSignature)
+	}
+
+	return nil
+}